@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/conductorone/baton-google-bigquery/pkg/connector"
 	configSchema "github.com/conductorone/baton-sdk/pkg/config"
@@ -19,11 +20,46 @@ const (
 	version                 = "dev"
 	connectorName           = "baton-google-bigquery"
 	credentialsJSONFilePath = "credentials-json-file-path"
+	auditLogParent          = "audit-log-parent"
+	auditLogFilePath        = "audit-log-file-path"
+	usageEnrichment         = "usage-enrichment"
+	usageWindowDays         = "usage-window-days"
+	locations               = "locations"
+	directorySubject        = "directory-subject"
+	backend                 = "backend"
+	assetScope              = "asset-scope"
+	assetExportPath         = "asset-export-path"
+	accessTokenLifetime     = "access-token-lifetime"
+	accessTokenScopes       = "access-token-scopes"
 )
 
 var (
-	credentialsJSONFilePathField = field.StringField(credentialsJSONFilePath, field.WithRequired(true), field.WithDescription("JSON credentials file name for the Google identity platform account."))
-	configurationFields          = []field.SchemaField{credentialsJSONFilePathField}
+	credentialsJSONFilePathField = field.StringField(credentialsJSONFilePath, field.WithDescription("JSON credentials file name for the Google identity platform account. Required unless the backend is file."))
+	auditLogParentField          = field.StringField(auditLogParent, field.WithDescription("Resource name (projects/ID, folders/ID or organizations/ID) whose Cloud Audit Logs feed the event stream. Defaults to the credentials project."))
+	auditLogFilePathField        = field.StringField(auditLogFilePath, field.WithDescription("Path to a JSON-lines file of exported Cloud Audit Log entries, read instead of Cloud Logging."))
+	usageEnrichmentField         = field.BoolField(usageEnrichment, field.WithDescription("Annotate users and dataset grants with query activity read from INFORMATION_SCHEMA.JOBS_BY_PROJECT."))
+	usageWindowDaysField         = field.IntField(usageWindowDays, field.WithDefaultValue(90), field.WithDescription("Number of days of query jobs considered by the usage enrichment."))
+	locationsField               = field.StringSliceField(locations, field.WithDefaultValue([]string{"US"}), field.WithDescription("BigQuery locations (regions or multi-regions) to read location-bound data from."))
+	directorySubjectField        = field.StringField(directorySubject, field.WithDescription("Workspace admin impersonated through domain-wide delegation to enrich users with Admin SDK Directory data."))
+	backendField                 = field.StringField(backend, field.WithDefaultValue(connector.DirectBackend), field.WithDescription("How IAM policies and dataset access lists are read: direct (one API call per project and dataset), asset (bulk Cloud Asset Inventory searches) or file (offline, from a Cloud Asset Inventory export)."))
+	assetScopeField              = field.StringField(assetScope, field.WithDescription("Organization (organizations/ID) or folder (folders/ID) searched by the asset backend."))
+	assetExportPathField         = field.StringField(assetExportPath, field.WithDescription("Cloud Asset Inventory export (newline-delimited JSON with RESOURCE and IAM_POLICY content), or a directory of export files, read by the file backend."))
+	accessTokenLifetimeField     = field.IntField(accessTokenLifetime, field.WithDefaultValue(3600), field.WithDescription("Longest lifetime, in seconds, of the access tokens issued for service accounts."))
+	accessTokenScopesField       = field.StringSliceField(accessTokenScopes, field.WithDefaultValue([]string{"https://www.googleapis.com/auth/bigquery"}), field.WithDescription("OAuth scopes of the access tokens issued for service accounts."))
+	configurationFields          = []field.SchemaField{
+		credentialsJSONFilePathField,
+		auditLogParentField,
+		auditLogFilePathField,
+		usageEnrichmentField,
+		usageWindowDaysField,
+		locationsField,
+		directorySubjectField,
+		backendField,
+		assetScopeField,
+		assetExportPathField,
+		accessTokenLifetimeField,
+		accessTokenScopesField,
+	}
 )
 
 func main() {
@@ -48,7 +84,20 @@ func main() {
 
 func getConnector(ctx context.Context, cfg *viper.Viper) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
-	cb, err := connector.New(ctx, cfg.GetString(credentialsJSONFilePath))
+	cb, err := connector.New(ctx, &connector.Config{
+		CredentialsJSONFilePath: cfg.GetString(credentialsJSONFilePath),
+		AuditLogParent:          cfg.GetString(auditLogParent),
+		AuditLogFilePath:        cfg.GetString(auditLogFilePath),
+		UsageEnrichment:         cfg.GetBool(usageEnrichment),
+		UsageWindowDays:         cfg.GetInt(usageWindowDays),
+		Locations:               cfg.GetStringSlice(locations),
+		DirectorySubject:        cfg.GetString(directorySubject),
+		Backend:                 cfg.GetString(backend),
+		AssetScope:              cfg.GetString(assetScope),
+		AssetExportPath:         cfg.GetString(assetExportPath),
+		AccessTokenLifetime:     time.Duration(cfg.GetInt(accessTokenLifetime)) * time.Second,
+		AccessTokenScopes:       cfg.GetStringSlice(accessTokenScopes),
+	})
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
@@ -0,0 +1,216 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	credentials "cloud.google.com/go/iam/credentials/apiv1"
+	"cloud.google.com/go/iam/credentials/apiv1/credentialspb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// accessTokenPlaintextName names the issued OAuth access token in the encrypted issuance output.
+	accessTokenPlaintextName = "access_token"
+	// defaultAccessTokenLifetime is the longest lifetime IAM Credentials accepts without the
+	// constraints/iam.allowServiceAccountCredentialLifetimeExtension organization policy.
+	defaultAccessTokenLifetime = time.Hour
+	// minAccessTokenLifetime is the shortest lifetime of an issued access token.
+	minAccessTokenLifetime = time.Minute
+)
+
+// defaultAccessTokenScopes are the OAuth scopes granted to issued access tokens unless configured otherwise.
+var defaultAccessTokenScopes = []string{"https://www.googleapis.com/auth/bigquery"}
+
+// accessTokenIssuer mints short-lived OAuth access tokens for service accounts through the IAM Credentials
+// generateAccessToken API. The connector principal needs roles/iam.serviceAccountTokenCreator on them.
+type accessTokenIssuer struct {
+	credentialsClient *credentials.IamCredentialsClient
+	lifetime          time.Duration
+	scopes            []string
+}
+
+func newAccessTokenIssuer(credentialsClient *credentials.IamCredentialsClient, lifetime time.Duration, scopes []string) *accessTokenIssuer {
+	if lifetime <= 0 {
+		lifetime = defaultAccessTokenLifetime
+	}
+	if len(scopes) == 0 {
+		scopes = defaultAccessTokenScopes
+	}
+
+	return &accessTokenIssuer{
+		credentialsClient: credentialsClient,
+		lifetime:          lifetime,
+		scopes:            scopes,
+	}
+}
+
+// capabilityDetails advertises bearer tokens limited to the configured scopes, expiring at the latest after the
+// configured lifetime. Tokens cannot be listed once issued.
+func (i *accessTokenIssuer) capabilityDetails() *v2.CredentialDetailsCredentialIssue {
+	return v2.CredentialDetailsCredentialIssue_builder{
+		Options: []*v2.CredentialIssueOptionDescriptor{
+			v2.CredentialIssueOptionDescriptor_builder{
+				Option: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_TOKEN,
+				Scopes: i.scopes,
+				Expiry: v2.IssuanceExpiryCapability_builder{
+					Min: durationpb.New(minAccessTokenLifetime),
+					Max: durationpb.New(i.lifetime),
+				}.Build(),
+				ResourceMode:         v2.CredentialResourceMode_CREDENTIAL_RESOURCE_MODE_VIRTUAL,
+				SecretResourceTypeId: accessTokenResourceType.Id,
+			}.Build(),
+		},
+		PreferredOption: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_TOKEN,
+	}.Build()
+}
+
+// issue generates an access token for the service account identity. The token lives until the requested expiry,
+// kept between one minute and the configured lifetime, or for the configured lifetime. It has the requested scopes,
+// which must be among the configured ones, or all the configured ones.
+func (i *accessTokenIssuer) issue(ctx context.Context, input *connectorbuilder.CredentialIssueInput) (*connectorbuilder.CredentialIssueOutput, error) {
+	l := ctxzap.Extract(ctx)
+	identityID := input.IdentityID
+	email := identityID.GetResource()
+	if identityID.GetResourceType() != userResourceType.Id || !isServiceAccountEmail(email) {
+		return nil, fmt.Errorf("baton-google-bigquery: access tokens can only be issued for service accounts, got %s", email)
+	}
+	if i.credentialsClient == nil {
+		return nil, fmt.Errorf("baton-google-bigquery: access tokens cannot be issued by an offline connector")
+	}
+
+	issuedAt := time.Now()
+	scopes, lifetime, err := i.tokenOptions(input, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := i.credentialsClient.GenerateAccessToken(ctx, &credentialspb.GenerateAccessTokenRequest{
+		Name:     "projects/-/serviceAccounts/" + email,
+		Scope:    scopes,
+		Lifetime: durationpb.New(lifetime),
+	})
+	if err != nil {
+		return nil, wrapError(err, "failed to generate access token for service account "+email)
+	}
+
+	expiresAt := resp.GetExpireTime().AsTime()
+	secret, err := accessTokenResource(identityID, input.RequestID, scopes, issuedAt, expiresAt)
+	if err != nil {
+		return nil, wrapError(err, "failed to create access token resource")
+	}
+
+	l.Info("access token issued",
+		zap.String("service_account", email),
+		zap.Strings("scopes", scopes),
+		zap.Time("expires_at", expiresAt),
+	)
+
+	return &connectorbuilder.CredentialIssueOutput{
+		Secret: secret,
+		PlaintextData: []*v2.PlaintextData{
+			v2.PlaintextData_builder{
+				Name:  accessTokenPlaintextName,
+				Bytes: []byte(resp.GetAccessToken()),
+			}.Build(),
+		},
+		ResourceMode: v2.CredentialResourceMode_CREDENTIAL_RESOURCE_MODE_VIRTUAL,
+	}, nil
+}
+
+// tokenOptions returns the scopes and lifetime of a token issued at issuedAt. Requested scopes must be among the
+// configured ones, and a requested expiry must be in the future.
+func (i *accessTokenIssuer) tokenOptions(input *connectorbuilder.CredentialIssueInput, issuedAt time.Time) ([]string, time.Duration, error) {
+	scopes := input.CredentialOptions.GetToken().GetScopes()
+	if len(scopes) == 0 {
+		scopes = i.scopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(i.scopes, scope) {
+			return nil, 0, status.Errorf(codes.InvalidArgument, "baton-google-bigquery: scope %s is not one of the configured access token scopes", scope)
+		}
+	}
+
+	if input.ExpiresAt == nil {
+		return scopes, i.lifetime, nil
+	}
+
+	expiresAt := input.ExpiresAt.AsTime()
+	if !expiresAt.After(issuedAt) {
+		return nil, 0, status.Errorf(codes.InvalidArgument, "baton-google-bigquery: requested expiry %s is in the past", expiresAt.Format(time.RFC3339))
+	}
+
+	return scopes, min(max(expiresAt.Sub(issuedAt).Truncate(time.Second), minAccessTokenLifetime), i.lifetime), nil
+}
+
+// accessTokenResource creates the handle of an issued access token, identified by the service account and the
+// issuance request. Its profile holds the scopes the token was issued with.
+func accessTokenResource(identityID *v2.ResourceId, requestID string, scopes []string, issuedAt, expiresAt time.Time) (*v2.Resource, error) {
+	email := identityID.GetResource()
+	profile := map[string]interface{}{
+		"service_account": email,
+		"scopes":          stringsToInterfaces(scopes),
+		"request_id":      requestID,
+	}
+
+	return rs.NewSecretResource(
+		fmt.Sprintf("%s access token", email),
+		accessTokenResourceType,
+		fmt.Sprintf("%s/%s", email, requestID),
+		[]rs.SecretTraitOption{
+			rs.WithSecretIdentityID(identityID),
+			rs.WithSecretCreatedAt(issuedAt),
+			rs.WithSecretExpiresAt(expiresAt),
+			rs.WithSecretType(v2.SecretTrait_CREDENTIAL_TYPE_STATIC_SECRET),
+			rs.WithSecretDetail("OAuth access token"),
+		},
+		rs.WithResourceProfile(profile),
+	)
+}
+
+// accessTokenBuilder holds the access tokens issued for service accounts. They cannot be listed, nor revoked
+// without the token itself, and expire at the end of their lifetime.
+type accessTokenBuilder struct {
+	resourceType *v2.ResourceType
+}
+
+func (o *accessTokenBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return accessTokenResourceType
+}
+
+func (o *accessTokenBuilder) List(_ context.Context, _ *v2.ResourceId, _ *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *accessTokenBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *accessTokenBuilder) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// Delete refuses to remove an issued access token. IAM Credentials keeps no record of the tokens it generates, the
+// token stays valid until it expires. The deleter is still needed, credential issuance requires one on the secret
+// resource type.
+func (o *accessTokenBuilder) Delete(_ context.Context, resourceId *v2.ResourceId, _ *v2.ResourceId) (annotations.Annotations, error) {
+	return nil, status.Errorf(codes.Unimplemented,
+		"baton-google-bigquery: access token %s cannot be revoked, it remains valid until it expires", resourceId.GetResource())
+}
+
+func newAccessTokenBuilder() *accessTokenBuilder {
+	return &accessTokenBuilder{
+		resourceType: accessTokenResourceType,
+	}
+}
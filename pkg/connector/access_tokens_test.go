@@ -0,0 +1,81 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestAccessTokenIssuer(t *testing.T) {
+	issuer := newAccessTokenIssuer(nil, 0, nil)
+	details := issuer.capabilityDetails()
+	require.Len(t, details.GetOptions(), 1)
+	option := details.GetOptions()[0]
+	require.Equal(t, v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_TOKEN, option.GetOption())
+	require.Equal(t, []string{"https://www.googleapis.com/auth/bigquery"}, option.GetScopes())
+	require.Equal(t, time.Hour, option.GetExpiry().GetMax().AsDuration())
+	require.Equal(t, accessTokenResourceType.Id, option.GetSecretResourceTypeId())
+
+	// Only service accounts can be impersonated.
+	_, err := issuer.issue(ctxTest, &connectorbuilder.CredentialIssueInput{
+		IdentityID: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "alice@example.com"},
+	})
+	require.Error(t, err)
+
+	// Scopes are limited to the configured ones, lifetimes to between a minute and the configured lifetime.
+	issuedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	scopes, lifetime, err := issuer.tokenOptions(&connectorbuilder.CredentialIssueInput{}, issuedAt)
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://www.googleapis.com/auth/bigquery"}, scopes)
+	require.Equal(t, time.Hour, lifetime)
+
+	_, _, err = issuer.tokenOptions(&connectorbuilder.CredentialIssueInput{
+		CredentialOptions: v2.CredentialIssueOptions_builder{
+			Token: v2.CredentialIssueOptions_Token_builder{
+				Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"},
+			}.Build(),
+		}.Build(),
+	}, issuedAt)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	for expiresIn, expected := range map[time.Duration]time.Duration{
+		10 * time.Second: time.Minute,
+		30 * time.Minute: 30 * time.Minute,
+		24 * time.Hour:   time.Hour,
+	} {
+		_, lifetime, err = issuer.tokenOptions(&connectorbuilder.CredentialIssueInput{
+			ExpiresAt: timestamppb.New(issuedAt.Add(expiresIn)),
+		}, issuedAt)
+		require.NoError(t, err)
+		require.Equal(t, expected, lifetime)
+	}
+
+	_, _, err = issuer.tokenOptions(&connectorbuilder.CredentialIssueInput{
+		ExpiresAt: timestamppb.New(issuedAt.Add(-time.Minute)),
+	}, issuedAt)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Issued tokens cannot be revoked.
+	_, err = newAccessTokenBuilder().Delete(ctxTest, &v2.ResourceId{ResourceType: accessTokenResourceType.Id, Resource: "etl/req-1"}, nil)
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	identityID := &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "etl@demo-project.iam.gserviceaccount.com"}
+	secret, err := accessTokenResource(identityID, "req-1", []string{"https://www.googleapis.com/auth/bigquery.readonly"}, issuedAt, issuedAt.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, "etl@demo-project.iam.gserviceaccount.com/req-1", secret.GetId().GetResource())
+
+	trait := &v2.SecretTrait{}
+	annos := annotations.Annotations(secret.GetAnnotations())
+	ok, err := annos.Pick(trait)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "etl@demo-project.iam.gserviceaccount.com", trait.GetIdentityId().GetResource())
+	require.Equal(t, issuedAt.Add(time.Hour), trait.GetExpiresAt().AsTime())
+}
@@ -0,0 +1,318 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	cloudasset "google.golang.org/api/cloudasset/v1"
+)
+
+// exportedAsset is a line of a Cloud Asset Inventory export, holding the RESOURCE or the IAM_POLICY content of an
+// asset. Exports written to Cloud Storage use snake case field names, the API returns camel case ones.
+type exportedAsset struct {
+	Name           string             `json:"name"`
+	AssetType      string             `json:"asset_type"`
+	AssetTypeCamel string             `json:"assetType"`
+	Resource       *exportedResource  `json:"resource"`
+	IamPolicy      *cloudasset.Policy `json:"iam_policy"`
+	IamPolicyCamel *cloudasset.Policy `json:"iamPolicy"`
+	Ancestors      []string           `json:"ancestors"`
+}
+
+type exportedResource struct {
+	Location string          `json:"location"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// exportedProject is the RESOURCE data of a project, in the v1 (projectNumber, lifecycleState, name) or the v3
+// (name, state, displayName) representation of the Resource Manager API.
+type exportedProject struct {
+	ProjectID      string            `json:"projectId"`
+	ProjectNumber  string            `json:"projectNumber"`
+	Name           string            `json:"name"`
+	DisplayName    string            `json:"displayName"`
+	LifecycleState string            `json:"lifecycleState"`
+	State          string            `json:"state"`
+	Parent         json.RawMessage   `json:"parent"`
+	Labels         map[string]string `json:"labels"`
+	CreateTime     string            `json:"createTime"`
+	UpdateTime     string            `json:"updateTime"`
+}
+
+func (a *exportedAsset) assetType() string {
+	if a.AssetType != "" {
+		return a.AssetType
+	}
+	return a.AssetTypeCamel
+}
+
+func (a *exportedAsset) iamPolicy() *cloudasset.Policy {
+	if a.IamPolicy != nil {
+		return a.IamPolicy
+	}
+	return a.IamPolicyCamel
+}
+
+// fileBackend reads a Cloud Asset Inventory export instead of calling GCP, the path is an export file or a directory
+// of export files. RESOURCE content gives the projects and datasets, IAM_POLICY content their policies.
+type fileBackend struct {
+	path string
+
+	mtx    sync.Mutex
+	loaded bool
+	index  *assetIndex
+}
+
+func newFileBackend(path string) *fileBackend {
+	return &fileBackend{
+		path: path,
+	}
+}
+
+func (b *fileBackend) Projects(ctx context.Context) ([]*resourcemanagerpb.Project, error) {
+	index, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.projects, nil
+}
+
+func (b *fileBackend) ProjectsPage(ctx context.Context, pageToken string) ([]*resourcemanagerpb.Project, string, error) {
+	index, err := b.load()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return offsetPage(index.projects, pageToken, projectsPageSize)
+}
+
+func (b *fileBackend) ProjectPolicy(ctx context.Context, projectID string) (*iampb.Policy, error) {
+	index, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.projectPolicy(projectID), nil
+}
+
+func (b *fileBackend) Datasets(ctx context.Context, projectID string) ([]string, error) {
+	index, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.datasetIDs[projectID], nil
+}
+
+func (b *fileBackend) DatasetsPage(ctx context.Context, projectID string, pageToken string) ([]string, string, error) {
+	index, err := b.load()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return offsetPage(index.datasetIDs[projectID], pageToken, datasetsPageSize)
+}
+
+func (b *fileBackend) Dataset(ctx context.Context, projectID string, datasetID string) (*bigqueryapi.Dataset, error) {
+	index, err := b.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.datasets[datasetResourceID(projectID, datasetID)], nil
+}
+
+// load reads the export the first time it is called. Resources are indexed before policies so that the access list
+// of a dataset's metadata takes precedence over its IAM policy whatever the order of the files.
+func (b *fileBackend) load() (*assetIndex, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.loaded {
+		return b.index, nil
+	}
+
+	paths, err := exportFiles(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []*exportedAsset
+	for _, path := range paths {
+		fileAssets, err := readExportFile(path)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, fileAssets...)
+	}
+
+	index := newAssetIndex()
+	for _, asset := range assets {
+		if asset.Resource != nil {
+			if err := index.addExportedResource(asset); err != nil {
+				return nil, wrapError(err, "failed to parse exported resource "+asset.Name)
+			}
+		}
+	}
+	for _, asset := range assets {
+		if policy := asset.iamPolicy(); policy != nil {
+			index.addPolicy(&cloudasset.IamPolicySearchResult{
+				AssetType: asset.assetType(),
+				Resource:  asset.Name,
+				Policy:    policy,
+			})
+		}
+	}
+
+	b.index = index
+	b.loaded = true
+	return index, nil
+}
+
+// exportFiles returns the export file, or the files of an export directory sorted by name.
+func exportFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, wrapError(err, "failed to open asset export")
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, wrapError(err, "failed to read asset export directory")
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		paths = append(paths, filepath.Join(path, entry.Name()))
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func readExportFile(path string) ([]*exportedAsset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, wrapError(err, "failed to open asset export file")
+	}
+	defer f.Close()
+
+	var assets []*exportedAsset
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		asset := &exportedAsset{}
+		if err := json.Unmarshal([]byte(line), asset); err != nil {
+			return nil, wrapError(err, "failed to parse asset export line of "+path)
+		}
+
+		assets = append(assets, asset)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, wrapError(err, "failed to read asset export file "+path)
+	}
+
+	return assets, nil
+}
+
+// addExportedResource records a project or a dataset from its RESOURCE content. The data of a dataset is the
+// BigQuery API representation, with its access list.
+func (x *assetIndex) addExportedResource(asset *exportedAsset) error {
+	switch asset.assetType() {
+	case projectAssetType:
+		data := &exportedProject{}
+		if err := json.Unmarshal(asset.Resource.Data, data); err != nil {
+			return err
+		}
+		x.addProject(data.project(asset))
+	case datasetAssetType:
+		projectID, datasetID := parseResourceName(assetResourceName(asset.Name))
+		if projectID == "" || datasetID == "" {
+			return nil
+		}
+
+		dataset := x.dataset(projectID, datasetID)
+		if err := json.Unmarshal(asset.Resource.Data, dataset); err != nil {
+			return err
+		}
+		if dataset.Location == "" {
+			dataset.Location = asset.Resource.Location
+		}
+		if len(dataset.Access) > 0 {
+			x.resourceAccess[datasetResourceID(projectID, datasetID)] = struct{}{}
+		}
+		for _, ancestor := range asset.Ancestors {
+			if strings.HasPrefix(ancestor, "projects/") {
+				x.projectIDs[strings.TrimPrefix(ancestor, "projects/")] = projectID
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *exportedProject) project(asset *exportedAsset) *resourcemanagerpb.Project {
+	project := &resourcemanagerpb.Project{
+		Name:        p.Name,
+		ProjectId:   p.ProjectID,
+		DisplayName: p.DisplayName,
+		Labels:      p.Labels,
+		CreateTime:  assetTimestamp(p.CreateTime),
+		UpdateTime:  assetTimestamp(p.UpdateTime),
+	}
+
+	// The v1 representation names the project by its display name, the v3 one by projects/NUMBER.
+	if !strings.HasPrefix(p.Name, "projects/") {
+		project.DisplayName = p.Name
+		project.Name = assetResourceName(asset.Name)
+		if p.ProjectNumber != "" {
+			project.Name = "projects/" + p.ProjectNumber
+		}
+	}
+
+	state := p.State
+	if state == "" {
+		state = p.LifecycleState
+	}
+	project.State = resourcemanagerpb.Project_State(resourcemanagerpb.Project_State_value[state])
+
+	var parent string
+	if err := json.Unmarshal(p.Parent, &parent); err == nil {
+		project.Parent = parent
+	} else {
+		var v1Parent struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		if err := json.Unmarshal(p.Parent, &v1Parent); err == nil && v1Parent.ID != "" {
+			project.Parent = v1Parent.Type + "s/" + v1Parent.ID
+		}
+	}
+	if project.Parent == "" && len(asset.Ancestors) > 1 {
+		project.Parent = asset.Ancestors[1]
+	}
+
+	return project
+}
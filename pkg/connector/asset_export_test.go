@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+)
+
+const assetResourceFixture = `{"name":"//cloudresourcemanager.googleapis.com/projects/123","asset_type":"cloudresourcemanager.googleapis.com/Project","resource":{"version":"v1","parent":"//cloudresourcemanager.googleapis.com/organizations/456","data":{"projectNumber":"123","projectId":"demo-project","lifecycleState":"ACTIVE","name":"Demo","parent":{"type":"organization","id":"456"}}},"ancestors":["projects/123","organizations/456"]}
+{"name":"//bigquery.googleapis.com/projects/demo-project/datasets/sales","asset_type":"bigquery.googleapis.com/Dataset","resource":{"version":"v2","location":"EU","data":{"datasetReference":{"projectId":"demo-project","datasetId":"sales"},"location":"EU","access":[{"role":"OWNER","userByEmail":"alice@example.com"},{"role":"READER","specialGroup":"projectReaders"},{"view":{"projectId":"demo-project","datasetId":"reporting","tableId":"orders_view"}}]}},"ancestors":["projects/123","organizations/456"]}
+{"name":"//bigquery.googleapis.com/projects/demo-project/datasets/staging","asset_type":"bigquery.googleapis.com/Dataset","resource":{"version":"v2","location":"US","data":{"datasetReference":{"projectId":"demo-project","datasetId":"staging"}}},"ancestors":["projects/123","organizations/456"]}
+`
+
+const assetPolicyFixture = `{"name":"//cloudresourcemanager.googleapis.com/projects/123","asset_type":"cloudresourcemanager.googleapis.com/Project","iam_policy":{"version":1,"bindings":[{"role":"roles/viewer","members":["user:bob@example.com"]},{"role":"roles/bigquery.admin","members":["serviceAccount:etl@demo-project.iam.gserviceaccount.com"]}]},"ancestors":["projects/123","organizations/456"]}
+{"name":"//bigquery.googleapis.com/projects/demo-project/datasets/sales","asset_type":"bigquery.googleapis.com/Dataset","iam_policy":{"bindings":[{"role":"roles/bigquery.dataOwner","members":["user:alice@example.com"]}]},"ancestors":["projects/123","organizations/456"]}
+{"name":"//bigquery.googleapis.com/projects/demo-project/datasets/staging","asset_type":"bigquery.googleapis.com/Dataset","iam_policy":{"bindings":[{"role":"roles/bigquery.dataEditor","members":["serviceAccount:etl@demo-project.iam.gserviceaccount.com"]}]},"ancestors":["projects/123","organizations/456"]}
+`
+
+func TestOfflineSyncFromAssetExport(t *testing.T) {
+	dir := t.TempDir()
+	// Policies sort before resources, the dataset access lists of the resources still take precedence.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "iam_policy.json"), []byte(assetPolicyFixture), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "resource.json"), []byte(assetResourceFixture), 0600))
+
+	c, err := New(ctxTest, &Config{Backend: FileBackend, AssetExportPath: dir})
+	require.NoError(t, err)
+
+	_, err = c.Validate(ctxTest)
+	require.NoError(t, err)
+
+	syncers := c.ResourceSyncers(ctxTest)
+	require.Len(t, syncers, 4)
+	resources := make(map[string][]*v2.Resource)
+	for _, syncer := range syncers {
+		_, isProvisioner := syncer.(interface {
+			Grant(context.Context, *v2.Resource, *v2.Entitlement) (annotations.Annotations, error)
+		})
+		require.False(t, isProvisioner, "offline %s syncer must not provision", syncer.ResourceType(ctxTest).Id)
+
+		pageToken := ""
+		for {
+			list, next, _, err := syncer.List(ctxTest, nil, &pagination.Token{Token: pageToken})
+			require.NoError(t, err)
+			resources[syncer.ResourceType(ctxTest).Id] = append(resources[syncer.ResourceType(ctxTest).Id], list...)
+			if next == "" {
+				break
+			}
+			pageToken = next
+		}
+	}
+
+	require.Len(t, resources[projectResourceType.Id], 1)
+	project := resources[projectResourceType.Id][0]
+	require.Equal(t, "demo-project", project.GetId().GetResource())
+	require.Equal(t, "Demo", project.GetDisplayName())
+	// Organizations are not synced offline, the parent is only kept in the profile.
+	require.Nil(t, project.GetParentResourceId())
+	require.Equal(t, "organizations/456", project.GetProfile().GetFields()["parent"].GetStringValue())
+
+	datasets := resources[datasetResourceType.Id]
+	require.Len(t, datasets, 2)
+	require.Equal(t, "demo-project:sales", datasets[0].GetId().GetResource())
+
+	roles := resources[roleResourceType.Id]
+	require.Len(t, roles, 2)
+
+	users := make(map[string]bool)
+	for _, u := range resources[userResourceType.Id] {
+		users[u.GetId().GetResource()] = true
+	}
+	require.Equal(t, map[string]bool{
+		"alice@example.com":                        true,
+		"bob@example.com":                          true,
+		"etl@demo-project.iam.gserviceaccount.com": true,
+	}, users)
+
+	// The sales access list comes from the dataset metadata, with its special group and authorized view.
+	grants, _, _, err := syncers[2].Grants(ctxTest, datasets[0], &pagination.Token{})
+	require.NoError(t, err)
+	entitlements := make(map[string]string)
+	for _, g := range grants {
+		entitlements[g.GetPrincipal().GetId().GetResource()] = g.GetEntitlement().GetId()
+	}
+	require.Equal(t, map[string]string{
+		"alice@example.com":                  "dataset:demo-project:sales:roles/bigquery.dataOwner",
+		"bob@example.com":                    "dataset:demo-project:sales:roles/bigquery.dataViewer",
+		"demo-project:reporting.orders_view": "dataset:demo-project:sales:authorized_view",
+	}, entitlements)
+
+	// The staging access list comes from its IAM policy.
+	grants, _, _, err = syncers[2].Grants(ctxTest, datasets[1], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, "etl@demo-project.iam.gserviceaccount.com", grants[0].GetPrincipal().GetId().GetResource())
+
+	grants, _, _, err = syncers[3].Grants(ctxTest, project, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 2)
+
+	md, err := c.Metadata(ctxTest)
+	require.NoError(t, err)
+	require.Equal(t, dir, md.GetProfile().GetFields()["scope"].GetStringValue())
+	require.NotContains(t, md.GetProfile().GetFields(), "project_count")
+}
@@ -0,0 +1,568 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	cloudasset "google.golang.org/api/cloudasset/v1"
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// DirectBackend reads IAM policies and dataset access lists with one API call per project and dataset.
+	DirectBackend = "direct"
+	// AssetBackend reads them in bulk from Cloud Asset Inventory, scoped to an organization or folder.
+	AssetBackend = "asset"
+	// FileBackend reads them, together with the projects and datasets, from a Cloud Asset Inventory export without
+	// calling GCP.
+	FileBackend = "file"
+
+	projectAssetType = "cloudresourcemanager.googleapis.com/Project"
+	datasetAssetType = "bigquery.googleapis.com/Dataset"
+
+	// projectsPageSize is the number of projects a List call of the project, role, user and dataset builders covers.
+	projectsPageSize = 50
+	// datasetsPageSize is the number of datasets of a project a dataset List call covers.
+	datasetsPageSize = 50
+)
+
+// policyBackend returns the IAM policies and dataset access lists that users, roles and dataset grants are built from.
+type policyBackend interface {
+	// Projects returns the projects to sync.
+	Projects(ctx context.Context) ([]*resourcemanagerpb.Project, error)
+	// ProjectsPage returns a page of the projects to sync and the token of the next page, empty after the last one.
+	ProjectsPage(ctx context.Context, pageToken string) ([]*resourcemanagerpb.Project, string, error)
+	// ProjectPolicy returns the IAM policy of a project, nil when the backend has none.
+	ProjectPolicy(ctx context.Context, projectID string) (*iampb.Policy, error)
+	// Datasets returns the IDs of the datasets of a project.
+	Datasets(ctx context.Context, projectID string) ([]string, error)
+	// DatasetsPage returns a page of the IDs of the datasets of a project and the token of the next page, empty after
+	// the last one.
+	DatasetsPage(ctx context.Context, projectID string, pageToken string) ([]string, string, error)
+	// Dataset returns the metadata of a dataset, with its version 3 access list, nil when the backend has none.
+	Dataset(ctx context.Context, projectID string, datasetID string) (*bigqueryapi.Dataset, error)
+}
+
+// newPolicyBackend returns the backend selected by the configuration.
+func newPolicyBackend(cfg *Config, direct *directBackend, assetService *cloudasset.Service) (policyBackend, error) {
+	switch cfg.Backend {
+	case "", DirectBackend:
+		return direct, nil
+	case AssetBackend:
+		if !strings.HasPrefix(cfg.AssetScope, "organizations/") && !strings.HasPrefix(cfg.AssetScope, "folders/") {
+			return nil, fmt.Errorf("google-big-query-connector: the asset backend requires an organizations/ID or folders/ID scope, got %q", cfg.AssetScope)
+		}
+		return newAssetBackend(assetService, cfg.AssetScope), nil
+	case FileBackend:
+		if cfg.AssetExportPath == "" {
+			return nil, fmt.Errorf("google-big-query-connector: the file backend requires the path of a Cloud Asset Inventory export")
+		}
+		return newFileBackend(cfg.AssetExportPath), nil
+	default:
+		return nil, fmt.Errorf("google-big-query-connector: unknown backend %q, expected %s, %s or %s", cfg.Backend, DirectBackend, AssetBackend, FileBackend)
+	}
+}
+
+type directBackend struct {
+	projectsClient  *resourcemanager.ProjectsClient
+	bigQueryClient  *bigquery.Client
+	bigQueryService *bigqueryapi.Service
+}
+
+func newDirectBackend(projectsClient *resourcemanager.ProjectsClient, bigQueryClient *bigquery.Client, bigQueryService *bigqueryapi.Service) *directBackend {
+	return &directBackend{
+		projectsClient:  projectsClient,
+		bigQueryClient:  bigQueryClient,
+		bigQueryService: bigQueryService,
+	}
+}
+
+func (b *directBackend) Projects(ctx context.Context) ([]*resourcemanagerpb.Project, error) {
+	var projects []*resourcemanagerpb.Project
+	it := b.projectsClient.SearchProjects(ctx, &resourcemanagerpb.SearchProjectsRequest{})
+	for {
+		project, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, project)
+	}
+
+	return projects, nil
+}
+
+func (b *directBackend) ProjectsPage(ctx context.Context, pageToken string) ([]*resourcemanagerpb.Project, string, error) {
+	var projects []*resourcemanagerpb.Project
+	it := b.projectsClient.SearchProjects(ctx, &resourcemanagerpb.SearchProjectsRequest{})
+	nextPageToken, err := iterator.NewPager(it, projectsPageSize, pageToken).NextPage(&projects)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return projects, nextPageToken, nil
+}
+
+func (b *directBackend) ProjectPolicy(ctx context.Context, projectID string) (*iampb.Policy, error) {
+	return b.projectsClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: fmt.Sprintf("projects/%s", projectID),
+	})
+}
+
+func (b *directBackend) Datasets(ctx context.Context, projectID string) ([]string, error) {
+	var datasetIDs []string
+	it := b.bigQueryClient.Datasets(ctx)
+	it.ProjectID = projectID
+	for {
+		dataset, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		datasetIDs = append(datasetIDs, dataset.DatasetID)
+	}
+
+	return datasetIDs, nil
+}
+
+func (b *directBackend) DatasetsPage(ctx context.Context, projectID string, pageToken string) ([]string, string, error) {
+	var datasets []*bigquery.Dataset
+	it := b.bigQueryClient.Datasets(ctx)
+	it.ProjectID = projectID
+	nextPageToken, err := iterator.NewPager(it, datasetsPageSize, pageToken).NextPage(&datasets)
+	if err != nil {
+		return nil, "", err
+	}
+
+	datasetIDs := make([]string, 0, len(datasets))
+	for _, dataset := range datasets {
+		datasetIDs = append(datasetIDs, dataset.DatasetID)
+	}
+
+	return datasetIDs, nextPageToken, nil
+}
+
+func (b *directBackend) Dataset(ctx context.Context, projectID string, datasetID string) (*bigqueryapi.Dataset, error) {
+	return b.bigQueryService.Datasets.Get(projectID, datasetID).
+		AccessPolicyVersion(datasetAccessPolicyVersion).
+		Context(ctx).
+		Do()
+}
+
+// assetBackend searches every project and dataset IAM policy and every dataset of its scope once per sync, on first
+// use, and answers from the resulting index.
+type assetBackend struct {
+	service *cloudasset.Service
+	scope   string
+
+	mtx    sync.Mutex
+	loaded bool
+	index  *assetIndex
+}
+
+func newAssetBackend(service *cloudasset.Service, scope string) *assetBackend {
+	return &assetBackend{
+		service: service,
+		scope:   scope,
+	}
+}
+
+func (b *assetBackend) Projects(ctx context.Context) ([]*resourcemanagerpb.Project, error) {
+	index, err := b.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return index.projects, nil
+}
+
+func (b *assetBackend) ProjectsPage(ctx context.Context, pageToken string) ([]*resourcemanagerpb.Project, string, error) {
+	index, err := b.load(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return offsetPage(index.projects, pageToken, projectsPageSize)
+}
+
+func (b *assetBackend) ProjectPolicy(ctx context.Context, projectID string) (*iampb.Policy, error) {
+	index, err := b.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return index.projectPolicy(projectID), nil
+}
+
+func (b *assetBackend) Datasets(ctx context.Context, projectID string) ([]string, error) {
+	index, err := b.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return index.datasetIDs[projectID], nil
+}
+
+func (b *assetBackend) DatasetsPage(ctx context.Context, projectID string, pageToken string) ([]string, string, error) {
+	index, err := b.load(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return offsetPage(index.datasetIDs[projectID], pageToken, datasetsPageSize)
+}
+
+func (b *assetBackend) Dataset(ctx context.Context, projectID string, datasetID string) (*bigqueryapi.Dataset, error) {
+	index, err := b.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return index.datasets[datasetResourceID(projectID, datasetID)], nil
+}
+
+// reset drops the index of the previous sync, the next call searches the scope again.
+func (b *assetBackend) reset() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.loaded = false
+	b.index = nil
+}
+
+// load runs the searches the first time it is called in a sync. A failed search is retried on the next call.
+func (b *assetBackend) load(ctx context.Context) (*assetIndex, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.loaded {
+		return b.index, nil
+	}
+
+	index := newAssetIndex()
+	err := b.service.V1.SearchAllResources(b.scope).
+		AssetTypes(projectAssetType, datasetAssetType).
+		Pages(ctx, func(resp *cloudasset.SearchAllResourcesResponse) error {
+			for _, result := range resp.Results {
+				index.addResource(result)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, wrapError(err, "failed to search resources of "+b.scope)
+	}
+
+	err = b.service.V1.SearchAllIamPolicies(b.scope).
+		AssetTypes(projectAssetType, datasetAssetType).
+		Pages(ctx, func(resp *cloudasset.SearchAllIamPoliciesResponse) error {
+			for _, result := range resp.Results {
+				index.addPolicy(result)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, wrapError(err, "failed to search IAM policies of "+b.scope)
+	}
+
+	b.index = index
+	b.loaded = true
+	return index, nil
+}
+
+// assetIndex holds the project policies and datasets read from Cloud Asset Inventory.
+// Project policies are keyed by the project segment of the asset name, which can be a number or an ID.
+type assetIndex struct {
+	projects        []*resourcemanagerpb.Project
+	projectIDs      map[string]string
+	projectPolicies map[string]*iampb.Policy
+	datasetIDs      map[string][]string
+	datasets        map[string]*bigqueryapi.Dataset
+	// resourceAccess holds the datasets whose access list came with their metadata, it takes precedence over
+	// their IAM policy.
+	resourceAccess map[string]struct{}
+}
+
+func newAssetIndex() *assetIndex {
+	return &assetIndex{
+		projectIDs:      make(map[string]string),
+		projectPolicies: make(map[string]*iampb.Policy),
+		datasetIDs:      make(map[string][]string),
+		datasets:        make(map[string]*bigqueryapi.Dataset),
+		resourceAccess:  make(map[string]struct{}),
+	}
+}
+
+// addProject records a project, its name holds the project number.
+func (x *assetIndex) addProject(project *resourcemanagerpb.Project) {
+	if project.GetProjectId() == "" {
+		return
+	}
+
+	x.projects = append(x.projects, project)
+	x.projectIDs[strings.TrimPrefix(project.GetName(), "projects/")] = project.GetProjectId()
+}
+
+// addResource records a project or a dataset. Both carry the project number, which maps the number to the ID.
+func (x *assetIndex) addResource(result *cloudasset.ResourceSearchResult) {
+	switch result.AssetType {
+	case projectAssetType:
+		var attributes struct {
+			ProjectID string `json:"projectId"`
+		}
+		if err := json.Unmarshal(result.AdditionalAttributes, &attributes); err != nil {
+			return
+		}
+
+		project := &resourcemanagerpb.Project{
+			Name:        result.Project,
+			ProjectId:   attributes.ProjectID,
+			DisplayName: result.DisplayName,
+			Parent:      assetResourceName(result.ParentFullResourceName),
+			State:       resourcemanagerpb.Project_State(resourcemanagerpb.Project_State_value[result.State]),
+			Labels:      result.Labels,
+			CreateTime:  assetTimestamp(result.CreateTime),
+			UpdateTime:  assetTimestamp(result.UpdateTime),
+		}
+		if project.Name == "" {
+			project.Name = assetResourceName(result.Name)
+		}
+		x.addProject(project)
+	case datasetAssetType:
+		projectID, datasetID := parseResourceName(assetResourceName(result.Name))
+		if projectID == "" || datasetID == "" {
+			return
+		}
+		x.projectIDs[strings.TrimPrefix(result.Project, "projects/")] = projectID
+
+		dataset := x.dataset(projectID, datasetID)
+		dataset.Location = result.Location
+		dataset.Description = result.Description
+		dataset.Labels = result.Labels
+		dataset.CreationTime = assetTimeMillis(result.CreateTime)
+		dataset.LastModifiedTime = assetTimeMillis(result.UpdateTime)
+		if result.KmsKey != "" {
+			dataset.DefaultEncryptionConfiguration = &bigqueryapi.EncryptionConfiguration{KmsKeyName: result.KmsKey}
+		}
+	}
+}
+
+// addPolicy records the IAM policy of a project, or the access list of a dataset.
+func (x *assetIndex) addPolicy(result *cloudasset.IamPolicySearchResult) {
+	if result.Policy == nil {
+		return
+	}
+
+	switch result.AssetType {
+	case projectAssetType:
+		projectID, _ := parseResourceName(assetResourceName(result.Resource))
+		if projectID == "" {
+			return
+		}
+		x.projectPolicies[projectID] = iamPolicyFromAsset(result.Policy)
+	case datasetAssetType:
+		projectID, datasetID := parseResourceName(assetResourceName(result.Resource))
+		if projectID == "" || datasetID == "" {
+			return
+		}
+		if _, ok := x.resourceAccess[datasetResourceID(projectID, datasetID)]; ok {
+			return
+		}
+
+		dataset := x.dataset(projectID, datasetID)
+		for _, binding := range result.Policy.Bindings {
+			for _, member := range binding.Members {
+				access := datasetAccessFromMember(member)
+				access.Role = binding.Role
+				if binding.Condition != nil {
+					access.Condition = &bigqueryapi.Expr{
+						Title:       binding.Condition.Title,
+						Description: binding.Condition.Description,
+						Expression:  binding.Condition.Expression,
+					}
+				}
+				dataset.Access = append(dataset.Access, access)
+			}
+		}
+	}
+}
+
+// dataset returns the indexed dataset, adding it when the search has not returned it yet.
+func (x *assetIndex) dataset(projectID string, datasetID string) *bigqueryapi.Dataset {
+	id := datasetResourceID(projectID, datasetID)
+	if dataset, ok := x.datasets[id]; ok {
+		return dataset
+	}
+
+	dataset := &bigqueryapi.Dataset{
+		Id: fmt.Sprintf("%s:%s", projectID, datasetID),
+		DatasetReference: &bigqueryapi.DatasetReference{
+			ProjectId: projectID,
+			DatasetId: datasetID,
+		},
+	}
+	x.datasets[id] = dataset
+	x.datasetIDs[projectID] = append(x.datasetIDs[projectID], datasetID)
+	return dataset
+}
+
+func (x *assetIndex) projectPolicy(projectID string) *iampb.Policy {
+	if policy, ok := x.projectPolicies[projectID]; ok {
+		return policy
+	}
+
+	for number, id := range x.projectIDs {
+		if id == projectID {
+			return x.projectPolicies[number]
+		}
+	}
+
+	return nil
+}
+
+// assetResourceName strips the service from a full resource name, //bigquery.googleapis.com/projects/P/datasets/D
+// becomes projects/P/datasets/D.
+func assetResourceName(name string) string {
+	if !strings.HasPrefix(name, "//") {
+		return name
+	}
+
+	_, rest, _ := strings.Cut(strings.TrimPrefix(name, "//"), "/")
+	return rest
+}
+
+func assetTimeMillis(value string) int64 {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0
+	}
+
+	return t.UnixMilli()
+}
+
+func assetTimestamp(value string) *timestamppb.Timestamp {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+func iamPolicyFromAsset(policy *cloudasset.Policy) *iampb.Policy {
+	if policy == nil {
+		return nil
+	}
+
+	rv := &iampb.Policy{
+		Version: int32(policy.Version),
+	}
+	for _, binding := range policy.Bindings {
+		b := &iampb.Binding{
+			Role:    binding.Role,
+			Members: binding.Members,
+		}
+		if binding.Condition != nil {
+			b.Condition = &expr.Expr{
+				Title:       binding.Condition.Title,
+				Description: binding.Condition.Description,
+				Expression:  binding.Condition.Expression,
+			}
+		}
+		rv.Bindings = append(rv.Bindings, b)
+	}
+
+	return rv
+}
+
+// datasetAccessFromMember converts a member of a dataset IAM policy to the access entry the BigQuery API reports
+// for it. Dataset policies name special groups after the basic project roles.
+func datasetAccessFromMember(member string) *bigqueryapi.DatasetAccess {
+	kind, value, _ := strings.Cut(member, ":")
+	switch kind {
+	case user:
+		return &bigqueryapi.DatasetAccess{UserByEmail: value}
+	case "group":
+		return &bigqueryapi.DatasetAccess{GroupByEmail: value}
+	case "domain":
+		return &bigqueryapi.DatasetAccess{Domain: value}
+	case "projectOwner":
+		return &bigqueryapi.DatasetAccess{SpecialGroup: "projectOwners"}
+	case "projectEditor":
+		return &bigqueryapi.DatasetAccess{SpecialGroup: "projectWriters"}
+	case "projectViewer":
+		return &bigqueryapi.DatasetAccess{SpecialGroup: "projectReaders"}
+	case "allAuthenticatedUsers":
+		return &bigqueryapi.DatasetAccess{SpecialGroup: "allAuthenticatedUsers"}
+	default:
+		return &bigqueryapi.DatasetAccess{IamMember: member}
+	}
+}
+
+// offsetPage returns the page of items starting at the offset held by the page token, and the token of the next page.
+// It pages the lists the asset and file backends hold in memory.
+func offsetPage[T any](items []T, pageToken string, pageSize int) ([]T, string, error) {
+	offset := 0
+	if pageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(pageToken)
+		if err != nil || offset < 0 {
+			return nil, "", fmt.Errorf("google-big-query-connector: invalid page token %q", pageToken)
+		}
+	}
+	if offset >= len(items) {
+		return nil, "", nil
+	}
+
+	end := min(offset+pageSize, len(items))
+	if end == len(items) {
+		return items[offset:end], "", nil
+	}
+
+	return items[offset:end], strconv.Itoa(end), nil
+}
+
+// listProjectsPage returns the page of projects a List call covers, the first one without a page token, and the bag
+// pointing at the next page.
+func listProjectsPage(ctx context.Context, backend policyBackend, pToken *pagination.Token) ([]*resourcemanagerpb.Project, *pagination.Bag, error) {
+	bag := &pagination.Bag{}
+	if err := bag.Unmarshal(pToken.Token); err != nil {
+		return nil, nil, err
+	}
+
+	if bag.Current() == nil {
+		bag.Push(pagination.PageState{
+			ResourceTypeID: projectResourceType.Id,
+		})
+	}
+
+	projects, nextPageToken, err := backend.ProjectsPage(ctx, bag.PageToken())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := bag.Next(nextPageToken); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
+	}
+
+	return projects, bag, nil
+}
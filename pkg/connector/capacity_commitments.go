@@ -0,0 +1,107 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	reservation "cloud.google.com/go/bigquery/reservation/apiv1"
+	"cloud.google.com/go/bigquery/reservation/apiv1/reservationpb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/api/iterator"
+)
+
+type capacityCommitmentBuilder struct {
+	resourceType      *v2.ResourceType
+	reservationClient *reservation.Client
+	locations         []string
+}
+
+func (o *capacityCommitmentBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return capacityCommitmentResourceType
+}
+
+// List returns the capacity commitments purchased by the parent project in every configured location.
+func (o *capacityCommitmentBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != projectResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	for _, location := range o.locations {
+		it := o.reservationClient.ListCapacityCommitments(ctx, &reservationpb.ListCapacityCommitmentsRequest{
+			Parent: fmt.Sprintf("projects/%s/locations/%s", parentResourceID.GetResource(), strings.ToLower(location)),
+		})
+		for {
+			commitment, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				if !isPermissionDenied(ctx, err) {
+					return nil, "", nil, wrapError(err, "Unable to fetch capacity commitments")
+				}
+				break
+			}
+
+			resource, err := capacityCommitmentResource(commitment, parentResourceID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "Unable to create capacity commitment resource")
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements is empty, capacity commitments have no IAM policy of their own: they are governed by the project.
+func (o *capacityCommitmentBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *capacityCommitmentBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func capacityCommitmentResource(commitment *reservationpb.CapacityCommitment, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	name := commitment.GetName()
+	commitmentID := name[strings.LastIndex(name, "/")+1:]
+	profile := map[string]interface{}{
+		"name":          name,
+		"commitment_id": commitmentID,
+		"slot_count":    commitment.GetSlotCount(),
+		"plan":          commitment.GetPlan().String(),
+		"renewal_plan":  commitment.GetRenewalPlan().String(),
+		"state":         commitment.GetState().String(),
+		"edition":       commitment.GetEdition().String(),
+	}
+	if commitment.GetCommitmentStartTime() != nil {
+		profile["commitment_start_time"] = commitment.GetCommitmentStartTime().AsTime().UTC().Format(time.RFC3339)
+	}
+	if commitment.GetCommitmentEndTime() != nil {
+		profile["commitment_end_time"] = commitment.GetCommitmentEndTime().AsTime().UTC().Format(time.RFC3339)
+	}
+
+	return rs.NewResource(
+		fmt.Sprintf("%s (%d slots)", commitmentID, commitment.GetSlotCount()),
+		capacityCommitmentResourceType,
+		name,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newCapacityCommitmentBuilder(reservationClient *reservation.Client, locations []string) *capacityCommitmentBuilder {
+	return &capacityCommitmentBuilder{
+		resourceType:      capacityCommitmentResourceType,
+		reservationClient: reservationClient,
+		locations:         locations,
+	}
+}
@@ -0,0 +1,37 @@
+package connector
+
+import "time"
+
+// Config holds the settings used to build the connector.
+type Config struct {
+	// CredentialsJSONFilePath is the path to the service account key used to authenticate.
+	CredentialsJSONFilePath string
+	// AuditLogParent is the resource name (projects/ID, folders/ID or organizations/ID) whose
+	// Cloud Audit Logs feed the event stream. Defaults to the credentials project.
+	AuditLogParent string
+	// AuditLogFilePath points to a JSON-lines file of exported log entries that is read instead of Cloud Logging.
+	AuditLogFilePath string
+	// UsageEnrichment turns on the INFORMATION_SCHEMA.JOBS_BY_PROJECT lookup that annotates users and dataset grants.
+	UsageEnrichment bool
+	// UsageWindowDays is how many days of query jobs the usage enrichment looks at.
+	UsageWindowDays int
+	// Locations are the BigQuery locations (regions or multi-regions) queried for location-bound data.
+	Locations []string
+	// DirectorySubject is the Workspace user impersonated through domain-wide delegation to read the
+	// Admin SDK Directory. Directory enrichment of users is off when it is empty.
+	DirectorySubject string
+	// Backend selects how IAM policies and dataset access lists are read: "direct" (the default) calls the APIs
+	// once per project and dataset, "asset" searches them in bulk through Cloud Asset Inventory and "file" reads
+	// a Cloud Asset Inventory export, without calling GCP.
+	Backend string
+	// AssetScope is the organization (organizations/ID) or folder (folders/ID) searched by the asset backend.
+	AssetScope string
+	// AssetExportPath is the Cloud Asset Inventory export, a file or a directory of files, read by the file backend.
+	AssetExportPath string
+	// AccessTokenLifetime is the longest lifetime of the access tokens issued for service accounts, one hour
+	// when unset.
+	AccessTokenLifetime time.Duration
+	// AccessTokenScopes are the OAuth scopes of the access tokens issued for service accounts, BigQuery only
+	// when unset.
+	AccessTokenScopes []string
+}
@@ -0,0 +1,206 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	connection "cloud.google.com/go/bigquery/connection/apiv1"
+	"cloud.google.com/go/bigquery/connection/apiv1/connectionpb"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	// connectionRoles are the IAM roles that can be granted on a connection.
+	connectionRoles = []string{
+		"roles/bigquery.connectionAdmin",
+		"roles/bigquery.connectionUser",
+	}
+	connectionRoleVerbs = map[string]string{
+		"roles/bigquery.connectionAdmin": "Administers",
+		"roles/bigquery.connectionUser":  "Can query external data through",
+	}
+)
+
+type connectionBuilder struct {
+	resourceType     *v2.ResourceType
+	connectionClient *connection.Client
+	locations        []string
+}
+
+func (o *connectionBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return connectionResourceType
+}
+
+// List returns the connections of the parent project in every configured location.
+func (o *connectionBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != projectResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	for _, location := range o.locations {
+		it := o.connectionClient.ListConnections(ctx, &connectionpb.ListConnectionsRequest{
+			Parent:   fmt.Sprintf("projects/%s/locations/%s", parentResourceID.GetResource(), strings.ToLower(location)),
+			PageSize: 100,
+		})
+		for {
+			conn, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				if !isPermissionDenied(ctx, err) {
+					return nil, "", nil, wrapError(err, "Unable to fetch connections")
+				}
+				break
+			}
+
+			resource, err := connectionResource(conn, parentResourceID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "Unable to create connection resource")
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *connectionBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+	for _, role := range connectionRoles {
+		assigmentOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("%s %s connection", connectionRoleVerbs[role], resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s connection %s", resource.DisplayName, role)),
+		}
+		rv = append(rv, ent.NewPermissionEntitlement(resource, role, assigmentOptions...))
+	}
+
+	return rv, "", nil, nil
+}
+
+func (o *connectionBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var grants []*v2.Grant
+	l := ctxzap.Extract(ctx)
+	policy, err := o.connectionClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: resource.Id.Resource,
+	})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "failed to get IAM policy of connection "+resource.Id.Resource)
+		}
+	}
+
+	if policy == nil {
+		return grants, "", nil, nil
+	}
+
+	for _, binding := range policy.Bindings {
+		if _, ok := connectionRoleVerbs[binding.Role]; !ok {
+			continue
+		}
+
+		for _, member := range binding.Members {
+			principalID, ok := iamMemberPrincipalID(member)
+			if !ok {
+				l.Debug("Skipping connection member that is not a user", zap.String("member", member))
+				continue
+			}
+
+			grants = append(grants, grant.NewGrant(resource, binding.Role, principalID))
+		}
+	}
+
+	return grants, "", nil, nil
+}
+
+// connectionResource creates a connection resource. Its profile holds the connection type, the external system it
+// reaches and the identity BigQuery uses to reach it.
+func connectionResource(conn *connectionpb.Connection, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	name := conn.GetName()
+	connectionID := name[strings.LastIndex(name, "/")+1:]
+	profile := map[string]interface{}{
+		"name":           name,
+		"connection_id":  connectionID,
+		"has_credential": conn.GetHasCredential(),
+	}
+	if conn.GetFriendlyName() != "" {
+		profile["friendly_name"] = conn.GetFriendlyName()
+	}
+	if conn.GetDescription() != "" {
+		profile["description"] = conn.GetDescription()
+	}
+	if conn.GetCreationTime() != 0 {
+		profile["creation_time"] = time.UnixMilli(conn.GetCreationTime()).UTC().Format(time.RFC3339)
+	}
+	if conn.GetLastModifiedTime() != 0 {
+		profile["last_modified_time"] = time.UnixMilli(conn.GetLastModifiedTime()).UTC().Format(time.RFC3339)
+	}
+
+	switch {
+	case conn.GetCloudSql() != nil:
+		profile["type"] = "cloud_sql"
+		profile["service_account"] = conn.GetCloudSql().GetServiceAccountId()
+		profile["instance_id"] = conn.GetCloudSql().GetInstanceId()
+		profile["database"] = conn.GetCloudSql().GetDatabase()
+		profile["database_type"] = conn.GetCloudSql().GetType().String()
+	case conn.GetCloudSpanner() != nil:
+		profile["type"] = "cloud_spanner"
+		profile["database"] = conn.GetCloudSpanner().GetDatabase()
+		if conn.GetCloudSpanner().GetDatabaseRole() != "" {
+			profile["database_role"] = conn.GetCloudSpanner().GetDatabaseRole()
+		}
+	case conn.GetAws() != nil:
+		profile["type"] = "aws"
+		profile["service_account"] = conn.GetAws().GetAccessRole().GetIdentity()
+		profile["aws_role"] = conn.GetAws().GetAccessRole().GetIamRoleId()
+	case conn.GetAzure() != nil:
+		profile["type"] = "azure"
+		profile["service_account"] = conn.GetAzure().GetIdentity()
+		profile["azure_tenant_id"] = conn.GetAzure().GetCustomerTenantId()
+		profile["azure_client_id"] = conn.GetAzure().GetFederatedApplicationClientId()
+	case conn.GetCloudResource() != nil:
+		profile["type"] = "cloud_resource"
+		profile["service_account"] = conn.GetCloudResource().GetServiceAccountId()
+	case conn.GetSpark() != nil:
+		profile["type"] = "spark"
+		profile["service_account"] = conn.GetSpark().GetServiceAccountId()
+	default:
+		profile["type"] = "other"
+	}
+
+	displayName := conn.GetFriendlyName()
+	if displayName == "" {
+		displayName = connectionID
+	}
+
+	return rs.NewResource(
+		displayName,
+		connectionResourceType,
+		name,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newConnectionBuilder(connectionClient *connection.Client, locations []string) *connectionBuilder {
+	return &connectionBuilder{
+		resourceType:     connectionResourceType,
+		connectionClient: connectionClient,
+		locations:        locations,
+	}
+}
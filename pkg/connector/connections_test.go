@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConnectionSync(t *testing.T) {
+	fake, client := newFakeConnections(t)
+	lake := fake.addConnection("projects/demo-project/locations/us", "lake", "bqcx-123@gcp-sa-bigquery-condel.iam.gserviceaccount.com")
+	fake.addConnection("projects/demo-project/locations/eu", "archive", "bqcx-456@gcp-sa-bigquery-condel.iam.gserviceaccount.com")
+	fake.setPolicy(lake, &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/bigquery.connectionUser", Members: []string{"user:alice@example.com", "group:analysts@example.com"}},
+			{Role: "roles/bigquery.dataViewer", Members: []string{"user:bob@example.com"}},
+		},
+	})
+
+	// Connections are listed in every configured location.
+	builder := newConnectionBuilder(client, []string{"US", "EU"})
+	resources, err := listAll(builder, &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"})
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	require.Equal(t, lake, resources[0].GetId().GetResource())
+	profile := resources[0].GetProfile().GetFields()
+	require.Equal(t, "cloud_resource", profile["type"].GetStringValue())
+	require.Equal(t, "bqcx-123@gcp-sa-bigquery-condel.iam.gserviceaccount.com", profile["service_account"].GetStringValue())
+
+	// Bindings of roles that can't be granted on a connection, and groups, are left out.
+	grants, _, _, err := builder.Grants(ctxTest, resources[0], &pagination.Token{})
+	require.NoError(t, err)
+	got := make(map[string]string)
+	for _, g := range grants {
+		got[g.GetPrincipal().GetId().GetResource()] = entitlementSlug(g.GetEntitlement())
+	}
+	require.Equal(t, map[string]string{
+		"alice@example.com": "roles/bigquery.connectionUser",
+	}, got)
+}
+
+func TestConnectionListErrors(t *testing.T) {
+	fake, client := newFakeConnections(t)
+	fake.addConnection("projects/demo-project/locations/us", "lake", "bqcx-123@gcp-sa-bigquery-condel.iam.gserviceaccount.com")
+	fake.addConnection("projects/demo-project/locations/us", "warehouse", "bqcx-456@gcp-sa-bigquery-condel.iam.gserviceaccount.com")
+	builder := newConnectionBuilder(client, []string{"US"})
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"}
+
+	// A list failing after its first page fails the sync, it must not leave the next pages out.
+	fake.setListError(status.Error(codes.Internal, "backend error"), 1)
+	_, err := listAll(builder, project)
+	require.ErrorContains(t, err, "backend error")
+
+	// Without permission to list, nothing is synced and the sync goes on.
+	fake.setListError(status.Error(codes.PermissionDenied, "permission denied"), 0)
+	resources, err := listAll(builder, project)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+}
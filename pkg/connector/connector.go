@@ -2,29 +2,121 @@ package connector
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 
 	"cloud.google.com/go/bigquery"
+	analyticshub "cloud.google.com/go/bigquery/analyticshub/apiv1"
+	connection "cloud.google.com/go/bigquery/connection/apiv1"
+	datapolicies "cloud.google.com/go/bigquery/datapolicies/apiv1"
+	datatransfer "cloud.google.com/go/bigquery/datatransfer/apiv1"
+	reservation "cloud.google.com/go/bigquery/reservation/apiv1"
+	iamadmin "cloud.google.com/go/iam/admin/apiv1"
+	iamv2 "cloud.google.com/go/iam/apiv2"
+	credentials "cloud.google.com/go/iam/credentials/apiv1"
 	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	cloudasset "google.golang.org/api/cloudasset/v1"
+	logging "google.golang.org/api/logging/v2"
 	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	connectorDisplayName = "Google BigQuery"
+	connectorDescription = "Syncs projects, datasets, IAM roles, users and service accounts with access to Google BigQuery."
 )
 
 type GoogleBigQuery struct {
-	ProjectsClient *resourcemanager.ProjectsClient
-	BigQueryClient *bigquery.Client
+	ProjectsClient      *resourcemanager.ProjectsClient
+	FoldersClient       *resourcemanager.FoldersClient
+	OrganizationsClient *resourcemanager.OrganizationsClient
+	BigQueryClient      *bigquery.Client
+	BigQueryService     *bigqueryapi.Service
+	AnalyticsHubClient  *analyticshub.Client
+	ConnectionClient    *connection.Client
+	ReservationClient   *reservation.Client
+	DataPolicyClient    *datapolicies.DataPolicyClient
+	DataTransferClient  *datatransfer.Client
+	LoggingService      *logging.Service
+	PoliciesClient      *iamv2.PoliciesClient
+	IamClient           *iamadmin.IamClient
+	CredentialsClient   *credentials.IamCredentialsClient
+	config              *Config
+	usage               *usageReporter
+	directory           *directoryEnricher
+	denials             *denyEvaluator
+	backend             policyBackend
+	principal           string
 }
 
 // ResourceSyncers returns a ResourceSyncer for each resource type that should be synced from the upstream service.
+// An offline connector only syncs what a Cloud Asset Inventory export holds: projects, datasets, roles and users.
+// Without GCP clients it cannot provision, run actions or issue access tokens, and its projects have no parent since
+// folders and organizations are not synced.
 func (d *GoogleBigQuery) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
+	if d.offline() {
+		return []connectorbuilder.ResourceSyncer{
+			readOnlySyncer{newUserBuilder(nil, nil, d.backend, nil, nil, nil, nil)},
+			readOnlySyncer{newRoleBuilder(nil, nil, d.backend, nil)},
+			readOnlySyncer{newDatasetBuilder(nil, nil, nil, d.backend, nil, nil)},
+			readOnlySyncer{newProjectBuilder(nil, nil, d.backend, false)},
+		}
+	}
+
 	return []connectorbuilder.ResourceSyncer{
-		newUserBuilder(d.ProjectsClient, d.BigQueryClient),
-		newRoleBuilder(d.ProjectsClient, d.BigQueryClient),
-		newDatasetBuilder(d.BigQueryClient, d.ProjectsClient),
-		newProjectBuilder(d.ProjectsClient, d.BigQueryClient),
+		newUserBuilder(
+			d.ProjectsClient,
+			d.BigQueryClient,
+			d.backend,
+			d.IamClient,
+			d.usage,
+			d.directory,
+			newAccessTokenIssuer(d.CredentialsClient, d.config.AccessTokenLifetime, d.config.AccessTokenScopes),
+		),
+		newRoleBuilder(d.ProjectsClient, d.BigQueryClient, d.backend, d.denials),
+		newDatasetBuilder(d.BigQueryClient, d.BigQueryService, d.ProjectsClient, d.backend, d.usage, d.denials),
+		newProjectBuilder(d.ProjectsClient, d.BigQueryClient, d.backend, true),
+		newRoutineBuilder(d.BigQueryClient, d.BigQueryService),
+		newModelBuilder(d.BigQueryClient),
+		newDataExchangeBuilder(d.AnalyticsHubClient, d.config.Locations),
+		newListingBuilder(d.AnalyticsHubClient),
+		newConnectionBuilder(d.ConnectionClient, d.config.Locations),
+		newReservationBuilder(d.ReservationClient, d.config.Locations),
+		newCapacityCommitmentBuilder(d.ReservationClient, d.config.Locations),
+		newViewBuilder(d.BigQueryService),
+		newDataPolicyBuilder(d.DataPolicyClient, d.config.Locations),
+		newTransferConfigBuilder(d.DataTransferClient, d.config.Locations),
+		newDenyPolicyBuilder(d.denials),
+		newAccessTokenBuilder(),
+		newServiceAccountBuilder(d.IamClient),
+		newFolderBuilder(d.FoldersClient),
+		newOrganizationBuilder(d.OrganizationsClient),
+	}
+}
+
+// EventFeeds returns the event feeds that report access changes between full syncs.
+func (d *GoogleBigQuery) EventFeeds(ctx context.Context) []connectorbuilder.EventFeed {
+	var source auditLogSource
+	if d.config.AuditLogFilePath != "" {
+		source = newFileAuditLogSource(d.config.AuditLogFilePath)
+	} else if d.offline() {
+		return nil
+	} else {
+		parent := d.config.AuditLogParent
+		if parent == "" {
+			parent = fmt.Sprintf("projects/%s", d.BigQueryClient.Project())
+		}
+		source = newCloudLoggingSource(d.LoggingService, parent)
+	}
+
+	return []connectorbuilder.EventFeed{
+		newAuditLogFeed(source),
 	}
 }
 
@@ -35,49 +127,305 @@ func (d *GoogleBigQuery) Asset(ctx context.Context, asset *v2.AssetRef) (string,
 }
 
 // Metadata returns metadata about the connector.
+// The display name carries the credentials project and the profile describes what the connector syncs and as whom.
 func (d *GoogleBigQuery) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error) {
-	return &v2.ConnectorMetadata{
-		DisplayName: "My Baton Connector",
-		Description: "The template implementation of a baton connector",
-	}, nil
+	displayName := connectorDisplayName
+	var defaultProject string
+	if d.BigQueryClient != nil {
+		defaultProject = d.BigQueryClient.Project()
+	}
+	if defaultProject != "" {
+		displayName = fmt.Sprintf("%s (%s)", connectorDisplayName, defaultProject)
+	}
+
+	var resourceTypes []interface{}
+	for _, rs := range d.ResourceSyncers(ctx) {
+		resourceTypes = append(resourceTypes, rs.ResourceType(ctx).Id)
+	}
+
+	fields := d.scope()
+	fields["connector"] = connectorDisplayName
+	fields["principal"] = d.principal
+	fields["default_project"] = defaultProject
+	fields["resource_types"] = resourceTypes
+	profile, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &v2.ConnectorMetadata{
+		DisplayName: displayName,
+		Description: connectorDescription,
+		Profile:     profile,
+	}
+	if !d.offline() {
+		rv.AccountCreationSchema = serviceAccountCreationSchema
+	}
+
+	return rv, nil
+}
+
+// scope describes what a sync covers from the configuration: the backend, and the organization or folder searched
+// by the asset backend or the export read by the file backend. It makes no calls, so that metadata does not run a
+// search of the whole scope every time it is asked for.
+func (d *GoogleBigQuery) scope() map[string]interface{} {
+	backend := d.config.Backend
+	if backend == "" {
+		backend = DirectBackend
+	}
+
+	rv := map[string]interface{}{
+		"backend": backend,
+	}
+	switch backend {
+	case AssetBackend:
+		rv["scope"] = d.config.AssetScope
+	case FileBackend:
+		rv["scope"] = d.config.AssetExportPath
+	}
+
+	return rv
 }
 
 // Validate is called to ensure that the connector is properly configured. It should exercise any API credentials
-// to be sure that they are valid.
+// to be sure that they are valid. It runs at the start of every sync, so it also drops what the previous sync cached.
 func (d *GoogleBigQuery) Validate(ctx context.Context) (annotations.Annotations, error) {
+	d.resetCaches()
+
+	if d.offline() {
+		if _, err := d.backend.Projects(ctx); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
 	if projectId := d.BigQueryClient.Project(); projectId == "" {
 		return nil, fmt.Errorf("project id is empty")
 	}
 
-	return nil, nil
+	report, err := d.probePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report.log(ctx)
+	if len(report.MissingSync) > 0 {
+		return nil, wrapError(report, "")
+	}
+
+	reportAnnotation, err := report.annotation()
+	if err != nil {
+		return nil, err
+	}
+	var annos annotations.Annotations
+	annos.Update(reportAnnotation)
+
+	if d.directory != nil {
+		if err := d.directory.load(ctx); err != nil {
+			return nil, fmt.Errorf("%w: check the domain-wide delegation of principal %q to %s", err, d.principal, d.config.DirectorySubject)
+		}
+	}
+
+	return annos, nil
+}
+
+// resetCaches drops the lookups cached during the previous sync, the connector keeps running between syncs in
+// service mode.
+func (d *GoogleBigQuery) resetCaches() {
+	if d.usage != nil {
+		d.usage.reset()
+	}
+	if d.directory != nil {
+		d.directory.reset()
+	}
+	if d.denials != nil {
+		d.denials.reset()
+	}
+	if backend, ok := d.backend.(*assetBackend); ok {
+		backend.reset()
+	}
+}
+
+// readOnlySyncer only exposes the sync methods of a resource syncer, leaving out the provisioning and credential
+// capabilities it may implement.
+type readOnlySyncer struct {
+	connectorbuilder.ResourceSyncer
+}
+
+// offline reports whether the connector syncs from a Cloud Asset Inventory export, it has no GCP client then.
+func (d *GoogleBigQuery) offline() bool {
+	return d.config.Backend == FileBackend
 }
 
 // New returns a new instance of the connector.
-func New(ctx context.Context, credentialsJSONFilePath string) (*GoogleBigQuery, error) {
-	opt := option.WithCredentialsFile(credentialsJSONFilePath)
+func New(ctx context.Context, cfg *Config) (*GoogleBigQuery, error) {
+	if cfg.Backend == FileBackend {
+		return newOffline(cfg)
+	}
+
+	credentialsJSON, err := os.ReadFile(cfg.CredentialsJSONFilePath)
+	if err != nil {
+		return nil, wrapError(err, "unable to read credentials file")
+	}
 
-	return createClient(ctx, opt)
+	opt := option.WithCredentialsFile(cfg.CredentialsJSONFilePath)
+
+	return createClient(ctx, cfg, credentialsJSON, opt)
 }
 
-func NewFromJSONBytes(ctx context.Context, credentialsJSON []byte) (*GoogleBigQuery, error) {
+func NewFromJSONBytes(ctx context.Context, credentialsJSON []byte, cfg *Config) (*GoogleBigQuery, error) {
 	opt := option.WithCredentialsJSON(credentialsJSON)
 
-	return createClient(ctx, opt)
+	return createClient(ctx, cfg, credentialsJSON, opt)
+}
+
+// newOffline returns a connector that reads a Cloud Asset Inventory export, without credentials.
+func newOffline(cfg *Config) (*GoogleBigQuery, error) {
+	backend, err := newPolicyBackend(cfg, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GoogleBigQuery{
+		config:  cfg,
+		backend: backend,
+	}, nil
+}
+
+// credentialsPrincipal returns the identity the credentials authenticate as, if the key file names one.
+func credentialsPrincipal(credentialsJSON []byte) string {
+	var credentials struct {
+		ClientEmail string `json:"client_email"`
+		ClientID    string `json:"client_id"`
+	}
+	if err := json.Unmarshal(credentialsJSON, &credentials); err != nil {
+		return ""
+	}
+
+	if credentials.ClientEmail != "" {
+		return credentials.ClientEmail
+	}
+
+	return credentials.ClientID
 }
 
-func createClient(ctx context.Context, opts ...option.ClientOption) (*GoogleBigQuery, error) {
+func createClient(ctx context.Context, cfg *Config, credentialsJSON []byte, opts ...option.ClientOption) (*GoogleBigQuery, error) {
 	projectsClient, err := resourcemanager.NewProjectsClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	foldersClient, err := resourcemanager.NewFoldersClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	organizationsClient, err := resourcemanager.NewOrganizationsClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	bigQueryClient, err := bigquery.NewClient(ctx, bigquery.DetectProjectID, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	bigQueryService, err := bigqueryapi.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	analyticsHubClient, err := analyticshub.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	connectionClient, err := connection.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	reservationClient, err := reservation.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	dataPolicyClient, err := datapolicies.NewDataPolicyClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	dataTransferClient, err := datatransfer.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	loggingService, err := logging.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	policiesClient, err := iamv2.NewPoliciesClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	iamClient, err := iamadmin.NewIamClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialsClient, err := credentials.NewIamCredentialsClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var assetService *cloudasset.Service
+	if cfg.Backend == AssetBackend {
+		assetService, err = cloudasset.NewService(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backend, err := newPolicyBackend(cfg, newDirectBackend(projectsClient, bigQueryClient, bigQueryService), assetService)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage *usageReporter
+	if cfg.UsageEnrichment {
+		usage = newUsageReporter(bigQueryClient, cfg.Locations, cfg.UsageWindowDays)
+	}
+
+	var directory *directoryEnricher
+	if cfg.DirectorySubject != "" {
+		directory, err = newDirectoryEnricher(ctx, credentialsJSON, cfg.DirectorySubject)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &GoogleBigQuery{
-		ProjectsClient: projectsClient,
-		BigQueryClient: bigQueryClient,
+		ProjectsClient:      projectsClient,
+		FoldersClient:       foldersClient,
+		OrganizationsClient: organizationsClient,
+		BigQueryClient:      bigQueryClient,
+		BigQueryService:     bigQueryService,
+		AnalyticsHubClient:  analyticsHubClient,
+		ConnectionClient:    connectionClient,
+		ReservationClient:   reservationClient,
+		DataPolicyClient:    dataPolicyClient,
+		DataTransferClient:  dataTransferClient,
+		LoggingService:      loggingService,
+		PoliciesClient:      policiesClient,
+		IamClient:           iamClient,
+		CredentialsClient:   credentialsClient,
+		config:              cfg,
+		usage:               usage,
+		directory:           directory,
+		denials:             newDenyEvaluator(policiesClient, iamClient, projectsClient, foldersClient),
+		backend:             backend,
+		principal:           credentialsPrincipal(credentialsJSON),
 	}, nil
 }
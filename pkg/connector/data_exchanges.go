@@ -0,0 +1,175 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	analyticshub "cloud.google.com/go/bigquery/analyticshub/apiv1"
+	"cloud.google.com/go/bigquery/analyticshub/apiv1/analyticshubpb"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	// analyticsHubRoles are the Analytics Hub IAM roles synced as entitlements of exchanges and listings.
+	analyticsHubRoles = []string{
+		"roles/analyticshub.admin",
+		"roles/analyticshub.listingAdmin",
+		"roles/analyticshub.publisher",
+		"roles/analyticshub.subscriber",
+		"roles/analyticshub.viewer",
+	}
+	analyticsHubRoleVerbs = map[string]string{
+		"roles/analyticshub.admin":        "Administers",
+		"roles/analyticshub.listingAdmin": "Administers listings of",
+		"roles/analyticshub.publisher":    "Publishes to",
+		"roles/analyticshub.subscriber":   "Subscribes to",
+		"roles/analyticshub.viewer":       "Views",
+	}
+)
+
+type dataExchangeBuilder struct {
+	resourceType       *v2.ResourceType
+	analyticsHubClient *analyticshub.Client
+	locations          []string
+}
+
+func (d *dataExchangeBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return dataExchangeResourceType
+}
+
+// List returns the data exchanges of the parent project in every configured location.
+func (d *dataExchangeBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != projectResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	for _, location := range d.locations {
+		it := d.analyticsHubClient.ListDataExchanges(ctx, &analyticshubpb.ListDataExchangesRequest{
+			Parent: fmt.Sprintf("projects/%s/locations/%s", parentResourceID.GetResource(), strings.ToLower(location)),
+		})
+		for {
+			exchange, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				if !isPermissionDenied(ctx, err) {
+					return nil, "", nil, wrapError(err, "Unable to fetch data exchanges")
+				}
+				break
+			}
+
+			resource, err := dataExchangeResource(exchange, parentResourceID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "Unable to create data exchange resource")
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, "", nil, nil
+}
+
+func (d *dataExchangeBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return analyticsHubEntitlements(resource, "data exchange"), "", nil, nil
+}
+
+func (d *dataExchangeBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	grants, err := analyticsHubGrants(ctx, d.analyticsHubClient, resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return grants, "", nil, nil
+}
+
+func dataExchangeResource(exchange *analyticshubpb.DataExchange, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":            exchange.GetName(),
+		"display_name":    exchange.GetDisplayName(),
+		"description":     exchange.GetDescription(),
+		"primary_contact": exchange.GetPrimaryContact(),
+		"listing_count":   exchange.GetListingCount(),
+		"discovery_type":  exchange.GetDiscoveryType().String(),
+	}
+
+	return rs.NewResource(
+		exchange.GetDisplayName(),
+		dataExchangeResourceType,
+		exchange.GetName(),
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+		rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: listingResourceType.Id}),
+	)
+}
+
+func analyticsHubEntitlements(resource *v2.Resource, kind string) []*v2.Entitlement {
+	var rv []*v2.Entitlement
+	for _, role := range analyticsHubRoles {
+		assigmentOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("%s %s %s", analyticsHubRoleVerbs[role], resource.DisplayName, kind)),
+			ent.WithDisplayName(fmt.Sprintf("%s %s %s", resource.DisplayName, kind, role)),
+		}
+		rv = append(rv, ent.NewPermissionEntitlement(resource, role, assigmentOptions...))
+	}
+
+	return rv
+}
+
+// analyticsHubGrants reads the IAM policy of an exchange or listing, whose resource ID is its full resource name.
+func analyticsHubGrants(ctx context.Context, client *analyticshub.Client, resource *v2.Resource) ([]*v2.Grant, error) {
+	var grants []*v2.Grant
+	l := ctxzap.Extract(ctx)
+	policy, err := client.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: resource.Id.Resource,
+	})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, wrapError(err, "failed to get IAM policy of "+resource.Id.Resource)
+		}
+	}
+
+	if policy == nil {
+		return grants, nil
+	}
+
+	for _, binding := range policy.Bindings {
+		if _, ok := analyticsHubRoleVerbs[binding.Role]; !ok {
+			continue
+		}
+
+		for _, member := range binding.Members {
+			principalID, ok := iamMemberPrincipalID(member)
+			if !ok {
+				l.Debug("Skipping Analytics Hub member that is not a user", zap.String("member", member))
+				continue
+			}
+
+			grants = append(grants, grant.NewGrant(resource, binding.Role, principalID))
+		}
+	}
+
+	return grants, nil
+}
+
+func newDataExchangeBuilder(analyticsHubClient *analyticshub.Client, locations []string) *dataExchangeBuilder {
+	return &dataExchangeBuilder{
+		resourceType:       dataExchangeResourceType,
+		analyticsHubClient: analyticsHubClient,
+		locations:          locations,
+	}
+}
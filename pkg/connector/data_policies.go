@@ -0,0 +1,206 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	datapolicies "cloud.google.com/go/bigquery/datapolicies/apiv1"
+	"cloud.google.com/go/bigquery/datapolicies/apiv1/datapoliciespb"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+// maskedReaderEntitlement reads the columns protected by a data masking policy with the masking applied.
+const maskedReaderEntitlement = "roles/bigquerydatapolicy.maskedReader"
+
+type dataPolicyBuilder struct {
+	resourceType     *v2.ResourceType
+	dataPolicyClient *datapolicies.DataPolicyClient
+	locations        []string
+}
+
+func (o *dataPolicyBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return dataPolicyResourceType
+}
+
+// List returns the data policies of the parent project in every configured location.
+func (o *dataPolicyBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != projectResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	for _, location := range o.locations {
+		it := o.dataPolicyClient.ListDataPolicies(ctx, &datapoliciespb.ListDataPoliciesRequest{
+			Parent: fmt.Sprintf("projects/%s/locations/%s", parentResourceID.GetResource(), strings.ToLower(location)),
+		})
+		for {
+			policy, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				if !isPermissionDenied(ctx, err) {
+					return nil, "", nil, wrapError(err, "Unable to fetch data policies")
+				}
+				break
+			}
+
+			resource, err := dataPolicyResource(policy, parentResourceID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "Unable to create data policy resource")
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *dataPolicyBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, maskedReaderEntitlement,
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("Reads columns protected by %s data policy with masking applied", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s data policy %s", resource.DisplayName, maskedReaderEntitlement)),
+		),
+	}, "", nil, nil
+}
+
+func (o *dataPolicyBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var grants []*v2.Grant
+	l := ctxzap.Extract(ctx)
+	policy, err := o.dataPolicyClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: resource.Id.Resource,
+	})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "failed to get IAM policy of data policy "+resource.Id.Resource)
+		}
+	}
+
+	for _, binding := range policy.GetBindings() {
+		if binding.Role != maskedReaderEntitlement {
+			continue
+		}
+
+		for _, member := range binding.Members {
+			principalID, ok := iamMemberPrincipalID(member)
+			if !ok {
+				l.Debug("Skipping data policy member that is not a user", zap.String("member", member))
+				continue
+			}
+
+			grants = append(grants, grant.NewGrant(resource, binding.Role, principalID))
+		}
+	}
+
+	return grants, "", nil, nil
+}
+
+// Grant adds the principal to the masked readers of the data policy.
+func (o *dataPolicyBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	if entitlementSlug(entitlement) != maskedReaderEntitlement {
+		return nil, fmt.Errorf("baton-google-bigquery: unsupported data policy entitlement %s", entitlementSlug(entitlement))
+	}
+
+	member, err := principalMember(principal)
+	if err != nil {
+		return nil, err
+	}
+
+	name := entitlement.GetResource().GetId().GetResource()
+	policy, err := o.dataPolicyClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: name})
+	if err != nil {
+		return nil, wrapError(err, "failed to get IAM policy of data policy "+name)
+	}
+
+	if !addPolicyMember(policy, maskedReaderEntitlement, member) {
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
+	}
+
+	if _, err := o.dataPolicyClient.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: name, Policy: policy}); err != nil {
+		return nil, wrapError(err, "failed to update IAM policy of data policy "+name)
+	}
+
+	l.Info("masked reader granted", zap.String("data_policy", name), zap.String("member", member))
+	return nil, nil
+}
+
+// Revoke removes the principal from the masked readers of the data policy.
+func (o *dataPolicyBuilder) Revoke(ctx context.Context, g *v2.Grant) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	if entitlementSlug(g.GetEntitlement()) != maskedReaderEntitlement {
+		return nil, fmt.Errorf("baton-google-bigquery: unsupported data policy entitlement %s", entitlementSlug(g.GetEntitlement()))
+	}
+
+	member, err := principalMember(g.GetPrincipal())
+	if err != nil {
+		return nil, err
+	}
+
+	name := g.GetEntitlement().GetResource().GetId().GetResource()
+	policy, err := o.dataPolicyClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: name})
+	if err != nil {
+		return nil, wrapError(err, "failed to get IAM policy of data policy "+name)
+	}
+
+	if !removePolicyMember(policy, maskedReaderEntitlement, member) {
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	}
+
+	if _, err := o.dataPolicyClient.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: name, Policy: policy}); err != nil {
+		return nil, wrapError(err, "failed to update IAM policy of data policy "+name)
+	}
+
+	l.Info("masked reader revoked", zap.String("data_policy", name), zap.String("member", member))
+	return nil, nil
+}
+
+// dataPolicyResource creates a data policy resource. Its profile holds the policy type, the policy tag it protects
+// and the masking rule.
+func dataPolicyResource(policy *datapoliciespb.DataPolicy, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":           policy.GetName(),
+		"data_policy_id": policy.GetDataPolicyId(),
+		"type":           policy.GetDataPolicyType().String(),
+	}
+	if policy.GetPolicyTag() != "" {
+		profile["policy_tag"] = policy.GetPolicyTag()
+	}
+	if masking := policy.GetDataMaskingPolicy(); masking != nil {
+		if masking.GetRoutine() != "" {
+			profile["masking_routine"] = masking.GetRoutine()
+		} else {
+			profile["masking_expression"] = masking.GetPredefinedExpression().String()
+		}
+	}
+
+	return rs.NewResource(
+		policy.GetDataPolicyId(),
+		dataPolicyResourceType,
+		policy.GetName(),
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newDataPolicyBuilder(dataPolicyClient *datapolicies.DataPolicyClient, locations []string) *dataPolicyBuilder {
+	return &dataPolicyBuilder{
+		resourceType:     dataPolicyResourceType,
+		dataPolicyClient: dataPolicyClient,
+		locations:        locations,
+	}
+}
@@ -0,0 +1,73 @@
+package connector
+
+import (
+	"testing"
+
+	datapolicies "cloud.google.com/go/bigquery/datapolicies/apiv1"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataPolicyMaskedReaders(t *testing.T) {
+	iam, opts := newFakeIAM(t)
+	client, err := datapolicies.NewDataPolicyClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	builder := newDataPolicyBuilder(client, []string{"EU"})
+
+	name := "projects/demo-project/locations/eu/dataPolicies/mask_ssn"
+	iam.setPolicy(name, &iampb.Policy{
+		Etag: []byte("1"),
+		Bindings: []*iampb.Binding{
+			{Role: maskedReaderEntitlement, Members: []string{"user:alice@example.com", "group:analysts@example.com"}},
+			{Role: "roles/bigquerydatapolicy.admin", Members: []string{"user:owner@example.com"}},
+		},
+	})
+	resource := &v2.Resource{
+		Id:          &v2.ResourceId{ResourceType: dataPolicyResourceType.Id, Resource: name},
+		DisplayName: "mask_ssn",
+	}
+
+	grants, _, _, err := builder.Grants(ctxTest, resource, nil)
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, "alice@example.com", grants[0].GetPrincipal().GetId().GetResource())
+	require.Equal(t, maskedReaderEntitlement, entitlementSlug(grants[0].GetEntitlement()))
+
+	entitlement := ent.NewPermissionEntitlement(resource, maskedReaderEntitlement)
+	etl := &v2.Resource{
+		Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "etl@demo-project.iam.gserviceaccount.com"},
+	}
+
+	annos, err := builder.Grant(ctxTest, etl, entitlement)
+	require.NoError(t, err)
+	require.False(t, annos.Contains(&v2.GrantAlreadyExists{}))
+	require.Equal(t,
+		[]string{"user:alice@example.com", "group:analysts@example.com", "serviceAccount:etl@demo-project.iam.gserviceaccount.com"},
+		iam.policy(name).GetBindings()[0].GetMembers())
+
+	annos, err = builder.Grant(ctxTest, etl, entitlement)
+	require.NoError(t, err)
+	require.True(t, annos.Contains(&v2.GrantAlreadyExists{}))
+
+	g := grant.NewGrant(resource, maskedReaderEntitlement, &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "alice@example.com"})
+	annos, err = builder.Revoke(ctxTest, g)
+	require.NoError(t, err)
+	require.False(t, annos.Contains(&v2.GrantAlreadyRevoked{}))
+	require.Equal(t,
+		[]string{"group:analysts@example.com", "serviceAccount:etl@demo-project.iam.gserviceaccount.com"},
+		iam.policy(name).GetBindings()[0].GetMembers())
+
+	annos, err = builder.Revoke(ctxTest, g)
+	require.NoError(t, err)
+	require.True(t, annos.Contains(&v2.GrantAlreadyRevoked{}))
+
+	// The other bindings of the policy are left alone.
+	require.Equal(t, []string{"user:owner@example.com"}, iam.policy(name).GetBindings()[1].GetMembers())
+
+	_, err = builder.Grant(ctxTest, etl, ent.NewPermissionEntitlement(resource, "roles/bigquerydatapolicy.admin"))
+	require.ErrorContains(t, err, "unsupported data policy entitlement")
+}
@@ -0,0 +1,350 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	lockdownDatasetAction      = "lockdown_dataset"
+	restoreDatasetAccessAction = "restore_dataset_access"
+	deleteDatasetAction        = "delete_dataset"
+
+	// lockdownLabel marks a locked down dataset, its value is the unix time of the lockdown.
+	lockdownLabel = "baton_lockdown"
+	// accessSnapshotTable is the sidecar table whose description holds the access list taken at lockdown.
+	accessSnapshotTable = "baton_access_snapshot"
+	// maxTableDescriptionLength is the BigQuery limit on table descriptions.
+	maxTableDescriptionLength = 16384
+
+	datasetActionArg        = "dataset"
+	projectActionArg        = "project_id"
+	deleteContentsActionArg = "delete_contents"
+)
+
+var (
+	datasetActionArguments = []*config.Field{
+		config.Field_builder{
+			Name:            datasetActionArg,
+			DisplayName:     "Dataset",
+			Description:     "The dataset to act on.",
+			ResourceIdField: &config.ResourceIdField{},
+			IsRequired:      true,
+		}.Build(),
+		config.Field_builder{
+			Name:        projectActionArg,
+			DisplayName: "Project ID",
+			Description: "The project that owns the dataset, only needed when the dataset ID is not qualified with it.",
+			StringField: &config.StringField{},
+		}.Build(),
+	}
+
+	lockdownDatasetSchema = v2.BatonActionSchema_builder{
+		Name:        lockdownDatasetAction,
+		DisplayName: "Lock down dataset",
+		Description: "Snapshot the dataset access list, then remove every entry that is not an owner.",
+		Arguments:   datasetActionArguments,
+		ReturnTypes: []*config.Field{
+			config.Field_builder{Name: "success", DisplayName: "Success", BoolField: &config.BoolField{}}.Build(),
+			config.Field_builder{Name: "removed_entries", DisplayName: "Removed entries", IntField: &config.IntField{}}.Build(),
+		},
+	}.Build()
+
+	restoreDatasetAccessSchema = v2.BatonActionSchema_builder{
+		Name:        restoreDatasetAccessAction,
+		DisplayName: "Restore dataset access",
+		Description: "Reapply the access list snapshot taken when the dataset was locked down.",
+		Arguments:   datasetActionArguments,
+		ReturnTypes: []*config.Field{
+			config.Field_builder{Name: "success", DisplayName: "Success", BoolField: &config.BoolField{}}.Build(),
+			config.Field_builder{Name: "restored_entries", DisplayName: "Restored entries", IntField: &config.IntField{}}.Build(),
+		},
+	}.Build()
+
+	deleteDatasetSchema = v2.BatonActionSchema_builder{
+		Name:        deleteDatasetAction,
+		DisplayName: "Delete dataset",
+		Description: "Delete the dataset, and the tables, routines and models it holds when delete contents is set.",
+		Arguments: append(append([]*config.Field{}, datasetActionArguments...),
+			config.Field_builder{
+				Name:        deleteContentsActionArg,
+				DisplayName: "Delete contents",
+				Description: "Delete the dataset even though it still holds tables, routines or models, together with them.",
+				BoolField:   &config.BoolField{},
+			}.Build(),
+		),
+		ReturnTypes: []*config.Field{
+			config.Field_builder{Name: "success", DisplayName: "Success", BoolField: &config.BoolField{}}.Build(),
+		},
+	}.Build()
+)
+
+// accessSnapshot is the serialized form of a dataset access list kept in the sidecar table. The entries are kept as
+// the REST API returns them for access policy version 3, with their conditions.
+type accessSnapshot struct {
+	TakenAt time.Time                    `json:"taken_at"`
+	Access  []*bigqueryapi.DatasetAccess `json:"access"`
+}
+
+// ResourceActions registers the break-glass actions available on datasets, and the deletion of a dataset with its
+// contents.
+func (o *datasetBuilder) ResourceActions(ctx context.Context, registry actions.ActionRegistry) error {
+	if err := registry.Register(ctx, lockdownDatasetSchema, o.lockdownDataset); err != nil {
+		return err
+	}
+
+	if err := registry.Register(ctx, restoreDatasetAccessSchema, o.restoreDatasetAccess); err != nil {
+		return err
+	}
+
+	return registry.Register(ctx, deleteDatasetSchema, o.deleteDataset)
+}
+
+func datasetFromActionArgs(client *bigquery.Client, args *structpb.Struct) (*bigquery.Dataset, error) {
+	resourceID, err := actions.RequireResourceIDArg(args, datasetActionArg)
+	if err != nil {
+		return nil, err
+	}
+	if resourceID.GetResourceType() != datasetResourceType.Id {
+		return nil, fmt.Errorf("resource %s is not a dataset", resourceID.GetResourceType())
+	}
+
+	projectID, datasetID := parseDatasetResourceID(resourceID.GetResource())
+	if projectID == "" {
+		projectID, err = actions.RequireStringArg(args, projectActionArg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return client.DatasetInProject(projectID, datasetID), nil
+}
+
+// lockdownDataset snapshots the dataset access list into the sidecar table, labels the dataset and keeps only
+// the owner entries. A dataset that is already locked down is left alone so that the first snapshot is kept.
+// The snapshot table is removed again when the dataset cannot be updated. A snapshot table left behind by an
+// earlier lockdown that did not complete is resumed: its snapshot is kept and the update is retried.
+// The access list is read and written as an access policy version 3 so that conditional entries are kept.
+func (o *datasetBuilder) lockdownDataset(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ds, err := datasetFromActionArgs(o.bigQueryClient, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meta, err := o.bigQueryService.Datasets.Get(ds.ProjectID, ds.DatasetID).
+		AccessPolicyVersion(datasetAccessPolicyVersion).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, nil, wrapError(err, "Unable to fetch dataset metadata (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+	}
+	if _, locked := meta.Labels[lockdownLabel]; locked {
+		return nil, nil, wrapError(fmt.Errorf("dataset %s:%s is already locked down", ds.ProjectID, ds.DatasetID), "")
+	}
+
+	kept := make([]*bigqueryapi.DatasetAccess, 0, len(meta.Access))
+	for _, entry := range meta.Access {
+		if entry.Role == ownerRole {
+			kept = append(kept, entry)
+		}
+	}
+
+	sidecar := ds.Table(accessSnapshotTable)
+	snapshot, err := readAccessSnapshot(ctx, sidecar)
+	if err != nil {
+		return nil, nil, wrapError(err, "Unable to read access snapshot (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+	}
+
+	resumed := snapshot != nil
+	if resumed {
+		l.Info("resuming dataset lockdown from its existing access snapshot",
+			zap.String("project", ds.ProjectID),
+			zap.String("dataset", ds.DatasetID),
+			zap.Time("taken_at", snapshot.TakenAt))
+	} else {
+		snapshot = &accessSnapshot{
+			TakenAt: time.Now().UTC(),
+			Access:  meta.Access,
+		}
+
+		description, err := json.Marshal(snapshot)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(description) > maxTableDescriptionLength {
+			return nil, nil, wrapError(fmt.Errorf("access snapshot of %d bytes exceeds the %d bytes a table description can hold",
+				len(description), maxTableDescriptionLength), "")
+		}
+
+		err = sidecar.Create(ctx, &bigquery.TableMetadata{
+			Description: string(description),
+			Labels: map[string]string{
+				lockdownLabel: strconv.FormatInt(snapshot.TakenAt.Unix(), 10),
+			},
+		})
+		if err != nil {
+			return nil, nil, wrapError(err, "Unable to store access snapshot (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+		}
+	}
+
+	// The access list is always sent, even empty, an omitted one would leave the dataset access untouched.
+	update := &bigqueryapi.Dataset{
+		Access: kept,
+		Labels: map[string]string{
+			lockdownLabel: strconv.FormatInt(snapshot.TakenAt.Unix(), 10),
+		},
+		ForceSendFields: []string{"Access"},
+	}
+	if err := o.patchDataset(ctx, ds, update, meta.Etag); err != nil {
+		// A snapshot taken by this call no longer matches a dataset that was not locked down, drop it so that a
+		// later lockdown takes a fresh one.
+		if !resumed {
+			if deleteErr := sidecar.Delete(ctx); deleteErr != nil {
+				l.Warn("unable to delete access snapshot table after a failed lockdown",
+					zap.String("project", ds.ProjectID),
+					zap.String("dataset", ds.DatasetID),
+					zap.Error(deleteErr))
+			}
+		}
+		return nil, nil, wrapError(err, "Unable to lock down dataset (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+	}
+
+	removed := len(meta.Access) - len(kept)
+	l.Info("dataset locked down",
+		zap.String("project", ds.ProjectID),
+		zap.String("dataset", ds.DatasetID),
+		zap.Int("removed_entries", removed))
+
+	return actions.NewReturnValues(true,
+		intReturnField("removed_entries", removed),
+	), nil, nil
+}
+
+// patchDataset updates the dataset through the REST API with an access policy version 3, the update is only applied
+// when the dataset still has the etag it was read with.
+func (o *datasetBuilder) patchDataset(ctx context.Context, ds *bigquery.Dataset, update *bigqueryapi.Dataset, etag string) error {
+	call := o.bigQueryService.Datasets.Patch(ds.ProjectID, ds.DatasetID, update).
+		AccessPolicyVersion(datasetAccessPolicyVersion).
+		Context(ctx)
+	call.Header().Set("If-Match", etag)
+
+	_, err := call.Do()
+	return err
+}
+
+// readAccessSnapshot returns the access snapshot stored in the sidecar table, or nil when there is none.
+func readAccessSnapshot(ctx context.Context, sidecar *bigquery.Table) (*accessSnapshot, error) {
+	sidecarMeta, err := sidecar.Metadata(ctx)
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	snapshot := &accessSnapshot{}
+	if err := json.Unmarshal([]byte(sidecarMeta.Description), snapshot); err != nil {
+		return nil, fmt.Errorf("invalid access snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// intReturnField returns the value of an IntField return type, an integral number like the SDK reads IntField
+// arguments.
+func intReturnField(key string, value int) actions.ReturnField {
+	return actions.NewReturnField(key, structpb.NewNumberValue(float64(value)))
+}
+
+// restoreDatasetAccess reapplies the access list stored at lockdown, then removes the label and the sidecar table.
+// A dataset that is no longer labeled was already restored, or its lockdown never applied, only its leftover sidecar
+// table is removed then. The restore fails when the sidecar table cannot be removed, a later lockdown would resume
+// the stale snapshot otherwise.
+func (o *datasetBuilder) restoreDatasetAccess(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ds, err := datasetFromActionArgs(o.bigQueryClient, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sidecar := ds.Table(accessSnapshotTable)
+	snapshot, err := readAccessSnapshot(ctx, sidecar)
+	if err != nil {
+		return nil, nil, wrapError(err, "Unable to read access snapshot (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+	}
+	if snapshot == nil {
+		return nil, nil, wrapError(fmt.Errorf("dataset %s:%s has no access snapshot to restore", ds.ProjectID, ds.DatasetID), "")
+	}
+
+	meta, err := o.bigQueryService.Datasets.Get(ds.ProjectID, ds.DatasetID).
+		AccessPolicyVersion(datasetAccessPolicyVersion).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, nil, wrapError(err, "Unable to fetch dataset metadata (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+	}
+
+	restored := 0
+	if _, locked := meta.Labels[lockdownLabel]; locked {
+		update := &bigqueryapi.Dataset{
+			Access:          snapshot.Access,
+			ForceSendFields: []string{"Access", "Labels"},
+			NullFields:      []string{"Labels." + lockdownLabel},
+		}
+		if err := o.patchDataset(ctx, ds, update, meta.Etag); err != nil {
+			return nil, nil, wrapError(err, "Unable to restore dataset access (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+		}
+		restored = len(snapshot.Access)
+	} else {
+		l.Info("dataset is not locked down, removing its leftover access snapshot",
+			zap.String("project", ds.ProjectID),
+			zap.String("dataset", ds.DatasetID),
+			zap.Time("taken_at", snapshot.TakenAt))
+	}
+
+	if err := sidecar.Delete(ctx); err != nil {
+		return nil, nil, wrapError(err, "Unable to delete access snapshot table, run the restore again to remove it (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+	}
+
+	l.Info("dataset access restored",
+		zap.String("project", ds.ProjectID),
+		zap.String("dataset", ds.DatasetID),
+		zap.Int("restored_entries", restored))
+
+	return actions.NewReturnValues(true,
+		intReturnField("restored_entries", restored),
+	), nil, nil
+}
+
+// deleteDataset deletes a dataset, with its contents only when the delete_contents argument is set.
+func (o *datasetBuilder) deleteDataset(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	ds, err := datasetFromActionArgs(o.bigQueryClient, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deleteContents, _ := actions.GetBoolArg(args, deleteContentsActionArg)
+	if err := o.removeDataset(ctx, ds, deleteContents); err != nil {
+		return nil, nil, err
+	}
+
+	return actions.NewReturnValues(true), nil, nil
+}
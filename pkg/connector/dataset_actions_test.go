@@ -0,0 +1,170 @@
+package connector
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// datasetActionArgs returns the arguments of a dataset action on the dataset, with the extra arguments.
+func datasetActionArgs(t *testing.T, datasetID string, extra map[string]interface{}) *structpb.Struct {
+	args := map[string]interface{}{
+		datasetActionArg: map[string]interface{}{
+			"resource_type_id": datasetResourceType.Id,
+			"resource_id":      datasetID,
+		},
+	}
+	for key, value := range extra {
+		args[key] = value
+	}
+
+	rv, err := structpb.NewStruct(args)
+	require.NoError(t, err)
+	return rv
+}
+
+func lockdownTestAccess() []*bigqueryapi.DatasetAccess {
+	return []*bigqueryapi.DatasetAccess{
+		{Role: "OWNER", UserByEmail: "owner@example.com"},
+		{Role: "READER", UserByEmail: "alice@example.com"},
+		{Role: "WRITER", GroupByEmail: "analysts@example.com"},
+		{Role: "READER", UserByEmail: "contractor@example.com", Condition: &bigqueryapi.Expr{
+			Title:      "Until end of contract",
+			Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`,
+		}},
+		{View: &bigqueryapi.TableReference{ProjectId: "demo-project", DatasetId: "reports", TableId: "sales_view"}},
+	}
+}
+
+func TestDatasetLockdownRestore(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "sales", lockdownTestAccess()...)
+	args := datasetActionArgs(t, "demo-project:sales", nil)
+
+	rv, _, err := builder.lockdownDataset(ctxTest, args)
+	require.NoError(t, err)
+	require.True(t, rv.GetFields()["success"].GetBoolValue())
+	require.Equal(t, float64(4), rv.GetFields()["removed_entries"].GetNumberValue())
+
+	ds := bq.dataset("demo-project", "sales")
+	require.Equal(t, []*bigqueryapi.DatasetAccess{{Role: "OWNER", UserByEmail: "owner@example.com"}}, ds.Access)
+	require.Contains(t, ds.Labels, lockdownLabel)
+
+	sidecar := bq.table("demo-project", "sales", accessSnapshotTable)
+	require.NotNil(t, sidecar)
+	snapshot := &accessSnapshot{}
+	require.NoError(t, json.Unmarshal([]byte(sidecar.Description), snapshot))
+	require.Equal(t, lockdownTestAccess(), snapshot.Access)
+
+	_, _, err = builder.lockdownDataset(ctxTest, args)
+	require.ErrorContains(t, err, "already locked down")
+
+	rv, _, err = builder.restoreDatasetAccess(ctxTest, args)
+	require.NoError(t, err)
+	require.True(t, rv.GetFields()["success"].GetBoolValue())
+	require.Equal(t, float64(5), rv.GetFields()["restored_entries"].GetNumberValue())
+
+	// The conditional entry is restored with its condition.
+	ds = bq.dataset("demo-project", "sales")
+	require.Equal(t, lockdownTestAccess(), ds.Access)
+	require.NotContains(t, ds.Labels, lockdownLabel)
+	require.Nil(t, bq.table("demo-project", "sales", accessSnapshotTable))
+
+	_, _, err = builder.restoreDatasetAccess(ctxTest, args)
+	require.ErrorContains(t, err, "has no access snapshot to restore")
+
+	// A dataset without owner entries is left without any.
+	bq.addDataset("demo-project", "ownerless", &bigqueryapi.DatasetAccess{Role: "READER", UserByEmail: "alice@example.com"})
+	_, _, err = builder.lockdownDataset(ctxTest, datasetActionArgs(t, "demo-project:ownerless", nil))
+	require.NoError(t, err)
+	require.Empty(t, bq.dataset("demo-project", "ownerless").Access)
+}
+
+func TestDatasetLockdownUpdateFailure(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "sales", lockdownTestAccess()...)
+	args := datasetActionArgs(t, "demo-project:sales", nil)
+
+	bq.setFailPatch(true)
+	_, _, err := builder.lockdownDataset(ctxTest, args)
+	require.ErrorContains(t, err, "Unable to lock down dataset")
+	require.Nil(t, bq.table("demo-project", "sales", accessSnapshotTable))
+	require.Len(t, bq.dataset("demo-project", "sales").Access, 5)
+
+	bq.setFailPatch(false)
+	_, _, err = builder.lockdownDataset(ctxTest, args)
+	require.NoError(t, err)
+	require.NotNil(t, bq.table("demo-project", "sales", accessSnapshotTable))
+}
+
+func TestDatasetLockdownResume(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "sales", lockdownTestAccess()...)
+
+	// A snapshot left behind by an earlier lockdown holds the access list as it was then.
+	takenAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	description, err := json.Marshal(&accessSnapshot{
+		TakenAt: takenAt,
+		Access: []*bigqueryapi.DatasetAccess{
+			{Role: "OWNER", UserByEmail: "owner@example.com"},
+			{Role: "READER", UserByEmail: "bob@example.com"},
+		},
+	})
+	require.NoError(t, err)
+	bq.addTable("demo-project", "sales", &bigqueryapi.Table{
+		TableReference: &bigqueryapi.TableReference{TableId: accessSnapshotTable},
+		Description:    string(description),
+	})
+
+	// The update failing again keeps the snapshot of the earlier lockdown.
+	bq.setFailPatch(true)
+	args := datasetActionArgs(t, "demo-project:sales", nil)
+	_, _, err = builder.lockdownDataset(ctxTest, args)
+	require.Error(t, err)
+	require.Equal(t, string(description), bq.table("demo-project", "sales", accessSnapshotTable).Description)
+
+	bq.setFailPatch(false)
+	_, _, err = builder.lockdownDataset(ctxTest, args)
+	require.NoError(t, err)
+	require.Equal(t, string(description), bq.table("demo-project", "sales", accessSnapshotTable).Description)
+	require.Equal(t, "1714557600", bq.dataset("demo-project", "sales").Labels[lockdownLabel])
+
+	_, _, err = builder.restoreDatasetAccess(ctxTest, args)
+	require.NoError(t, err)
+	require.Equal(t, []*bigqueryapi.DatasetAccess{
+		{Role: "OWNER", UserByEmail: "owner@example.com"},
+		{Role: "READER", UserByEmail: "bob@example.com"},
+	}, bq.dataset("demo-project", "sales").Access)
+}
+
+func TestDatasetRestoreSnapshotDeleteFailure(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "sales", lockdownTestAccess()...)
+	args := datasetActionArgs(t, "demo-project:sales", nil)
+
+	_, _, err := builder.lockdownDataset(ctxTest, args)
+	require.NoError(t, err)
+
+	// The access is restored but the restore fails as long as the snapshot is left behind.
+	bq.setFailTableDelete(true)
+	_, _, err = builder.restoreDatasetAccess(ctxTest, args)
+	require.ErrorContains(t, err, "Unable to delete access snapshot table")
+	ds := bq.dataset("demo-project", "sales")
+	require.Equal(t, lockdownTestAccess(), ds.Access)
+	require.NotContains(t, ds.Labels, lockdownLabel)
+	require.NotNil(t, bq.table("demo-project", "sales", accessSnapshotTable))
+
+	// Access granted since is kept when the restore runs again, it only removes the snapshot.
+	bq.addDataset("demo-project", "sales", append(lockdownTestAccess(),
+		&bigqueryapi.DatasetAccess{Role: "READER", UserByEmail: "bob@example.com"})...)
+	bq.setFailTableDelete(false)
+	rv, _, err := builder.restoreDatasetAccess(ctxTest, args)
+	require.NoError(t, err)
+	require.Equal(t, float64(0), rv.GetFields()["restored_entries"].GetNumberValue())
+	require.Len(t, bq.dataset("demo-project", "sales").Access, 6)
+	require.Nil(t, bq.table("demo-project", "sales", accessSnapshotTable))
+}
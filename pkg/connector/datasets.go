@@ -9,7 +9,6 @@ import (
 	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/iam/apiv1/iampb"
 	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
-	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
@@ -17,31 +16,28 @@ import (
 	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
 type datasetBuilder struct {
-	resourceType   *v2.ResourceType
-	bigQueryClient *bigquery.Client
-	projectsClient *resourcemanager.ProjectsClient
+	resourceType    *v2.ResourceType
+	bigQueryClient  *bigquery.Client
+	bigQueryService *bigqueryapi.Service
+	projectsClient  *resourcemanager.ProjectsClient
+	backend         policyBackend
+	usage           *usageReporter
+	denials         *denyEvaluator
 }
 
 const (
-	adminEntitlement                = "roles/admin"
-	editorEntitlement               = "roles/editor"
-	readerEntitlement               = "reader"
-	ownerEntitlement                = "owner"
-	writerEntitlement               = "writer"
-	viewerEntitlement               = "roles/viewer"
-	bqAdminEntitlement              = "roles/bigquery.admin"
-	bqStudioAdminEntitlement        = "roles/bigquery.studioAdmin"
-	bqUserEntitlement               = "roles/bigquery.user"
-	bqResourceEditorEntitlement     = "roles/bigquery.resourceEditor"
-	bqMetadataViewerEntitlement     = "roles/bigquery.metadataViewer"
-	bqFilteredDataViewerEntitlement = "roles/bigquery.filteredDataViewer"
-	serviceAccount                  = "serviceAccount"
-	user                            = "user"
+	authorizedViewEntitlement = "authorized_view"
+	serviceAccount            = "serviceAccount"
+	user                      = "user"
+
+	// datasetAccessPolicyVersion requests the dataset access list as an IAM policy, with conditional bindings.
+	datasetAccessPolicyVersion = 3
 )
 
 var (
@@ -60,10 +56,10 @@ var (
 	readerRole = string(bigquery.ReaderRole)
 	writerRole = string(bigquery.WriterRole)
 
-	legacyRolesToEntitlementsMap = map[string]string{
-		ownerRole:  ownerEntitlement,
-		readerRole: viewerEntitlement,
-		writerRole: writerEntitlement,
+	legacyRolesToDatasetRolesMap = map[string]string{
+		ownerRole:  "roles/bigquery.dataOwner",
+		writerRole: "roles/bigquery.dataEditor",
+		readerRole: "roles/bigquery.dataViewer",
 	}
 
 	specialGroupNameToPolicyBindingRoleMap = map[string]string{
@@ -72,40 +68,48 @@ var (
 		"projectWriters": "roles/editor",
 	}
 
-	iamRoleToEntitlementMap = map[string]string{
-		"roles/bigquery.admin":              bqAdminEntitlement,
-		"roles/bigquery.studioAdmin":        bqStudioAdminEntitlement,
-		"roles/bigquery.user":               bqUserEntitlement,
-		"roles/bigquery.resourceEditor":     bqResourceEditorEntitlement, // Can read and modify dataset metadata but not the dataset content it self.
-		"roles/bigquery.metadataViewer":     bqMetadataViewerEntitlement,
-		"roles/bigquery.filteredDataViewer": bqFilteredDataViewerEntitlement, // Restricted Read Access. Can only access table rows which match their policy.
-		"roles/admin":                       adminEntitlement,
-		"roles/editor":                      editorEntitlement,
-		"roles/reader":                      readerEntitlement,
-	}
-	datasetEntitlements        = []string{ownerEntitlement, writerEntitlement, viewerEntitlement}
-	datasetIamRoleEntitlements = []string{
-		bqAdminEntitlement,
-		bqStudioAdminEntitlement,
-		bqUserEntitlement,
-		bqResourceEditorEntitlement,
-		bqMetadataViewerEntitlement,
-		bqFilteredDataViewerEntitlement,
-		adminEntitlement,
-		editorEntitlement,
-		readerEntitlement,
+	// datasetRoles is the catalog of predefined roles that can be granted on a dataset, each one is a dataset
+	// entitlement named after the role.
+	datasetRoles = []string{
+		"roles/bigquery.admin",
+		"roles/bigquery.studioAdmin",
+		"roles/bigquery.dataOwner",
+		"roles/bigquery.dataEditor",
+		"roles/bigquery.dataViewer",
+		"roles/bigquery.metadataViewer",
+		"roles/bigquery.filteredDataViewer", // Restricted Read Access. Can only access table rows which match their policy.
+		"roles/bigquery.user",
+	}
+	datasetRoleVerbs = map[string]string{
+		"roles/bigquery.admin":              "Administers",
+		"roles/bigquery.studioAdmin":        "Administers, with BigQuery Studio,",
+		"roles/bigquery.dataOwner":          "Owns",
+		"roles/bigquery.dataEditor":         "Can write to",
+		"roles/bigquery.dataViewer":         "Can read",
+		"roles/bigquery.metadataViewer":     "Can view the metadata of",
+		"roles/bigquery.filteredDataViewer": "Can read rows allowed by row access policies of",
+		"roles/bigquery.user":               "Can list tables and run queries in",
 	}
 )
 
+// datasetRoleEntitlement returns the dataset entitlement of an access entry role, legacy roles are mapped to their
+// predefined role.
+func datasetRoleEntitlement(role string) (string, bool) {
+	if predefined, ok := legacyRolesToDatasetRolesMap[role]; ok {
+		role = predefined
+	}
+	_, ok := datasetRoleVerbs[role]
+	return role, ok
+}
+
 func (o *datasetBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 	return datasetResourceType
 }
 
+// List pages through the projects, then through the datasets of each project: a project page only queues its projects
+// in the page token, and each following call lists a page of the datasets of the queued project.
 func (o *datasetBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	var (
-		resources []*v2.Resource
-		bag       = &pagination.Bag{}
-	)
+	bag := &pagination.Bag{}
 	err := bag.Unmarshal(pToken.Token)
 	if err != nil {
 		return nil, "", nil, err
@@ -117,52 +121,65 @@ func (o *datasetBuilder) List(ctx context.Context, parentResourceID *v2.Resource
 		})
 	}
 
-	it := o.projectsClient.SearchProjects(ctx,
-		&resourcemanagerpb.SearchProjectsRequest{
-			Query:     "",
-			PageToken: bag.PageToken(),
-		},
-	)
-
-	for {
-		project, err := it.Next()
-		if errors.Is(err, iterator.Done) || project == nil {
-			break
-		}
-
+	if bag.ResourceTypeID() == projectResourceType.Id {
+		projects, nextPageToken, err := o.backend.ProjectsPage(ctx, bag.PageToken())
 		if err != nil {
 			if !isPermissionDenied(ctx, err) {
 				return nil, "", nil, wrapError(err, "Unable to fetch projects")
 			}
+			return nil, "", nil, nil
 		}
 
-		iter := o.bigQueryClient.Datasets(ctx)
-		iter.ProjectID = project.ProjectId // Setting ProjectID on the returned iterator
-		for {
-			dataset, err := iter.Next()
-			if errors.Is(err, iterator.Done) || dataset == nil {
-				break
-			}
-
-			if err != nil {
-				if !isPermissionDenied(ctx, err) {
-					return nil, "", nil, wrapError(err, "Unable to fetch dataset")
-				}
-			}
+		err = bag.Next(nextPageToken)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
+		}
 
-			resource, err := datasetResource(ctx, dataset.DatasetID, &v2.ResourceId{
-				ResourceType: projectResourceType.Id,
-				Resource:     dataset.ProjectID,
+		// The bag is a stack, projects are pushed in reverse to be listed in order.
+		for i := len(projects) - 1; i >= 0; i-- {
+			bag.Push(pagination.PageState{
+				ResourceTypeID: datasetResourceType.Id,
+				ResourceID:     projects[i].ProjectId,
 			})
-			if err != nil {
-				return nil, "", nil, wrapError(err, "Unable to create dataset resource")
+		}
+
+		pageToken, err := bag.Marshal()
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		return nil, pageToken, nil, nil
+	}
+
+	var resources []*v2.Resource
+	projectID := bag.ResourceID()
+	datasetIDs, nextPageToken, err := o.backend.DatasetsPage(ctx, projectID, bag.PageToken())
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "Unable to fetch dataset")
+		}
+	}
+
+	for _, datasetID := range datasetIDs {
+		metadata, err := o.backend.Dataset(ctx, projectID, datasetID)
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch dataset metadata (projectId:"+projectID+" datasetID:"+datasetID+")")
 			}
+		}
 
-			resources = append(resources, resource)
+		resource, err := datasetResource(ctx, projectID, datasetID, metadata, &v2.ResourceId{
+			ResourceType: projectResourceType.Id,
+			Resource:     projectID,
+		})
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create dataset resource")
 		}
+
+		resources = append(resources, resource)
 	}
 
-	err = bag.Next(it.PageInfo().Token)
+	err = bag.Next(nextPageToken)
 	if err != nil {
 		return nil, "", nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
 	}
@@ -175,44 +192,61 @@ func (o *datasetBuilder) List(ctx context.Context, parentResourceID *v2.Resource
 	return resources, pageToken, nil, nil
 }
 
-func (o *datasetBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	var rv []*v2.Entitlement
+// datasetMetadata fetches the dataset through the REST API, which unlike the client library reports the dataset
+// type and linked source. Datasets the credentials cannot read are returned without metadata.
+func (o *datasetBuilder) datasetMetadata(ctx context.Context, projectID string, datasetID string) (*bigqueryapi.Dataset, error) {
+	if o.bigQueryService == nil {
+		return nil, nil
+	}
 
-	var entitlementToVerbMap = map[string]string{
-		ownerEntitlement:  "Owns",
-		writerEntitlement: "Can write to",
-		viewerEntitlement: "Can view",
+	dataset, err := o.bigQueryService.Datasets.Get(projectID, datasetID).Context(ctx).Do()
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, wrapError(err, "Unable to fetch dataset metadata (projectId:"+projectID+" datasetID:"+datasetID+")")
+		}
+		return nil, nil
 	}
 
-	var iamRoleEntitlementVerb = "Has role"
+	return dataset, nil
+}
 
-	for _, datasetEntitlement := range datasetEntitlements {
-		assigmentOptions := []ent.EntitlementOption{
-			ent.WithGrantableTo(userResourceType),
-			ent.WithDescription(fmt.Sprintf("%s %s dataset", entitlementToVerbMap[datasetEntitlement], resource.DisplayName)),
-			ent.WithDisplayName(fmt.Sprintf("%s dataset %s", resource.DisplayName, datasetEntitlement)),
-		}
-		rv = append(rv, ent.NewPermissionEntitlement(resource, datasetEntitlement, assigmentOptions...))
+// datasetIDs returns the project and dataset IDs of a dataset resource.
+// Unqualified IDs take the project from the parent resource.
+func datasetIDs(resourceID *v2.ResourceId, parentResourceID *v2.ResourceId) (string, string) {
+	projectID, datasetID := parseDatasetResourceID(resourceID.GetResource())
+	if projectID == "" {
+		projectID = parentResourceID.GetResource()
 	}
 
-	for _, iamRoleEntitlement := range datasetIamRoleEntitlements {
+	return projectID, datasetID
+}
+
+func (o *datasetBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+	for _, role := range datasetRoles {
 		assigmentOptions := []ent.EntitlementOption{
-			ent.WithGrantableTo(userResourceType),
-			ent.WithDescription(fmt.Sprintf("%s %s in %s dataset", iamRoleEntitlementVerb, iamRoleEntitlement, resource.DisplayName)),
-			ent.WithDisplayName(fmt.Sprintf("%s dataset %s", resource.DisplayName, iamRoleEntitlement)),
+			ent.WithGrantableTo(userResourceType, roleResourceType),
+			ent.WithDescription(fmt.Sprintf("%s %s dataset", datasetRoleVerbs[role], resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s dataset %s", resource.DisplayName, role)),
 		}
-		rv = append(rv, ent.NewPermissionEntitlement(resource, iamRoleEntitlement, assigmentOptions...))
+		rv = append(rv, ent.NewPermissionEntitlement(resource, role, assigmentOptions...))
 	}
+
+	rv = append(rv, ent.NewPermissionEntitlement(resource, authorizedViewEntitlement,
+		ent.WithGrantableTo(viewResourceType),
+		ent.WithDescription(fmt.Sprintf("View authorized to read %s dataset", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s dataset %s", resource.DisplayName, authorizedViewEntitlement)),
+	))
 	return rv, "", nil, nil
 }
 
+// Grants reads the dataset access policy. Version 3 of the policy is requested so that conditional bindings keep
+// their role, their condition is added to the grant metadata.
 func (o *datasetBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	var grants []*v2.Grant
 	l := ctxzap.Extract(ctx)
-	datasetID := resource.Id.Resource
-	projectId := resource.ParentResourceId.Resource
-	ds := o.bigQueryClient.DatasetInProject(projectId, datasetID)
-	dataset, err := ds.Metadata(ctx)
+	projectId, datasetID := datasetIDs(resource.Id, resource.ParentResourceId)
+	dataset, err := o.backend.Dataset(ctx, projectId, datasetID)
 	if err != nil {
 		if !isPermissionDenied(ctx, err) {
 			// Check if it's a 404 error from the Google API, based on DatasetsGetCall's Do we can check if the error is a 404 error
@@ -225,122 +259,370 @@ func (o *datasetBuilder) Grants(ctx context.Context, resource *v2.Resource, pTok
 			}
 			return nil, "", nil, wrapError(err, "Unable to fetch dataset metadata (projectId:"+projectId+" datasetID:"+datasetID+")")
 		}
+		return nil, "", nil, nil
+	}
+	if dataset == nil {
+		l.Debug("Dataset not found (projectId:" + projectId + " datasetID:" + datasetID + ")")
+		return nil, "", nil, nil
 	}
 
-	policy, err := o.projectsClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
-		Resource: fmt.Sprintf("projects/%s", projectId),
-	})
+	// The project policy expands special groups and recognizes service accounts outside gserviceaccount.com,
+	// access entries are still granted when it cannot be read.
+	policy, err := o.backend.ProjectPolicy(ctx, projectId)
 	if err != nil {
 		if !isPermissionDenied(ctx, err) {
 			return nil, "", nil, wrapError(err, "failed to get IAM policy")
 		}
 	}
 
-	if policy == nil {
-		return grants, "", nil, nil
+	for _, entry := range dataset.Access {
+		access := accessEntryFromAPI(entry)
+		entryGrants := o.accessEntryGrants(ctx, resource, policy, access)
+		if entry.Condition != nil {
+			for _, g := range entryGrants {
+				if err := addGrantMetadata(g, map[string]interface{}{
+					"condition_title":       entry.Condition.Title,
+					"condition_description": entry.Condition.Description,
+					"condition_expression":  entry.Condition.Expression,
+				}); err != nil {
+					l.Warn("unable to annotate grant with its condition", zap.String("grant", g.GetId()), zap.Error(err))
+				}
+			}
+		}
+		grants = append(grants, entryGrants...)
 	}
 
-	for _, access := range dataset.Access {
-		stringLegacyRoleValue := string(access.Role)
+	if o.usage != nil {
+		if err := o.usage.annotateDatasetGrants(ctx, projectId, datasetID, grants); err != nil {
+			return nil, "", nil, wrapError(err, "failed to annotate dataset grants with usage")
+		}
+	}
 
-		switch access.EntityType {
-		case bigquery.UserEmailEntity:
-			// An email address of a user to grant access to. For example: fred@example.com. Maps to IAM policy member "user:EMAIL" or "serviceAccount:EMAIL".
-			if access.Role == bigquery.OwnerRole {
-				// Generate Owners grants.
-				g, err := o.GetUserOwnerGrants(policy, resource, access)
-				if err != nil {
-					l.Warn("error while creating user owner grant",
-						zap.String("error", err.Error()))
-					continue
-				}
-				grants = append(grants, g...)
-			} else {
-				roleEntitlement, exists := legacyRolesToEntitlementsMap[stringLegacyRoleValue]
-				if !exists {
-					roleEntitlement, exists = iamRoleToEntitlementMap[stringLegacyRoleValue]
-					if !exists {
-						l.Warn("Role is not a legacy nor a predifined IAM role with permissions to read or write datasets",
-							zap.String("role", stringLegacyRoleValue))
-						continue
-					}
-				}
+	if o.denials != nil {
+		if err := o.denials.annotateDatasetGrants(ctx, projectId, grants); err != nil {
+			return nil, "", nil, wrapError(err, "failed to annotate dataset grants with deny policies")
+		}
+	}
 
-				g, err := o.GetEntityGrant(policy, resource, access, roleEntitlement)
-				if err != nil {
-					l.Warn("error while creating user/acccount service grant",
-						zap.String("error", err.Error()))
-					continue
-				}
-				grants = append(grants, g...)
+	return grants, "", nil, nil
+}
+
+// accessEntryGrants returns the grants of a single dataset access entry.
+func (o *datasetBuilder) accessEntryGrants(ctx context.Context, resource *v2.Resource, policy *iampb.Policy, access *bigquery.AccessEntry) []*v2.Grant {
+	l := ctxzap.Extract(ctx)
+	if access.EntityType == bigquery.ViewEntity {
+		// Authorized views read the dataset with the rights of the view owner.
+		if access.View == nil {
+			return nil
+		}
+		return []*v2.Grant{
+			grant.NewGrant(resource, authorizedViewEntitlement, &v2.ResourceId{
+				ResourceType: viewResourceType.Id,
+				Resource:     datasetChildResourceID(access.View.ProjectID, access.View.DatasetID, access.View.TableID),
+			}),
+		}
+	}
+
+	e, exists := datasetRoleEntitlement(string(access.Role))
+	if !exists {
+		l.Warn("Role is not a predefined IAM role with permissions on datasets",
+			zap.String("role", string(access.Role)))
+		return nil
+	}
+
+	switch access.EntityType {
+	case bigquery.UserEmailEntity, bigquery.IAMMemberEntity:
+		// An email address of a user, or an IAM member. Maps to IAM policy member "user:EMAIL" or "serviceAccount:EMAIL".
+		// Principals deleted after being granted access are reported as deleted:user:EMAIL?uid=ID IAM members.
+		if isDeleted, _, _ := isDeletedUserOrServiceAccountMember(access.Entity); isDeleted {
+			return []*v2.Grant{
+				grant.NewGrant(resource, e, &v2.ResourceId{
+					ResourceType: userResourceType.Id,
+					Resource:     access.Entity,
+				}),
 			}
-		case bigquery.SpecialGroupEntity:
-			// A special group to grant access to. Possible values include:
-			//  - projectOwners: Owners of the enclosing project.
-			//  - projectReaders: Readers of the enclosing project.
-			//  - projectWriters: Writers of the enclosing project.
-			//  - allAuthenticatedUsers: All authenticated BigQuery users.
-			// Maps to similarly-named IAM members.
-			e, exists := legacyRolesToEntitlementsMap[stringLegacyRoleValue]
-			if !exists {
-				l.Warn("entitlement for legacy role not found",
-					zap.String("legacy role", stringLegacyRoleValue))
+		}
+		if _, _, ok := accessEntryPrincipal(access, policy); !ok {
+			l.Info("Skipping Access entry for unhandled IAM member")
+			return nil
+		}
+
+		g, err := o.GetEntityGrant(policy, resource, access, e)
+		if err != nil {
+			l.Warn("error while creating user/acccount service grant",
+				zap.String("error", err.Error()))
+			return nil
+		}
+		return g
+	case bigquery.SpecialGroupEntity:
+		// A special group to grant access to. Possible values include:
+		//  - projectOwners: Owners of the enclosing project.
+		//  - projectReaders: Readers of the enclosing project.
+		//  - projectWriters: Writers of the enclosing project.
+		//  - allAuthenticatedUsers: All authenticated BigQuery users.
+		// Maps to similarly-named IAM members.
+		// The group is granted to the members of the project role in the policy of the dataset's project.
+		role, exists := specialGroupNameToPolicyBindingRoleMap[access.Entity]
+		if !exists {
+			l.Warn("Special group not found",
+				zap.String("special group", access.Entity))
+			return nil
+		}
+
+		return specialGroupGrants(resource, e, role, policy)
+	default:
+		// It's either groupByEmail, domain, routine or other dataset.
+		l.Info("Skipping Access entry for unhandled entity type")
+		return nil
+	}
+}
+
+// Create creates a dataset in the parent project.
+// The dataset ID defaults to the resource display name, the location, description, encryption key, default table
+// expiration, labels and initial access entries are read from the resource profile (see datasetMetadataFromProfile).
+func (o *datasetBuilder) Create(ctx context.Context, resource *v2.Resource) (*v2.Resource, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	parent := resource.GetParentResourceId()
+	if parent.GetResourceType() != projectResourceType.Id || parent.GetResource() == "" {
+		return nil, nil, wrapError(fmt.Errorf("a parent project is required to create a dataset"), "")
+	}
+	projectId := parent.GetResource()
+
+	_, datasetID := parseDatasetResourceID(resource.GetId().GetResource())
+	if datasetID == "" {
+		datasetID = resource.GetDisplayName()
+	}
+	if datasetID == "" {
+		return nil, nil, wrapError(fmt.Errorf("a dataset ID is required to create a dataset"), "")
+	}
+
+	meta, err := datasetMetadataFromProfile(resource.GetProfile())
+	if err != nil {
+		return nil, nil, wrapError(err, "invalid dataset profile")
+	}
+
+	err = o.bigQueryClient.DatasetInProject(projectId, datasetID).Create(ctx, meta)
+	if err != nil {
+		return nil, nil, wrapError(err, "Unable to create dataset (projectId:"+projectId+" datasetID:"+datasetID+")")
+	}
+
+	l.Info("dataset created",
+		zap.String("project", projectId),
+		zap.String("dataset", datasetID),
+		zap.String("location", meta.Location))
+
+	metadata, err := o.datasetMetadata(ctx, projectId, datasetID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	created, err := datasetResource(ctx, projectId, datasetID, metadata, parent)
+	if err != nil {
+		return nil, nil, wrapError(err, "Unable to create dataset resource")
+	}
+
+	return created, nil, nil
+}
+
+// Delete deletes an empty dataset. Datasets that still contain tables, routines or models are only deleted, together
+// with their contents, by the delete_dataset action with delete_contents set.
+func (o *datasetBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId, parentResourceID *v2.ResourceId) (annotations.Annotations, error) {
+	projectId, datasetID := datasetIDs(resourceId, parentResourceID)
+	if projectId == "" {
+		return nil, wrapError(fmt.Errorf("a parent project is required to delete dataset %s", resourceId.GetResource()), "")
+	}
+
+	return nil, o.removeDataset(ctx, o.bigQueryClient.DatasetInProject(projectId, datasetID), false)
+}
+
+// removeDataset deletes a dataset with its contents when deleteContents is set, and refuses to delete a dataset that
+// still holds tables, routines or models otherwise.
+func (o *datasetBuilder) removeDataset(ctx context.Context, ds *bigquery.Dataset, deleteContents bool) error {
+	l := ctxzap.Extract(ctx)
+	if deleteContents {
+		if err := ds.DeleteWithContents(ctx); err != nil {
+			return wrapError(err, "Unable to delete dataset (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+		}
+
+		l.Info("dataset deleted with its contents", zap.String("project", ds.ProjectID), zap.String("dataset", ds.DatasetID))
+		return nil
+	}
+
+	contents := []struct {
+		kind string
+		next func() error
+	}{
+		{"tables", func() error { _, err := ds.Tables(ctx).Next(); return err }},
+		{"routines", func() error { _, err := ds.Routines(ctx).Next(); return err }},
+		{"models", func() error { _, err := ds.Models(ctx).Next(); return err }},
+	}
+	for _, c := range contents {
+		err := c.next()
+		if err == nil {
+			return wrapError(
+				fmt.Errorf("dataset %s:%s still holds %s, use the %s action with %s to delete it with its contents",
+					ds.ProjectID, ds.DatasetID, c.kind, deleteDatasetAction, deleteContentsActionArg),
+				"",
+			)
+		}
+		if !errors.Is(err, iterator.Done) {
+			return wrapError(err, "Unable to list "+c.kind+" (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+		}
+	}
+
+	if err := ds.Delete(ctx); err != nil {
+		return wrapError(err, "Unable to delete dataset (projectId:"+ds.ProjectID+" datasetID:"+ds.DatasetID+")")
+	}
+
+	l.Info("dataset deleted", zap.String("project", ds.ProjectID), zap.String("dataset", ds.DatasetID))
+	return nil
+}
+
+// specialGroupGrants grants the dataset entitlement to the members of a project role, read from the policy of the
+// dataset's project. Role resources are shared by every project, expanding the role would grant the dataset to
+// the members of the role in other projects as well.
+func specialGroupGrants(resource *v2.Resource, entitlement string, role string, policy *iampb.Policy) []*v2.Grant {
+	var grants []*v2.Grant
+	seen := make(map[string]struct{})
+	for _, binding := range policy.GetBindings() {
+		if binding.Role != role {
+			continue
+		}
+
+		for _, member := range binding.Members {
+			principalID, ok := iamMemberPrincipalID(member)
+			if !ok {
 				continue
 			}
-			for _, binding := range policy.Bindings {
-				specialGroupName := access.Entity
-				role, exists := specialGroupNameToPolicyBindingRoleMap[specialGroupName]
-				if !exists {
-					l.Warn("Special group not found",
-						zap.String("special group", specialGroupName))
-					continue
-				}
-				if binding.Role != role {
-					continue
-				}
-				for _, member := range binding.Members {
-					var usrR *v2.Resource
-
-					if isUser, user := isUser(member); isUser {
-						usrR, err = userResource(user, nil, nil)
-						if err != nil {
-							l.Warn("Unable to create user resource",
-								zap.String("error", err.Error()))
-							continue
-						}
-					} else if isServiceAccount, serviceAccount := isServiceAccount(member); isServiceAccount {
-						usrR, err = userResource(serviceAccount, nil, nil)
-						if err != nil {
-							l.Warn("Unable to create (service account) user resource",
-								zap.String("error", err.Error()))
-							continue
-						}
-					} else {
-						continue
-					}
-					grants = append(grants, grant.NewGrant(resource, e, usrR.Id))
-				}
+			if _, ok := seen[principalID.GetResource()]; ok {
+				continue
+			}
+			seen[principalID.GetResource()] = struct{}{}
+
+			if isServiceAccount, email := isServiceAccount(member); isServiceAccount {
+				grants = append(grants, serviceAccountGrant(resource, entitlement, email))
+				continue
 			}
-		default:
-			// It's either groupByEmail, domain, view, routine, other dataset or another type of iamMember (not user or special group).
-			l.Info("Skipping Access entry for unhandled entity type")
+			grants = append(grants, grant.NewGrant(resource, entitlement, principalID))
 		}
 	}
 
-	return grants, "", nil, nil
+	return grants
+}
+
+// Grant authorizes a view to read the dataset by adding a view access entry. Only the authorized_view entitlement
+// is provisioned, user access to datasets is granted through project IAM.
+func (o *datasetBuilder) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ds, view, err := o.authorizedViewEntry(entitlement, principal.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := ds.Metadata(ctx)
+	if err != nil {
+		return nil, wrapError(err, "Unable to fetch dataset metadata (dataset:"+entitlement.GetResource().GetId().GetResource()+")")
+	}
+
+	for _, access := range meta.Access {
+		if isSameView(access, view) {
+			return annotations.New(&v2.GrantAlreadyExists{}), nil
+		}
+	}
+
+	access := append(meta.Access, &bigquery.AccessEntry{
+		EntityType: bigquery.ViewEntity,
+		View:       view,
+	})
+	if _, err := ds.Update(ctx, bigquery.DatasetMetadataToUpdate{Access: access}, meta.ETag); err != nil {
+		return nil, wrapError(err, "Unable to authorize view "+principal.GetId().GetResource())
+	}
+
+	l.Info("view authorized",
+		zap.String("dataset", entitlement.GetResource().GetId().GetResource()),
+		zap.String("view", principal.GetId().GetResource()))
+	return nil, nil
+}
+
+// Revoke removes the view access entry of an authorized_view grant.
+func (o *datasetBuilder) Revoke(ctx context.Context, g *v2.Grant) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	ds, view, err := o.authorizedViewEntry(g.GetEntitlement(), g.GetPrincipal().GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := ds.Metadata(ctx)
+	if err != nil {
+		return nil, wrapError(err, "Unable to fetch dataset metadata (dataset:"+g.GetEntitlement().GetResource().GetId().GetResource()+")")
+	}
+
+	access := make([]*bigquery.AccessEntry, 0, len(meta.Access))
+	for _, entry := range meta.Access {
+		if isSameView(entry, view) {
+			continue
+		}
+		access = append(access, entry)
+	}
+	if len(access) == len(meta.Access) {
+		return annotations.New(&v2.GrantAlreadyRevoked{}), nil
+	}
+
+	if _, err := ds.Update(ctx, bigquery.DatasetMetadataToUpdate{Access: access}, meta.ETag); err != nil {
+		return nil, wrapError(err, "Unable to remove authorized view "+g.GetPrincipal().GetId().GetResource())
+	}
+
+	l.Info("view authorization removed",
+		zap.String("dataset", g.GetEntitlement().GetResource().GetId().GetResource()),
+		zap.String("view", g.GetPrincipal().GetId().GetResource()))
+	return nil, nil
+}
+
+// authorizedViewEntry resolves the dataset of an authorized_view entitlement and the view granted to it.
+func (o *datasetBuilder) authorizedViewEntry(entitlement *v2.Entitlement, principalID *v2.ResourceId) (*bigquery.Dataset, *bigquery.Table, error) {
+	if entitlementSlug(entitlement) != authorizedViewEntitlement {
+		return nil, nil, fmt.Errorf("baton-google-bigquery: only the %s entitlement of datasets can be provisioned, got %s",
+			authorizedViewEntitlement, entitlementSlug(entitlement))
+	}
+	if principalID.GetResourceType() != viewResourceType.Id {
+		return nil, nil, fmt.Errorf("baton-google-bigquery: only views can be authorized on a dataset, got %s", principalID.GetResourceType())
+	}
+
+	dataset := entitlement.GetResource()
+	projectID, datasetID := datasetIDs(dataset.GetId(), dataset.GetParentResourceId())
+	if projectID == "" {
+		return nil, nil, fmt.Errorf("baton-google-bigquery: a project is required to provision dataset %s", dataset.GetId().GetResource())
+	}
+
+	viewProjectID, viewDatasetID, viewID := parseDatasetChildResourceID(principalID.GetResource())
+	if viewProjectID == "" || viewDatasetID == "" {
+		return nil, nil, fmt.Errorf("baton-google-bigquery: invalid view ID %s", principalID.GetResource())
+	}
+
+	return o.bigQueryClient.DatasetInProject(projectID, datasetID),
+		o.bigQueryClient.DatasetInProject(viewProjectID, viewDatasetID).Table(viewID),
+		nil
+}
+
+func isSameView(access *bigquery.AccessEntry, view *bigquery.Table) bool {
+	return access.EntityType == bigquery.ViewEntity &&
+		access.View != nil &&
+		access.View.ProjectID == view.ProjectID &&
+		access.View.DatasetID == view.DatasetID &&
+		access.View.TableID == view.TableID
 }
 
 func (o *datasetBuilder) GetEntityGrant(policy *iampb.Policy, resource *v2.Resource, access *bigquery.AccessEntry, entitlement string) ([]*v2.Grant, error) {
-	var (
-		res *v2.Resource
-		err error
-	)
-	if isUserOrServiceAccount(policy, access.Entity) {
-		res, err = userResource(access.Entity, nil, nil)
-	} else {
+	email, isServiceAccount, ok := accessEntryPrincipal(access, policy)
+	if !ok {
 		return nil, wrapError(fmt.Errorf("unknown entity type %s", access.Entity), "")
 	}
 
+	if isServiceAccount {
+		return []*v2.Grant{serviceAccountGrant(resource, entitlement, email)}, nil
+	}
+
+	res, err := userResource(email, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -350,14 +632,21 @@ func (o *datasetBuilder) GetEntityGrant(policy *iampb.Policy, resource *v2.Resou
 	}, nil
 }
 
-func (o *datasetBuilder) GetUserOwnerGrants(policy *iampb.Policy, resource *v2.Resource, access *bigquery.AccessEntry) ([]*v2.Grant, error) {
-	return o.GetEntityGrant(policy, resource, access, ownerEntitlement)
-}
-
-func newDatasetBuilder(bigQueryClient *bigquery.Client, projectsClient *resourcemanager.ProjectsClient) *datasetBuilder {
+func newDatasetBuilder(
+	bigQueryClient *bigquery.Client,
+	bigQueryService *bigqueryapi.Service,
+	projectsClient *resourcemanager.ProjectsClient,
+	backend policyBackend,
+	usage *usageReporter,
+	denials *denyEvaluator,
+) *datasetBuilder {
 	return &datasetBuilder{
-		resourceType:   datasetResourceType,
-		bigQueryClient: bigQueryClient,
-		projectsClient: projectsClient,
+		resourceType:    datasetResourceType,
+		bigQueryClient:  bigQueryClient,
+		bigQueryService: bigQueryService,
+		projectsClient:  projectsClient,
+		backend:         backend,
+		usage:           usage,
+		denials:         denials,
 	}
 }
@@ -0,0 +1,229 @@
+package connector
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func datasetTestResource(projectID string, datasetID string) *v2.Resource {
+	return &v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: datasetResourceType.Id,
+			Resource:     datasetResourceID(projectID, datasetID),
+		},
+		ParentResourceId: &v2.ResourceId{
+			ResourceType: projectResourceType.Id,
+			Resource:     projectID,
+		},
+	}
+}
+
+func TestDatasetCreate(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+
+	profile, err := structpb.NewStruct(map[string]interface{}{
+		"location": "EU",
+		"labels":   map[string]interface{}{"team": "analytics"},
+	})
+	require.NoError(t, err)
+
+	created, _, err := builder.Create(ctxTest, &v2.Resource{
+		DisplayName:      "sales",
+		ParentResourceId: &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"},
+		Profile:          profile,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "demo-project:sales", created.GetId().GetResource())
+	require.Equal(t, "demo-project", created.GetParentResourceId().GetResource())
+
+	ds := bq.dataset("demo-project", "sales")
+	require.NotNil(t, ds)
+	require.Equal(t, "EU", ds.Location)
+	require.Equal(t, map[string]string{"team": "analytics"}, ds.Labels)
+
+	_, _, err = builder.Create(ctxTest, &v2.Resource{DisplayName: "orphan"})
+	require.ErrorContains(t, err, "a parent project is required")
+
+	_, _, err = builder.Create(ctxTest, &v2.Resource{
+		DisplayName:      "sales",
+		ParentResourceId: &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"},
+	})
+	require.Error(t, err)
+}
+
+func TestDatasetDelete(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "empty")
+	bq.addDataset("demo-project", "with_table")
+	bq.addTable("demo-project", "with_table", &bigqueryapi.Table{TableReference: &bigqueryapi.TableReference{TableId: "orders"}})
+	bq.addDataset("demo-project", "with_routine")
+	bq.addRoutine("demo-project", "with_routine", "normalize")
+	bq.addDataset("demo-project", "with_model")
+	bq.addModel("demo-project", "with_model", "churn")
+
+	for datasetID, kind := range map[string]string{
+		"with_table":   "tables",
+		"with_routine": "routines",
+		"with_model":   "models",
+	} {
+		resource := datasetTestResource("demo-project", datasetID)
+		_, err := builder.Delete(ctxTest, resource.GetId(), resource.GetParentResourceId())
+		require.ErrorContains(t, err, "still holds "+kind, datasetID)
+		require.ErrorContains(t, err, deleteDatasetAction, datasetID)
+		require.NotNil(t, bq.dataset("demo-project", datasetID), datasetID)
+	}
+
+	resource := datasetTestResource("demo-project", "empty")
+	_, err := builder.Delete(ctxTest, resource.GetId(), resource.GetParentResourceId())
+	require.NoError(t, err)
+	require.Nil(t, bq.dataset("demo-project", "empty"))
+
+	_, err = builder.Delete(ctxTest, &v2.ResourceId{ResourceType: datasetResourceType.Id, Resource: "unqualified"}, nil)
+	require.ErrorContains(t, err, "a parent project is required")
+}
+
+func TestDatasetDeleteAction(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "sales")
+	bq.addTable("demo-project", "sales", &bigqueryapi.Table{TableReference: &bigqueryapi.TableReference{TableId: "orders"}})
+
+	_, _, err := builder.deleteDataset(ctxTest, datasetActionArgs(t, "demo-project:sales", nil))
+	require.ErrorContains(t, err, "still holds tables")
+	require.NotNil(t, bq.dataset("demo-project", "sales"))
+
+	rv, _, err := builder.deleteDataset(ctxTest, datasetActionArgs(t, "sales", map[string]interface{}{
+		projectActionArg:        "demo-project",
+		deleteContentsActionArg: true,
+	}))
+	require.NoError(t, err)
+	require.True(t, rv.GetFields()["success"].GetBoolValue())
+	require.Nil(t, bq.dataset("demo-project", "sales"))
+	require.Nil(t, bq.table("demo-project", "sales", "orders"))
+}
+
+func TestDatasetAccessGrants(t *testing.T) {
+	bq, iam, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "sales",
+		&bigqueryapi.DatasetAccess{Role: "READER", UserByEmail: "alice@example.com"},
+		&bigqueryapi.DatasetAccess{Role: "WRITER", UserByEmail: "etl@demo-project.iam.gserviceaccount.com"},
+		&bigqueryapi.DatasetAccess{Role: "OWNER", SpecialGroup: "projectOwners"},
+		&bigqueryapi.DatasetAccess{Role: "READER", SpecialGroup: "projectReaders"},
+		&bigqueryapi.DatasetAccess{Role: "READER", GroupByEmail: "analysts@example.com"},
+		&bigqueryapi.DatasetAccess{View: &bigqueryapi.TableReference{ProjectId: "demo-project", DatasetId: "reports", TableId: "sales_view"}},
+	)
+	iam.setPolicy("projects/demo-project", &iampb.Policy{
+		Etag: []byte("1"),
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"user:owner@example.com"}},
+		},
+	})
+	// Owners of other projects are not owners of the dataset.
+	iam.setPolicy("projects/other-project", &iampb.Policy{
+		Etag: []byte("1"),
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"user:stranger@example.com"}},
+		},
+	})
+
+	grants, _, _, err := builder.Grants(ctxTest, datasetTestResource("demo-project", "sales"), nil)
+	require.NoError(t, err)
+
+	got := make(map[string]string)
+	for _, g := range grants {
+		got[g.GetPrincipal().GetId().GetResource()] = entitlementSlug(g.GetEntitlement())
+	}
+	require.Equal(t, map[string]string{
+		"alice@example.com":                        "roles/bigquery.dataViewer",
+		"etl@demo-project.iam.gserviceaccount.com": "roles/bigquery.dataEditor",
+		"owner@example.com":                        "roles/bigquery.dataOwner",
+		"demo-project:reports.sales_view":          authorizedViewEntitlement,
+	}, got)
+
+	grants, _, _, err = builder.Grants(ctxTest, datasetTestResource("demo-project", "missing"), nil)
+	require.NoError(t, err)
+	require.Empty(t, grants)
+}
+
+func TestDatasetAuthorizedViewGrantRevoke(t *testing.T) {
+	bq, _, builder := newFakeDatasetBuilder(t)
+	bq.addDataset("demo-project", "sales",
+		&bigqueryapi.DatasetAccess{Role: "OWNER", UserByEmail: "owner@example.com"},
+	)
+
+	dataset := datasetTestResource("demo-project", "sales")
+	entitlement := ent.NewAssignmentEntitlement(dataset, authorizedViewEntitlement)
+	view := &v2.Resource{
+		Id: &v2.ResourceId{ResourceType: viewResourceType.Id, Resource: "demo-project:reports.sales_view"},
+	}
+
+	annos, err := builder.Grant(ctxTest, view, entitlement)
+	require.NoError(t, err)
+	require.False(t, annos.Contains(&v2.GrantAlreadyExists{}))
+
+	access := bq.dataset("demo-project", "sales").Access
+	require.Len(t, access, 2)
+	require.Equal(t, "owner@example.com", access[0].UserByEmail)
+	require.Equal(t, &bigqueryapi.TableReference{ProjectId: "demo-project", DatasetId: "reports", TableId: "sales_view"}, access[1].View)
+
+	annos, err = builder.Grant(ctxTest, view, entitlement)
+	require.NoError(t, err)
+	require.True(t, annos.Contains(&v2.GrantAlreadyExists{}))
+	require.Len(t, bq.dataset("demo-project", "sales").Access, 2)
+
+	g := grant.NewGrant(dataset, authorizedViewEntitlement, view.GetId())
+	annos, err = builder.Revoke(ctxTest, g)
+	require.NoError(t, err)
+	require.False(t, annos.Contains(&v2.GrantAlreadyRevoked{}))
+
+	access = bq.dataset("demo-project", "sales").Access
+	require.Len(t, access, 1)
+	require.Equal(t, "owner@example.com", access[0].UserByEmail)
+
+	annos, err = builder.Revoke(ctxTest, g)
+	require.NoError(t, err)
+	require.True(t, annos.Contains(&v2.GrantAlreadyRevoked{}))
+
+	_, err = builder.Grant(ctxTest, view, ent.NewAssignmentEntitlement(dataset, "roles/bigquery.dataViewer"))
+	require.ErrorContains(t, err, "only the authorized_view entitlement")
+
+	_, err = builder.Grant(ctxTest, &v2.Resource{
+		Id: &v2.ResourceId{ResourceType: userResourceType.Id, Resource: "alice@example.com"},
+	}, entitlement)
+	require.ErrorContains(t, err, "only views can be authorized")
+}
+
+func TestDatasetListPages(t *testing.T) {
+	bq, iam, builder := newFakeDatasetBuilder(t)
+	iam.addProject("demo-project")
+	for i := 0; i < datasetsPageSize+1; i++ {
+		bq.addDataset("demo-project", fmt.Sprintf("ds_%03d", i))
+	}
+
+	// The first call only queues the projects, each later call covers a page of datasets of one project.
+	var pages [][]*v2.Resource
+	token := ""
+	for {
+		resources, next, _, err := builder.List(ctxTest, nil, &pagination.Token{Token: token})
+		require.NoError(t, err)
+		pages = append(pages, resources)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+
+	require.Len(t, pages, 3)
+	require.Empty(t, pages[0])
+	require.Len(t, pages[1], datasetsPageSize)
+	require.Len(t, pages[2], 1)
+	require.Equal(t, fmt.Sprintf("demo-project:ds_%03d", datasetsPageSize), pages[2][0].GetId().GetResource())
+}
@@ -0,0 +1,541 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	iamadmin "cloud.google.com/go/iam/admin/apiv1"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	iamv2 "cloud.google.com/go/iam/apiv2"
+	iamv2pb "cloud.google.com/go/iam/apiv2/iampb"
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// deniedEntitlement links a deny policy to the principals its rules deny permissions to.
+	deniedEntitlement = "denied"
+
+	// deniedPermissionPrefix restricts the evaluation of deny rules to BigQuery permissions.
+	deniedPermissionPrefix = "bigquery."
+)
+
+type denyPolicyBuilder struct {
+	resourceType *v2.ResourceType
+	denials      *denyEvaluator
+}
+
+func (o *denyPolicyBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return denyPolicyResourceType
+}
+
+// List returns the deny policies attached to the parent project, folder or organization.
+func (o *denyPolicyBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	attachmentPoint := denyAttachmentPoint(parentResourceID)
+	if attachmentPoint == "" {
+		return nil, "", nil, nil
+	}
+
+	policies, err := o.denials.attachedPolicies(ctx, attachmentPoint)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	for _, policy := range policies {
+		resource, err := denyPolicyResource(policy, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create deny policy resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *denyPolicyBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(resource, deniedEntitlement,
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("Denied permissions by %s deny policy", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s deny policy %s", resource.DisplayName, deniedEntitlement)),
+		),
+	}, "", nil, nil
+}
+
+// Grants returns the users and service accounts named by the rules of the deny policy, with the BigQuery permissions
+// denied to them in the grant metadata. Groups and principal sets other than everyone are not expanded.
+func (o *denyPolicyBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var grants []*v2.Grant
+	l := ctxzap.Extract(ctx)
+	policy, err := o.denials.policy(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	permissions := make(map[string][]string)
+	var principals []string
+	for _, rule := range policy.GetRules() {
+		deny := rule.GetDenyRule()
+		for _, principal := range deny.GetDeniedPrincipals() {
+			email, ok := denyPrincipalEmail(principal)
+			if !ok {
+				l.Debug("Skipping deny policy principal that is not a user", zap.String("principal", principal))
+				continue
+			}
+			if _, ok := permissions[email]; !ok {
+				principals = append(principals, email)
+			}
+			permissions[email] = append(permissions[email], deny.GetDeniedPermissions()...)
+		}
+	}
+
+	for _, email := range principals {
+		g := grant.NewGrant(resource, deniedEntitlement, &v2.ResourceId{
+			ResourceType: userResourceType.Id,
+			Resource:     email,
+		})
+		if err := addGrantMetadata(g, map[string]interface{}{
+			"denied_permissions": stringsToInterfaces(permissions[email]),
+		}); err != nil {
+			l.Warn("unable to annotate deny policy grant", zap.String("grant", g.GetId()), zap.Error(err))
+		}
+		grants = append(grants, g)
+	}
+
+	return grants, "", nil, nil
+}
+
+// denyPolicyResource creates a deny policy resource. Its profile holds the attachment point and, over all rules,
+// the denied permissions and principals.
+func denyPolicyResource(policy *iamv2pb.Policy, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	name := policy.GetName()
+	policyID := name[strings.LastIndex(name, "/")+1:]
+	profile := map[string]interface{}{
+		"name":       name,
+		"policy_id":  policyID,
+		"rule_count": len(policy.GetRules()),
+	}
+
+	var deniedPermissions, deniedPrincipals, exceptionPrincipals []string
+	conditional := false
+	for _, rule := range policy.GetRules() {
+		deny := rule.GetDenyRule()
+		deniedPermissions = append(deniedPermissions, deny.GetDeniedPermissions()...)
+		deniedPrincipals = append(deniedPrincipals, deny.GetDeniedPrincipals()...)
+		exceptionPrincipals = append(exceptionPrincipals, deny.GetExceptionPrincipals()...)
+		if deny.GetDenialCondition() != nil {
+			conditional = true
+		}
+	}
+	profile["denied_permissions"] = stringsToInterfaces(deniedPermissions)
+	profile["denied_principals"] = stringsToInterfaces(deniedPrincipals)
+	if len(exceptionPrincipals) > 0 {
+		profile["exception_principals"] = stringsToInterfaces(exceptionPrincipals)
+	}
+	profile["conditional"] = conditional
+	addLifecycleProfileFields(profile, policy.GetCreateTime(), policy.GetUpdateTime(), policy.GetDeleteTime())
+
+	displayName := policy.GetDisplayName()
+	if displayName == "" {
+		displayName = policyID
+	}
+
+	return rs.NewResource(
+		displayName,
+		denyPolicyResourceType,
+		name,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+// denyAttachmentPoint returns the URL-encoded attachment point under which the deny policies of a project, folder or
+// organization are listed.
+func denyAttachmentPoint(resourceID *v2.ResourceId) string {
+	var name string
+	switch resourceID.GetResourceType() {
+	case projectResourceType.Id:
+		name = "projects/" + resourceID.GetResource()
+	case folderResourceType.Id:
+		name = "folders/" + resourceID.GetResource()
+	case organizationResourceType.Id:
+		name = "organizations/" + resourceID.GetResource()
+	default:
+		return ""
+	}
+
+	return "policies/" + url.PathEscape("cloudresourcemanager.googleapis.com/"+name) + "/denypolicies"
+}
+
+// denyPrincipalEmail returns the email of a user or service account deny principal.
+func denyPrincipalEmail(principal string) (string, bool) {
+	for _, prefix := range []string{
+		"principal://goog/subject/",
+		"principal://iam.googleapis.com/projects/-/serviceAccounts/",
+	} {
+		if strings.HasPrefix(principal, prefix) {
+			return strings.TrimPrefix(principal, prefix), true
+		}
+	}
+
+	return "", false
+}
+
+// denyRuleApplies reports whether a deny rule names the user or service account, directly or as everyone, and does
+// not except it.
+func denyRuleApplies(rule *iamv2pb.DenyRule, email string) bool {
+	matches := func(principals []string) bool {
+		for _, principal := range principals {
+			if principal == "principalSet://goog/public:all" {
+				return true
+			}
+			if denied, ok := denyPrincipalEmail(principal); ok && strings.EqualFold(denied, email) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return matches(rule.GetDeniedPrincipals()) && !matches(rule.GetExceptionPrincipals())
+}
+
+// deniedPermissions returns the permissions, in the service.resource.verb form of roles, that a deny rule removes.
+// Deny rules name them as service.googleapis.com/resource.verb and may end in a wildcard.
+func deniedPermissions(rule *iamv2pb.DenyRule, permissions []string) []string {
+	var rv []string
+	for _, permission := range permissions {
+		if !strings.HasPrefix(permission, deniedPermissionPrefix) {
+			continue
+		}
+		if denyPermissionsMatch(rule.GetDeniedPermissions(), permission) && !denyPermissionsMatch(rule.GetExceptionPermissions(), permission) {
+			rv = append(rv, permission)
+		}
+	}
+
+	return rv
+}
+
+func denyPermissionsMatch(denyPermissions []string, permission string) bool {
+	for _, denyPermission := range denyPermissions {
+		service, rest, found := strings.Cut(denyPermission, "/")
+		if !found {
+			continue
+		}
+		pattern := strings.TrimSuffix(service, ".googleapis.com") + "." + rest
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(permission, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+			continue
+		}
+		if pattern == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stringsToInterfaces(values []string) []interface{} {
+	rv := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		rv = append(rv, value)
+	}
+	return rv
+}
+
+// denyEvaluator reads the deny policies attached to projects and their ancestors and the permissions of roles, to
+// find the allow grants that deny rules negate. Lookups are cached for the duration of a sync.
+type denyEvaluator struct {
+	policiesClient *iamv2.PoliciesClient
+	iamClient      *iamadmin.IamClient
+	projectsClient *resourcemanager.ProjectsClient
+	foldersClient  *resourcemanager.FoldersClient
+
+	mtx         sync.Mutex
+	policies    map[string][]*iamv2pb.Policy
+	ancestors   map[string][]*v2.ResourceId
+	permissions map[string][]string
+}
+
+func newDenyEvaluator(
+	policiesClient *iamv2.PoliciesClient,
+	iamClient *iamadmin.IamClient,
+	projectsClient *resourcemanager.ProjectsClient,
+	foldersClient *resourcemanager.FoldersClient,
+) *denyEvaluator {
+	return &denyEvaluator{
+		policiesClient: policiesClient,
+		iamClient:      iamClient,
+		projectsClient: projectsClient,
+		foldersClient:  foldersClient,
+		policies:       make(map[string][]*iamv2pb.Policy),
+		ancestors:      make(map[string][]*v2.ResourceId),
+		permissions:    make(map[string][]string),
+	}
+}
+
+// reset drops the lookups cached by the previous sync, so that a sync sees policy and role changes made since.
+func (e *denyEvaluator) reset() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.policies = make(map[string][]*iamv2pb.Policy)
+	e.ancestors = make(map[string][]*v2.ResourceId)
+	e.permissions = make(map[string][]string)
+}
+
+// attachedPolicies returns the deny policies, with their rules, attached to an attachment point. Listing only returns
+// policy metadata, each policy is read on its own.
+func (e *denyEvaluator) attachedPolicies(ctx context.Context, attachmentPoint string) ([]*iamv2pb.Policy, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if policies, ok := e.policies[attachmentPoint]; ok {
+		return policies, nil
+	}
+
+	var policies []*iamv2pb.Policy
+	it := e.policiesClient.ListPolicies(ctx, &iamv2pb.ListPoliciesRequest{
+		Parent: attachmentPoint,
+	})
+	for {
+		listed, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, wrapError(err, "Unable to fetch deny policies of "+attachmentPoint)
+			}
+			break
+		}
+
+		policy, err := e.policiesClient.GetPolicy(ctx, &iamv2pb.GetPolicyRequest{Name: listed.GetName()})
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, wrapError(err, "Unable to fetch deny policy "+listed.GetName())
+			}
+			continue
+		}
+
+		policies = append(policies, policy)
+	}
+
+	e.policies[attachmentPoint] = policies
+	return policies, nil
+}
+
+// policy returns a deny policy by name, from the cache when its attachment point was listed.
+func (e *denyEvaluator) policy(ctx context.Context, name string) (*iamv2pb.Policy, error) {
+	attachmentPoint := name[:strings.LastIndex(name, "/")]
+	policies, err := e.attachedPolicies(ctx, attachmentPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, policy := range policies {
+		if policy.GetName() == name {
+			return policy, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// projectAncestry returns the project followed by its folders and organization, closest first.
+func (e *denyEvaluator) projectAncestry(ctx context.Context, projectID string) ([]*v2.ResourceId, error) {
+	e.mtx.Lock()
+	if ancestry, ok := e.ancestors[projectID]; ok {
+		e.mtx.Unlock()
+		return ancestry, nil
+	}
+	e.mtx.Unlock()
+
+	ancestry := []*v2.ResourceId{{ResourceType: projectResourceType.Id, Resource: projectID}}
+	project, err := e.projectsClient.GetProject(ctx, &resourcemanagerpb.GetProjectRequest{
+		Name: fmt.Sprintf("projects/%s", projectID),
+	})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, wrapError(err, "Unable to fetch project "+projectID)
+		}
+	}
+
+	parent := project.GetParent()
+	for parent != "" {
+		parentID := containerResourceID(parent)
+		if parentID == nil {
+			break
+		}
+		ancestry = append(ancestry, parentID)
+		if parentID.GetResourceType() != folderResourceType.Id {
+			break
+		}
+
+		folder, err := e.foldersClient.GetFolder(ctx, &resourcemanagerpb.GetFolderRequest{Name: parent})
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, wrapError(err, "Unable to fetch folder "+parent)
+			}
+			break
+		}
+		parent = folder.GetParent()
+	}
+
+	e.mtx.Lock()
+	e.ancestors[projectID] = ancestry
+	e.mtx.Unlock()
+	return ancestry, nil
+}
+
+// rolePermissions returns the permissions included in a predefined or custom role.
+func (e *denyEvaluator) rolePermissions(ctx context.Context, role string) ([]string, error) {
+	e.mtx.Lock()
+	if permissions, ok := e.permissions[role]; ok {
+		e.mtx.Unlock()
+		return permissions, nil
+	}
+	e.mtx.Unlock()
+
+	r, err := e.iamClient.GetRole(ctx, &adminpb.GetRoleRequest{Name: role})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, wrapError(err, "Unable to fetch role "+role)
+		}
+	}
+
+	e.mtx.Lock()
+	e.permissions[role] = r.GetIncludedPermissions()
+	e.mtx.Unlock()
+	return r.GetIncludedPermissions(), nil
+}
+
+// annotateGrants adds the deny policies attached to the project or its ancestors that negate BigQuery permissions of
+// the role to the metadata of the user grants they apply to. Conditional deny rules are reported as such, their
+// condition is not evaluated.
+func (e *denyEvaluator) annotateGrants(ctx context.Context, projectID string, role string, grants []*v2.Grant) error {
+	l := ctxzap.Extract(ctx)
+	if !strings.HasPrefix(role, "roles/") && !strings.Contains(role, "/roles/") {
+		return nil
+	}
+
+	ancestry, err := e.projectAncestry(ctx, projectID)
+	if err != nil {
+		return err
+	}
+
+	var policies []*iamv2pb.Policy
+	for _, resourceID := range ancestry {
+		attached, err := e.attachedPolicies(ctx, denyAttachmentPoint(resourceID))
+		if err != nil {
+			return err
+		}
+		policies = append(policies, attached...)
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	permissions, err := e.rolePermissions(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range grants {
+		principal := g.GetPrincipal().GetId()
+		if principal.GetResourceType() != userResourceType.Id {
+			continue
+		}
+
+		denied := make(map[string]struct{})
+		var deniedBy []string
+		conditional := false
+		for _, policy := range policies {
+			negates := false
+			for _, rule := range policy.GetRules() {
+				deny := rule.GetDenyRule()
+				if !denyRuleApplies(deny, principal.GetResource()) {
+					continue
+				}
+				removed := deniedPermissions(deny, permissions)
+				if len(removed) == 0 {
+					continue
+				}
+				negates = true
+				if deny.GetDenialCondition() != nil {
+					conditional = true
+				}
+				for _, permission := range removed {
+					denied[permission] = struct{}{}
+				}
+			}
+			if negates {
+				deniedBy = append(deniedBy, policy.GetName())
+			}
+		}
+		if len(deniedBy) == 0 {
+			continue
+		}
+
+		deniedList := make([]string, 0, len(denied))
+		for permission := range denied {
+			deniedList = append(deniedList, permission)
+		}
+		sort.Strings(deniedList)
+
+		if err := addGrantMetadata(g, map[string]interface{}{
+			"denied_by":          stringsToInterfaces(deniedBy),
+			"denied_permissions": stringsToInterfaces(deniedList),
+			"denial_conditional": conditional,
+		}); err != nil {
+			l.Warn("unable to annotate grant with deny policies", zap.String("grant", g.GetId()), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// annotateDatasetGrants annotates the dataset grants of each role with the deny policies that negate it.
+func (e *denyEvaluator) annotateDatasetGrants(ctx context.Context, projectID string, grants []*v2.Grant) error {
+	var roles []string
+	byRole := make(map[string][]*v2.Grant)
+	for _, g := range grants {
+		role := entitlementSlug(g.GetEntitlement())
+		if _, ok := byRole[role]; !ok {
+			roles = append(roles, role)
+		}
+		byRole[role] = append(byRole[role], g)
+	}
+
+	for _, role := range roles {
+		if err := e.annotateGrants(ctx, projectID, role, byRole[role]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newDenyPolicyBuilder(denials *denyEvaluator) *denyPolicyBuilder {
+	return &denyPolicyBuilder{
+		resourceType: denyPolicyResourceType,
+		denials:      denials,
+	}
+}
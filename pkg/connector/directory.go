@@ -0,0 +1,227 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// directoryCustomer is the Admin SDK alias for the customer the delegated subject belongs to.
+const directoryCustomer = "my_customer"
+
+// directoryEnricher adds Cloud Identity / Workspace directory data to user principals.
+// The directory is read once per sync, on first use, through domain-wide delegation.
+type directoryEnricher struct {
+	service *admin.Service
+
+	mtx     sync.Mutex
+	loaded  bool
+	err     error
+	users   map[string]*admin.User
+	domains map[string]struct{}
+}
+
+func newDirectoryEnricher(ctx context.Context, credentialsJSON []byte, subject string) (*directoryEnricher, error) {
+	conf, err := google.JWTConfigFromJSON(credentialsJSON,
+		admin.AdminDirectoryUserReadonlyScope,
+		admin.AdminDirectoryDomainReadonlyScope,
+	)
+	if err != nil {
+		return nil, wrapError(err, "directory enrichment requires a service account key")
+	}
+	conf.Subject = subject
+
+	service, err := admin.NewService(ctx, option.WithTokenSource(conf.TokenSource(ctx)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &directoryEnricher{
+		service: service,
+	}, nil
+}
+
+// reset drops the directory read during the previous sync, the next sync reads it again.
+func (d *directoryEnricher) reset() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.loaded = false
+	d.err = nil
+	d.users = nil
+	d.domains = nil
+}
+
+// load reads the domains and users of the customer, users are keyed by primary email and aliases. A failed read is
+// kept for the rest of the sync rather than retried for every user.
+func (d *directoryEnricher) load(ctx context.Context) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if !d.loaded {
+		d.users, d.domains, d.err = d.read(ctx)
+		d.loaded = true
+	}
+
+	return d.err
+}
+
+func (d *directoryEnricher) read(ctx context.Context) (map[string]*admin.User, map[string]struct{}, error) {
+	domains := make(map[string]struct{})
+	resp, err := d.service.Domains.List(directoryCustomer).Context(ctx).Do()
+	if err != nil {
+		return nil, nil, wrapError(err, "failed to list directory domains")
+	}
+	for _, domain := range resp.Domains {
+		domains[strings.ToLower(domain.DomainName)] = struct{}{}
+		for _, alias := range domain.DomainAliases {
+			domains[strings.ToLower(alias.DomainAliasName)] = struct{}{}
+		}
+	}
+
+	users := make(map[string]*admin.User)
+	err = d.service.Users.List().
+		Customer(directoryCustomer).
+		Projection("basic").
+		MaxResults(500).
+		Pages(ctx, func(page *admin.Users) error {
+			for _, u := range page.Users {
+				users[strings.ToLower(u.PrimaryEmail)] = u
+				for _, alias := range append(u.Aliases, u.NonEditableAliases...) {
+					users[strings.ToLower(alias)] = u
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, nil, wrapError(err, "failed to list directory users")
+	}
+
+	return users, domains, nil
+}
+
+// isExternal reports whether the email belongs to a domain the customer does not own.
+func (d *directoryEnricher) isExternal(email string) bool {
+	i := strings.LastIndex(email, "@")
+	if i == NF {
+		return true
+	}
+	_, ok := d.domains[strings.ToLower(email[i+1:])]
+	return !ok
+}
+
+// annotateUser adds the directory profile of a user principal to its resource. Directory failures are logged and
+// leave the resource as is, so that a sync does not depend on the optional directory access.
+func (d *directoryEnricher) annotateUser(ctx context.Context, resource *v2.Resource) error {
+	l := ctxzap.Extract(ctx)
+	if err := d.load(ctx); err != nil {
+		l.Warn("unable to read the directory, users are not enriched", zap.Error(err))
+		return nil
+	}
+
+	trait, err := rs.GetUserTrait(resource)
+	if err != nil {
+		return err
+	}
+	if trait.GetAccountType() == v2.UserTrait_ACCOUNT_TYPE_SERVICE {
+		return nil
+	}
+
+	email := resource.GetId().GetResource()
+	fields := map[string]interface{}{
+		"external": d.isExternal(email),
+	}
+
+	u, ok := d.users[strings.ToLower(email)]
+	fields["directory_user"] = ok
+	if ok {
+		fields["suspended"] = u.Suspended
+		fields["org_unit"] = u.OrgUnitPath
+		if u.Name != nil {
+			fields["full_name"] = u.Name.FullName
+			trait.SetStructuredName(v2.UserTrait_StructuredName_builder{
+				GivenName:  u.Name.GivenName,
+				FamilyName: u.Name.FamilyName,
+			}.Build())
+			resource.SetDisplayName(u.Name.FullName)
+		}
+		if manager := directoryManager(u); manager != "" {
+			fields["manager"] = manager
+		}
+		if lastLogin, ok := directoryLastLogin(u); ok {
+			fields["last_login"] = lastLogin.Format(time.RFC3339)
+			trait.SetLastLogin(timestamppb.New(lastLogin))
+		}
+
+		if u.Suspended {
+			trait.SetStatus(v2.UserTrait_Status_builder{
+				Status:  v2.UserTrait_Status_STATUS_DISABLED,
+				Details: fmt.Sprintf("suspended in directory: %s", u.SuspensionReason),
+			}.Build())
+			resource.SetStatus(v2.Status_builder{
+				Status:  v2.Status_RESOURCE_STATUS_DISABLED,
+				Details: "suspended in directory",
+			}.Build())
+		} else {
+			trait.SetStatus(v2.UserTrait_Status_builder{
+				Status: v2.UserTrait_Status_STATUS_ENABLED,
+			}.Build())
+		}
+	}
+
+	annos := annotations.Annotations(resource.GetAnnotations())
+	annos.Update(trait)
+	resource.SetAnnotations(annos)
+
+	return addResourceProfileFields(resource, fields)
+}
+
+// directoryManager returns the email of the user's manager relation, if any.
+func directoryManager(u *admin.User) string {
+	if u.Relations == nil {
+		return ""
+	}
+
+	raw, err := json.Marshal(u.Relations)
+	if err != nil {
+		return ""
+	}
+	var relations []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &relations); err != nil {
+		return ""
+	}
+
+	for _, relation := range relations {
+		if relation.Type == "manager" {
+			return relation.Value
+		}
+	}
+
+	return ""
+}
+
+// directoryLastLogin parses the user's last login, the directory reports the unix epoch for users who never logged in.
+func directoryLastLogin(u *admin.User) (time.Time, bool) {
+	lastLogin, err := time.Parse(time.RFC3339, u.LastLoginTime)
+	if err != nil || lastLogin.Unix() <= 0 {
+		return time.Time{}, false
+	}
+
+	return lastLogin.UTC(), true
+}
@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+)
+
+func TestDirectoryAnnotateUser(t *testing.T) {
+	alice := &admin.User{
+		PrimaryEmail:     "alice@example.com",
+		Aliases:          []string{"a@example.org"},
+		Name:             &admin.UserName{FullName: "Alice Liddell", GivenName: "Alice", FamilyName: "Liddell"},
+		Suspended:        true,
+		SuspensionReason: "ADMIN",
+		OrgUnitPath:      "/Analytics",
+		LastLoginTime:    "2024-05-01T10:00:00.000Z",
+		Relations:        []interface{}{map[string]interface{}{"type": "manager", "value": "bob@example.com"}},
+	}
+	d := &directoryEnricher{
+		loaded:  true,
+		users:   map[string]*admin.User{"alice@example.com": alice, "a@example.org": alice},
+		domains: map[string]struct{}{"example.com": {}, "example.org": {}},
+	}
+
+	resource, err := userResource("a@example.org", nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, d.annotateUser(ctxTest, resource))
+
+	require.Equal(t, "Alice Liddell", resource.GetDisplayName())
+	require.Equal(t, v2.Status_RESOURCE_STATUS_DISABLED, resource.GetStatus().GetStatus())
+	profile := resource.GetProfile().GetFields()
+	require.False(t, profile["external"].GetBoolValue())
+	require.Equal(t, "/Analytics", profile["org_unit"].GetStringValue())
+	require.Equal(t, "bob@example.com", profile["manager"].GetStringValue())
+	require.Equal(t, "2024-05-01T10:00:00Z", profile["last_login"].GetStringValue())
+
+	trait, err := rs.GetUserTrait(resource)
+	require.NoError(t, err)
+	require.Equal(t, v2.UserTrait_Status_STATUS_DISABLED, trait.GetStatus().GetStatus())
+	require.Equal(t, "Liddell", trait.GetStructuredName().GetFamilyName())
+
+	guest, err := userResource("guest@partner.com", nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, d.annotateUser(ctxTest, guest))
+	require.True(t, guest.GetProfile().GetFields()["external"].GetBoolValue())
+	require.False(t, guest.GetProfile().GetFields()["directory_user"].GetBoolValue())
+}
+
+func TestDirectoryLoadOncePerSync(t *testing.T) {
+	var requests, failing atomic.Int32
+	failing.Store(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": 403, "message": "Not Authorized"}})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/domains") {
+			_ = json.NewEncoder(w).Encode(&admin.Domains2{Domains: []*admin.Domains{{DomainName: "example.com"}}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&admin.Users{Users: []*admin.User{{PrimaryEmail: "alice@example.com", OrgUnitPath: "/Analytics"}}})
+	}))
+	t.Cleanup(srv.Close)
+
+	service, err := admin.NewService(ctxTest,
+		option.WithEndpoint(srv.URL+"/"),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	require.NoError(t, err)
+	d := &directoryEnricher{service: service}
+
+	// A failed read leaves users as they are and is not retried for every user of the sync.
+	for i := 0; i < 2; i++ {
+		resource, err := userResource("alice@example.com", nil, nil)
+		require.NoError(t, err)
+		require.NoError(t, d.annotateUser(ctxTest, resource))
+		require.NotContains(t, resource.GetProfile().GetFields(), "directory_user")
+	}
+	require.Error(t, d.load(ctxTest))
+	require.Equal(t, int32(1), requests.Load())
+
+	// The next sync reads the directory again.
+	failing.Store(0)
+	d.reset()
+	resource, err := userResource("alice@example.com", nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, d.annotateUser(ctxTest, resource))
+	require.Equal(t, "/Analytics", resource.GetProfile().GetFields()["org_unit"].GetStringValue())
+	require.Equal(t, int32(3), requests.Load())
+}
@@ -0,0 +1,511 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	sdkResource "github.com/conductorone/baton-sdk/pkg/types/resource"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	auditLogFeedID          = "audit_log"
+	auditLogDefaultPageSize = 100
+	bindingDeltaActionAdd   = "ADD"
+	bindingDeltaActionDrop  = "REMOVE"
+)
+
+// auditLogMethods are the audit log methods that change access to projects, datasets and tables.
+var auditLogMethods = []string{
+	"SetIamPolicy",
+	"datasetservice.update",
+	"tableservice.setiampolicy",
+}
+
+// auditLogPayload is the subset of a google.cloud.audit.AuditLog protoPayload the feed reads.
+type auditLogPayload struct {
+	ServiceName  string `json:"serviceName"`
+	MethodName   string `json:"methodName"`
+	ResourceName string `json:"resourceName"`
+	ServiceData  struct {
+		PolicyDelta struct {
+			BindingDeltas []*bindingDelta `json:"bindingDeltas"`
+		} `json:"policyDelta"`
+	} `json:"serviceData"`
+	Metadata struct {
+		DatasetChange struct {
+			BindingDeltas []*bindingDelta `json:"bindingDeltas"`
+		} `json:"datasetChange"`
+	} `json:"metadata"`
+}
+
+type bindingDelta struct {
+	Action string `json:"action"`
+	Role   string `json:"role"`
+	Member string `json:"member"`
+}
+
+// auditLogCursor is the stream cursor handed back to the platform between ListEvents calls.
+type auditLogCursor struct {
+	// Since is the inclusive lower bound of the entries timestamps for the current query.
+	Since string `json:"since"`
+	// SinceIDs are the insert IDs of the entries at Since that were already returned. Several entries can share a
+	// timestamp, the query includes Since so that none of them is missed and these are skipped.
+	SinceIDs []string `json:"since_ids,omitempty"`
+	// Latest is the newest entry timestamp observed while paging through the current query.
+	Latest string `json:"latest,omitempty"`
+	// LatestIDs are the insert IDs of the entries at Latest.
+	LatestIDs []string `json:"latest_ids,omitempty"`
+	PageToken string   `json:"page_token,omitempty"`
+}
+
+// auditLogSource returns audit log entries at or after since, oldest first.
+type auditLogSource interface {
+	Entries(ctx context.Context, since time.Time, pageToken string, pageSize int) ([]*logging.LogEntry, string, error)
+}
+
+type cloudLoggingSource struct {
+	service       *logging.Service
+	resourceNames []string
+}
+
+func newCloudLoggingSource(service *logging.Service, resourceNames ...string) *cloudLoggingSource {
+	return &cloudLoggingSource{
+		service:       service,
+		resourceNames: resourceNames,
+	}
+}
+
+func (s *cloudLoggingSource) Entries(ctx context.Context, since time.Time, pageToken string, pageSize int) ([]*logging.LogEntry, string, error) {
+	methods := make([]string, 0, len(auditLogMethods))
+	for _, method := range auditLogMethods {
+		methods = append(methods, strconv.Quote(method))
+	}
+
+	filter := fmt.Sprintf(`protoPayload.methodName=(%s) AND timestamp>="%s"`,
+		strings.Join(methods, " OR "),
+		since.Format(time.RFC3339Nano),
+	)
+
+	resp, err := s.service.Entries.List(&logging.ListLogEntriesRequest{
+		ResourceNames: s.resourceNames,
+		Filter:        filter,
+		OrderBy:       "timestamp asc",
+		PageSize:      int64(pageSize),
+		PageToken:     pageToken,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, "", wrapError(err, "failed to list audit log entries")
+	}
+
+	return resp.Entries, resp.NextPageToken, nil
+}
+
+// fileAuditLogSource reads exported log entries from a JSON-lines file, one LogEntry per line.
+// It stands in for Cloud Logging when testing the feed locally.
+type fileAuditLogSource struct {
+	path string
+}
+
+func newFileAuditLogSource(path string) *fileAuditLogSource {
+	return &fileAuditLogSource{
+		path: path,
+	}
+}
+
+func (s *fileAuditLogSource) Entries(_ context.Context, since time.Time, pageToken string, pageSize int) ([]*logging.LogEntry, string, error) {
+	offset := 0
+	if pageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(pageToken)
+		if err != nil {
+			return nil, "", wrapError(err, "invalid audit log page token")
+		}
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, "", wrapError(err, "failed to open audit log file")
+	}
+	defer f.Close()
+
+	type timedEntry struct {
+		entry      *logging.LogEntry
+		occurredAt time.Time
+	}
+
+	var timed []timedEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		entry := &logging.LogEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			return nil, "", wrapError(err, "failed to parse audit log entry")
+		}
+
+		occurredAt, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil || occurredAt.Before(since) {
+			continue
+		}
+
+		payload, err := parseAuditLogPayload(entry)
+		if err != nil || !isAuditLogMethod(payload.MethodName) {
+			continue
+		}
+
+		timed = append(timed, timedEntry{entry: entry, occurredAt: occurredAt})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", wrapError(err, "failed to read audit log file")
+	}
+
+	sort.SliceStable(timed, func(i, j int) bool {
+		return timed[i].occurredAt.Before(timed[j].occurredAt)
+	})
+
+	entries := make([]*logging.LogEntry, 0, len(timed))
+	for _, t := range timed {
+		entries = append(entries, t.entry)
+	}
+
+	if offset >= len(entries) {
+		return nil, "", nil
+	}
+
+	end := offset + pageSize
+	if end >= len(entries) {
+		return entries[offset:], "", nil
+	}
+
+	return entries[offset:end], strconv.Itoa(end), nil
+}
+
+type auditLogFeed struct {
+	source auditLogSource
+}
+
+func newAuditLogFeed(source auditLogSource) *auditLogFeed {
+	return &auditLogFeed{
+		source: source,
+	}
+}
+
+func (f *auditLogFeed) EventFeedMetadata(_ context.Context) *v2.EventFeedMetadata {
+	return &v2.EventFeedMetadata{
+		Id: auditLogFeedID,
+		SupportedEventTypes: []v2.EventType{
+			v2.EventType_EVENT_TYPE_CREATE_GRANT,
+			v2.EventType_EVENT_TYPE_CREATE_REVOKE,
+			v2.EventType_EVENT_TYPE_RESOURCE_CHANGE,
+		},
+	}
+}
+
+// ListEvents pages through the audit log entries newer than the cursor and turns them into baton events.
+func (f *auditLogFeed) ListEvents(ctx context.Context, earliestEvent *timestamppb.Timestamp, pToken *pagination.StreamToken) ([]*v2.Event, *pagination.StreamState, annotations.Annotations, error) {
+	cursor := &auditLogCursor{}
+	if pToken.Cursor != "" {
+		if err := json.Unmarshal([]byte(pToken.Cursor), cursor); err != nil {
+			return nil, nil, nil, wrapError(err, "invalid audit log cursor")
+		}
+	}
+
+	since := time.Now()
+	if earliestEvent != nil {
+		since = earliestEvent.AsTime()
+	}
+	if cursor.Since != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, cursor.Since)
+		if err != nil {
+			return nil, nil, nil, wrapError(err, "invalid audit log cursor")
+		}
+	}
+
+	pageSize := pToken.Size
+	if pageSize <= 0 {
+		pageSize = auditLogDefaultPageSize
+	}
+
+	entries, nextPageToken, err := f.source.Entries(ctx, since, cursor.PageToken, pageSize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var latest time.Time
+	if cursor.Latest != "" {
+		latest, err = time.Parse(time.RFC3339Nano, cursor.Latest)
+		if err != nil {
+			return nil, nil, nil, wrapError(err, "invalid audit log cursor")
+		}
+	}
+
+	sinceIDs := make(map[string]struct{}, len(cursor.SinceIDs))
+	for _, id := range cursor.SinceIDs {
+		sinceIDs[id] = struct{}{}
+	}
+	latestIDs := cursor.LatestIDs
+
+	var events []*v2.Event
+	for _, entry := range entries {
+		entryEvents, occurredAt, err := auditLogEntryEvents(entry)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if occurredAt.Equal(since) {
+			if _, ok := sinceIDs[entry.InsertId]; ok {
+				continue
+			}
+		}
+		events = append(events, entryEvents...)
+
+		switch {
+		case occurredAt.After(latest):
+			latest = occurredAt
+			latestIDs = []string{entry.InsertId}
+		case occurredAt.Equal(latest):
+			latestIDs = append(latestIDs, entry.InsertId)
+		}
+	}
+
+	next := &auditLogCursor{
+		Since:     since.Format(time.RFC3339Nano),
+		SinceIDs:  cursor.SinceIDs,
+		PageToken: nextPageToken,
+	}
+	if !latest.IsZero() {
+		next.Latest = latest.Format(time.RFC3339Nano)
+		next.LatestIDs = latestIDs
+	}
+	if nextPageToken == "" && !latest.IsZero() {
+		// The query is exhausted, the next poll starts at the newest entry seen, skipping the entries already
+		// returned at that time.
+		next = &auditLogCursor{
+			Since:    latest.Format(time.RFC3339Nano),
+			SinceIDs: latestIDs,
+		}
+		if latest.Equal(since) {
+			next.SinceIDs = append(next.SinceIDs, cursor.SinceIDs...)
+		}
+	}
+
+	nextCursor, err := json.Marshal(next)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return events, &pagination.StreamState{
+		Cursor:  string(nextCursor),
+		HasMore: nextPageToken != "",
+	}, nil, nil
+}
+
+func isAuditLogMethod(method string) bool {
+	for _, m := range auditLogMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseAuditLogPayload(entry *logging.LogEntry) (*auditLogPayload, error) {
+	payload := &auditLogPayload{}
+	if len(entry.ProtoPayload) == 0 {
+		return payload, nil
+	}
+
+	if err := json.Unmarshal(entry.ProtoPayload, payload); err != nil {
+		return nil, wrapError(err, fmt.Sprintf("failed to parse audit log payload of entry %s", entry.InsertId))
+	}
+
+	return payload, nil
+}
+
+// auditLogEntryEvents converts a single audit log entry into baton events.
+// Project policy and dataset access changes become grant and revoke events on the project roles and dataset
+// entitlements. Other dataset and table changes mark the dataset as changed so that it is synced again.
+func auditLogEntryEvents(entry *logging.LogEntry) ([]*v2.Event, time.Time, error) {
+	payload, err := parseAuditLogPayload(entry)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	occurredAt, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	if err != nil {
+		return nil, time.Time{}, wrapError(err, fmt.Sprintf("invalid timestamp on audit log entry %s", entry.InsertId))
+	}
+
+	projectID, datasetID := parseResourceName(payload.ResourceName)
+	if projectID == "" {
+		return nil, occurredAt, nil
+	}
+
+	projectResourceID := &v2.ResourceId{
+		ResourceType: projectResourceType.Id,
+		Resource:     projectID,
+	}
+
+	if datasetID != "" {
+		dataset := &v2.Resource{
+			Id: &v2.ResourceId{
+				ResourceType: datasetResourceType.Id,
+				Resource:     datasetResourceID(projectID, datasetID),
+			},
+			ParentResourceId: projectResourceID,
+		}
+		datasetChange := &v2.Event{
+			Id:         entry.InsertId,
+			OccurredAt: timestamppb.New(occurredAt),
+			Event: &v2.Event_ResourceChangeEvent{
+				ResourceChangeEvent: &v2.ResourceChangeEvent{
+					ResourceId:       dataset.Id,
+					ParentResourceId: projectResourceID,
+				},
+			},
+		}
+
+		// Table policies and dataset changes without access deltas are resynced with the dataset.
+		deltas := payload.Metadata.DatasetChange.BindingDeltas
+		if isTableResourceName(payload.ResourceName) || len(deltas) == 0 {
+			return []*v2.Event{datasetChange}, occurredAt, nil
+		}
+
+		events, complete, err := bindingDeltaEvents(entry, occurredAt, deltas, func(role string) (*v2.Entitlement, error) {
+			slug, ok := datasetRoleEntitlement(role)
+			if !ok {
+				return nil, nil
+			}
+			return ent.NewAssignmentEntitlement(dataset, slug), nil
+		})
+		if err != nil {
+			return nil, occurredAt, err
+		}
+		if !complete {
+			// Deltas on groups, domains or unknown roles are not expressible as grants, the dataset is resynced.
+			events = append(events, datasetChange)
+		}
+
+		return events, occurredAt, nil
+	}
+
+	deltas := payload.ServiceData.PolicyDelta.BindingDeltas
+	if len(deltas) == 0 {
+		return []*v2.Event{
+			{
+				Id:         entry.InsertId,
+				OccurredAt: timestamppb.New(occurredAt),
+				Event: &v2.Event_ResourceChangeEvent{
+					ResourceChangeEvent: &v2.ResourceChangeEvent{
+						ResourceId: projectResourceID,
+					},
+				},
+			},
+		}, occurredAt, nil
+	}
+
+	events, _, err := bindingDeltaEvents(entry, occurredAt, deltas, func(role string) (*v2.Entitlement, error) {
+		resource, err := roleResource(role, projectResourceID)
+		if err != nil {
+			return nil, wrapError(err, "failed to create role resource")
+		}
+		return ent.NewAssignmentEntitlement(resource, assignedEntitlement), nil
+	})
+	if err != nil {
+		return nil, occurredAt, err
+	}
+
+	return events, occurredAt, nil
+}
+
+// bindingDeltaEvents turns the binding deltas of an audit log entry into grant and revoke events of the users and
+// service accounts, on the entitlement of their role. It reports false when some deltas could not be converted:
+// members other than users and service accounts, or roles without entitlement.
+func bindingDeltaEvents(
+	entry *logging.LogEntry,
+	occurredAt time.Time,
+	deltas []*bindingDelta,
+	roleEntitlement func(role string) (*v2.Entitlement, error),
+) ([]*v2.Event, bool, error) {
+	complete := true
+	var events []*v2.Event
+	for i, delta := range deltas {
+		isMember, email := isUserOrServiceAccountMember(delta.Member)
+		if !isMember {
+			complete = false
+			continue
+		}
+
+		entitlement, err := roleEntitlement(delta.Role)
+		if err != nil {
+			return nil, false, err
+		}
+		if entitlement == nil {
+			complete = false
+			continue
+		}
+
+		var accountTrait sdkResource.UserTraitOption
+		if isSA, _ := isServiceAccount(delta.Member); isSA {
+			accountTrait = sdkResource.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE)
+		}
+
+		principal, err := userResource(email, nil, accountTrait)
+		if err != nil {
+			return nil, false, wrapError(err, "failed to create user resource")
+		}
+
+		event := &v2.Event{
+			Id:         fmt.Sprintf("%s-%d", entry.InsertId, i),
+			OccurredAt: timestamppb.New(occurredAt),
+		}
+		switch delta.Action {
+		case bindingDeltaActionAdd:
+			event.Event = &v2.Event_CreateGrantEvent{
+				CreateGrantEvent: &v2.CreateGrantEvent{
+					Entitlement: entitlement,
+					Principal:   principal,
+				},
+			}
+		case bindingDeltaActionDrop:
+			event.Event = &v2.Event_CreateRevokeEvent{
+				CreateRevokeEvent: &v2.CreateRevokeEvent{
+					Entitlement: entitlement,
+					Principal:   principal,
+				},
+			}
+		default:
+			complete = false
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	return events, complete, nil
+}
+
+// isTableResourceName reports whether an audit log resource name is a table, projects/P/datasets/D/tables/T.
+func isTableResourceName(resourceName string) bool {
+	parts := strings.Split(resourceName, "/")
+	return len(parts) >= 6 && parts[4] == "tables"
+}
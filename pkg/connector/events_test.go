@@ -0,0 +1,93 @@
+package connector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const auditLogFixture = `{"insertId":"a1","timestamp":"2024-05-01T10:00:00Z","protoPayload":{"serviceName":"cloudresourcemanager.googleapis.com","methodName":"SetIamPolicy","resourceName":"projects/demo-project","serviceData":{"policyDelta":{"bindingDeltas":[{"action":"ADD","role":"roles/bigquery.dataViewer","member":"user:alice@example.com"},{"action":"REMOVE","role":"roles/bigquery.admin","member":"serviceAccount:etl@demo-project.iam.gserviceaccount.com"},{"action":"ADD","role":"roles/viewer","member":"group:analysts@example.com"}]}}}}
+{"insertId":"a2","timestamp":"2024-05-01T10:05:00.5Z","protoPayload":{"serviceName":"bigquery.googleapis.com","methodName":"datasetservice.update","resourceName":"projects/demo-project/datasets/sales"}}
+{"insertId":"a3","timestamp":"2024-05-01T10:06:00Z","protoPayload":{"serviceName":"bigquery.googleapis.com","methodName":"jobservice.insert","resourceName":"projects/demo-project/jobs/1"}}
+{"insertId":"a4","timestamp":"2024-05-01T10:07:00Z","protoPayload":{"serviceName":"bigquery.googleapis.com","methodName":"tableservice.setiampolicy","resourceName":"projects/demo-project/datasets/sales/tables/orders"}}
+{"insertId":"a5","timestamp":"2024-05-01T10:07:00Z","protoPayload":{"serviceName":"bigquery.googleapis.com","methodName":"datasetservice.update","resourceName":"projects/demo-project/datasets/sales","metadata":{"datasetChange":{"bindingDeltas":[{"action":"ADD","role":"roles/bigquery.dataViewer","member":"user:bob@example.com"},{"action":"REMOVE","role":"roles/bigquery.dataEditor","member":"group:analysts@example.com"}]}}}}
+`
+
+// auditLogLateFixture is an entry logged after the first poll with the timestamp of the last entries seen.
+const auditLogLateFixture = `{"insertId":"a6","timestamp":"2024-05-01T10:07:00Z","protoPayload":{"serviceName":"bigquery.googleapis.com","methodName":"datasetservice.update","resourceName":"projects/demo-project/datasets/sales","metadata":{"datasetChange":{"bindingDeltas":[{"action":"REMOVE","role":"READER","member":"user:bob@example.com"}]}}}}
+`
+
+func TestAuditLogFeedFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(auditLogFixture), 0600))
+
+	feed := newAuditLogFeed(newFileAuditLogSource(path))
+	start := timestamppb.New(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+
+	events, state, _, err := feed.ListEvents(ctxTest, start, &pagination.StreamToken{Size: 2})
+	require.NoError(t, err)
+	require.True(t, state.HasMore)
+	require.Len(t, events, 3)
+
+	grantEvent := events[0].GetCreateGrantEvent()
+	require.NotNil(t, grantEvent)
+	require.Equal(t, "alice@example.com", grantEvent.GetPrincipal().GetId().GetResource())
+	require.Equal(t, "role:roles/bigquery.dataViewer:assigned", grantEvent.GetEntitlement().GetId())
+
+	revokeEvent := events[1].GetCreateRevokeEvent()
+	require.NotNil(t, revokeEvent)
+	require.Equal(t, "etl@demo-project.iam.gserviceaccount.com", revokeEvent.GetPrincipal().GetId().GetResource())
+
+	changeEvent := events[2].GetResourceChangeEvent()
+	require.NotNil(t, changeEvent)
+	require.Equal(t, datasetResourceType.Id, changeEvent.GetResourceId().GetResourceType())
+	require.Equal(t, "demo-project:sales", changeEvent.GetResourceId().GetResource())
+
+	events, state, _, err = feed.ListEvents(ctxTest, start, &pagination.StreamToken{Size: 2, Cursor: state.Cursor})
+	require.NoError(t, err)
+	require.False(t, state.HasMore)
+	require.Len(t, events, 3)
+	require.Equal(t, "demo-project:sales", events[0].GetResourceChangeEvent().GetResourceId().GetResource())
+
+	// Dataset access deltas are granted on the dataset entitlement, the group delta resyncs the dataset.
+	datasetGrant := events[1].GetCreateGrantEvent()
+	require.NotNil(t, datasetGrant)
+	require.Equal(t, "bob@example.com", datasetGrant.GetPrincipal().GetId().GetResource())
+	require.Equal(t, "dataset:demo-project:sales:roles/bigquery.dataViewer", datasetGrant.GetEntitlement().GetId())
+	require.Equal(t, "demo-project:sales", events[2].GetResourceChangeEvent().GetResourceId().GetResource())
+
+	events, state, _, err = feed.ListEvents(ctxTest, start, &pagination.StreamToken{Size: 2, Cursor: state.Cursor})
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	// An entry sharing the timestamp of the last ones seen is still returned, the others are not repeated.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(auditLogLateFixture)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	events, state, _, err = feed.ListEvents(ctxTest, start, &pagination.StreamToken{Size: 2, Cursor: state.Cursor})
+	require.NoError(t, err)
+	require.Empty(t, events)
+	require.True(t, state.HasMore)
+
+	events, _, _, err = feed.ListEvents(ctxTest, start, &pagination.StreamToken{Size: 2, Cursor: state.Cursor})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	revokeEvent = events[0].GetCreateRevokeEvent()
+	require.NotNil(t, revokeEvent)
+	require.Equal(t, "dataset:demo-project:sales:roles/bigquery.dataViewer", revokeEvent.GetEntitlement().GetId())
+}
+
+func TestAuditLogFeedMetadata(t *testing.T) {
+	md := newAuditLogFeed(nil).EventFeedMetadata(ctxTest)
+	require.NoError(t, md.Validate())
+	require.Contains(t, md.GetSupportedEventTypes(), v2.EventType_EVENT_TYPE_CREATE_GRANT)
+}
@@ -0,0 +1,1433 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	analyticshub "cloud.google.com/go/bigquery/analyticshub/apiv1"
+	"cloud.google.com/go/bigquery/analyticshub/apiv1/analyticshubpb"
+	connection "cloud.google.com/go/bigquery/connection/apiv1"
+	"cloud.google.com/go/bigquery/connection/apiv1/connectionpb"
+	"cloud.google.com/go/bigquery/datapolicies/apiv1/datapoliciespb"
+	datatransfer "cloud.google.com/go/bigquery/datatransfer/apiv1"
+	"cloud.google.com/go/bigquery/datatransfer/apiv1/datatransferpb"
+	reservation "cloud.google.com/go/bigquery/reservation/apiv1"
+	"cloud.google.com/go/bigquery/reservation/apiv1/reservationpb"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	cloudasset "google.golang.org/api/cloudasset/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// fakeBigQuery serves, from memory, the BigQuery REST endpoints used to manage datasets, their access lists and the
+// tables, routines and models they hold.
+type fakeBigQuery struct {
+	mtx      sync.Mutex
+	datasets map[string]*bigqueryapi.Dataset
+	tables   map[string]map[string]*bigqueryapi.Table
+	routines map[string][]string
+	models   map[string][]string
+	// routinePolicies holds the IAM policies of routines, by routine resource ID.
+	routinePolicies map[string]*bigqueryapi.Policy
+	// listErr fails the routine and model lists from page listErrPage on, the lists serve an item per page.
+	listErr     error
+	listErrPage int
+	// failPatch makes dataset updates fail.
+	failPatch bool
+	// failTableDelete makes table deletions fail.
+	failTableDelete bool
+	// query answers every query job, queries fail without it. Its next pages fail.
+	query   *bigqueryapi.QueryResponse
+	queries int
+}
+
+// newFakeBigQuery starts a fake BigQuery and returns the client library and REST clients pointed at it.
+func newFakeBigQuery(t *testing.T) (*fakeBigQuery, *bigquery.Client, *bigqueryapi.Service) {
+	f := &fakeBigQuery{
+		datasets: make(map[string]*bigqueryapi.Dataset),
+		tables:   make(map[string]map[string]*bigqueryapi.Table),
+		routines: make(map[string][]string),
+		models:   make(map[string][]string),
+
+		routinePolicies: make(map[string]*bigqueryapi.Policy),
+	}
+	srv := httptest.NewServer(http.StripPrefix("/bigquery/v2/projects/", http.HandlerFunc(f.serveHTTP)))
+	t.Cleanup(srv.Close)
+
+	opts := []option.ClientOption{
+		option.WithEndpoint(srv.URL + "/bigquery/v2/"),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	}
+	client, err := bigquery.NewClient(ctxTest, "demo-project", opts...)
+	require.NoError(t, err)
+	service, err := bigqueryapi.NewService(ctxTest, opts...)
+	require.NoError(t, err)
+
+	return f, client, service
+}
+
+// addDataset stores a dataset with the given access list.
+func (f *fakeBigQuery) addDataset(projectID string, datasetID string, access ...*bigqueryapi.DatasetAccess) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.datasets[datasetResourceID(projectID, datasetID)] = &bigqueryapi.Dataset{
+		DatasetReference: &bigqueryapi.DatasetReference{ProjectId: projectID, DatasetId: datasetID},
+		Access:           access,
+		Etag:             "1",
+	}
+}
+
+func (f *fakeBigQuery) dataset(projectID string, datasetID string) *bigqueryapi.Dataset {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.datasets[datasetResourceID(projectID, datasetID)]
+}
+
+func (f *fakeBigQuery) table(projectID string, datasetID string, tableID string) *bigqueryapi.Table {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.tables[datasetResourceID(projectID, datasetID)][tableID]
+}
+
+func (f *fakeBigQuery) addTable(projectID string, datasetID string, table *bigqueryapi.Table) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	key := datasetResourceID(projectID, datasetID)
+	if f.tables[key] == nil {
+		f.tables[key] = make(map[string]*bigqueryapi.Table)
+	}
+	table.TableReference = &bigqueryapi.TableReference{ProjectId: projectID, DatasetId: datasetID, TableId: table.TableReference.TableId}
+	f.tables[key][table.TableReference.TableId] = table
+}
+
+func (f *fakeBigQuery) addRoutine(projectID string, datasetID string, routineID string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	key := datasetResourceID(projectID, datasetID)
+	f.routines[key] = append(f.routines[key], routineID)
+}
+
+func (f *fakeBigQuery) addModel(projectID string, datasetID string, modelID string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	key := datasetResourceID(projectID, datasetID)
+	f.models[key] = append(f.models[key], modelID)
+}
+
+func (f *fakeBigQuery) setRoutinePolicy(projectID string, datasetID string, routineID string, policy *bigqueryapi.Policy) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.routinePolicies[datasetChildResourceID(projectID, datasetID, routineID)] = policy
+}
+
+func (f *fakeBigQuery) setListError(err error, page int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.listErr = err
+	f.listErrPage = page
+}
+
+func (f *fakeBigQuery) setFailPatch(fail bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.failPatch = fail
+}
+
+func (f *fakeBigQuery) setFailTableDelete(fail bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.failTableDelete = fail
+}
+
+// setQueryResults makes every query return the rows. With more set the results have a next page, and reading it
+// fails.
+func (f *fakeBigQuery) setQueryResults(schema *bigqueryapi.TableSchema, rows []*bigqueryapi.TableRow, more bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.query = &bigqueryapi.QueryResponse{
+		JobComplete:  true,
+		JobReference: &bigqueryapi.JobReference{ProjectId: "demo-project", JobId: "job-1"},
+		Schema:       schema,
+		Rows:         rows,
+		TotalRows:    uint64(len(rows)),
+	}
+	if more {
+		f.query.PageToken = "1"
+		f.query.TotalRows++
+	}
+}
+
+func (f *fakeBigQuery) queryCount() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.queries
+}
+
+// hasConditionalAccess reports whether the dataset access list holds conditional entries, which can only be read
+// and written with an access policy version 3.
+func hasConditionalAccess(access []*bigqueryapi.DatasetAccess) bool {
+	for _, entry := range access {
+		if entry.Condition != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// serveHTTP routes projects/{project}/datasets[/{dataset}[/{collection}[/{id}]]].
+func (f *fakeBigQuery) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	parts := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+	if len(parts) >= 2 && parts[1] == "queries" {
+		f.serveQuery(w, r, parts[2:])
+		return
+	}
+	if len(parts) < 2 || parts[1] != "datasets" {
+		writeFakeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+	projectID := parts[0]
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		var keys []string
+		for key, ds := range f.datasets {
+			if ds.DatasetReference.ProjectId == projectID {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		// Pages hold maxResults datasets, the page token is the offset of the page.
+		offset, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+		keys = keys[min(offset, len(keys)):]
+		resp := &bigqueryapi.DatasetList{}
+		if maxResults, _ := strconv.Atoi(r.URL.Query().Get("maxResults")); maxResults > 0 && maxResults < len(keys) {
+			keys = keys[:maxResults]
+			resp.NextPageToken = strconv.Itoa(offset + maxResults)
+		}
+		for _, key := range keys {
+			resp.Datasets = append(resp.Datasets, &bigqueryapi.DatasetListDatasets{
+				DatasetReference: f.datasets[key].DatasetReference,
+				Id:               key,
+			})
+		}
+		writeFakeJSON(w, resp)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		ds := &bigqueryapi.Dataset{}
+		if err := json.NewDecoder(r.Body).Decode(ds); err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		key := datasetResourceID(projectID, ds.DatasetReference.DatasetId)
+		if _, ok := f.datasets[key]; ok {
+			writeFakeError(w, http.StatusConflict, "Already Exists: Dataset "+key)
+			return
+		}
+		ds.Etag = "1"
+		f.datasets[key] = ds
+		writeFakeJSON(w, ds)
+	case len(parts) >= 3:
+		f.serveDataset(w, r, projectID, parts[2], parts[3:])
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, r.Method+" "+r.URL.Path)
+	}
+}
+
+// serveQuery runs a query job, or reads the next page of its results.
+func (f *fakeBigQuery) serveQuery(w http.ResponseWriter, r *http.Request, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		f.queries++
+		if f.query == nil {
+			writeFakeError(w, http.StatusBadRequest, "query failed")
+			return
+		}
+		writeFakeJSON(w, f.query)
+	default:
+		writeFakeError(w, http.StatusBadRequest, "reading query results failed")
+	}
+}
+
+func (f *fakeBigQuery) serveDataset(w http.ResponseWriter, r *http.Request, projectID string, datasetID string, rest []string) {
+	key := datasetResourceID(projectID, datasetID)
+	ds, ok := f.datasets[key]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Not found: Dataset "+key)
+		return
+	}
+
+	if len(rest) > 0 {
+		f.serveDatasetContents(w, r, projectID, datasetID, rest)
+		return
+	}
+
+	if (r.Method == http.MethodGet || r.Method == http.MethodPatch) &&
+		hasConditionalAccess(ds.Access) && r.URL.Query().Get("accessPolicyVersion") != "3" {
+		writeFakeError(w, http.StatusBadRequest, "Dataset "+key+" has conditional access entries, accessPolicyVersion 3 is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeFakeJSON(w, ds)
+	case http.MethodPatch:
+		if f.failPatch {
+			writeFakeError(w, http.StatusBadRequest, "dataset update failed")
+			return
+		}
+		if etag := r.Header.Get("If-Match"); etag != "" && etag != ds.Etag {
+			writeFakeError(w, http.StatusPreconditionFailed, "Precondition check failed.")
+			return
+		}
+
+		// An access list emptied by the update is sent as null.
+		var patch map[string]json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if access, ok := patch["access"]; ok {
+			ds.Access = nil
+			if err := json.Unmarshal(access, &ds.Access); err != nil {
+				writeFakeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		var labels map[string]*string
+		if err := json.Unmarshal(patch["labels"], &labels); patch["labels"] != nil && err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for label, value := range labels {
+			if value == nil {
+				delete(ds.Labels, label)
+				continue
+			}
+			if ds.Labels == nil {
+				ds.Labels = make(map[string]string)
+			}
+			ds.Labels[label] = *value
+		}
+
+		etag, _ := strconv.Atoi(ds.Etag)
+		ds.Etag = strconv.Itoa(etag + 1)
+		writeFakeJSON(w, ds)
+	case http.MethodDelete:
+		if r.URL.Query().Get("deleteContents") != "true" &&
+			(len(f.tables[key]) > 0 || len(f.routines[key]) > 0 || len(f.models[key]) > 0) {
+			writeFakeError(w, http.StatusBadRequest, "Dataset "+key+" is still in use")
+			return
+		}
+		delete(f.datasets, key)
+		delete(f.tables, key)
+		delete(f.routines, key)
+		delete(f.models, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusMethodNotAllowed, r.Method+" "+r.URL.Path)
+	}
+}
+
+func (f *fakeBigQuery) serveDatasetContents(w http.ResponseWriter, r *http.Request, projectID string, datasetID string, rest []string) {
+	key := datasetResourceID(projectID, datasetID)
+	switch {
+	case rest[0] == "routines" && len(rest) == 1:
+		routines := f.routines[key]
+		i, next, err := fakePage(len(routines), r.URL.Query().Get("pageToken"), f.listErr, f.listErrPage)
+		if err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resp := &bigqueryapi.ListRoutinesResponse{NextPageToken: next}
+		if len(routines) > 0 {
+			resp.Routines = append(resp.Routines, &bigqueryapi.Routine{
+				RoutineReference: &bigqueryapi.RoutineReference{ProjectId: projectID, DatasetId: datasetID, RoutineId: routines[i]},
+			})
+		}
+		writeFakeJSON(w, resp)
+	case rest[0] == "routines" && len(rest) == 2 && strings.HasSuffix(rest[1], ":getIamPolicy"):
+		routineID := strings.TrimSuffix(rest[1], ":getIamPolicy")
+		policy, ok := f.routinePolicies[datasetChildResourceID(projectID, datasetID, routineID)]
+		if !ok {
+			policy = &bigqueryapi.Policy{}
+		}
+		writeFakeJSON(w, policy)
+	case rest[0] == "routines" && len(rest) == 2:
+		if !slices.Contains(f.routines[key], rest[1]) {
+			writeFakeError(w, http.StatusNotFound, "Not found: Routine "+rest[1])
+			return
+		}
+		writeFakeJSON(w, &bigqueryapi.Routine{
+			RoutineReference: &bigqueryapi.RoutineReference{ProjectId: projectID, DatasetId: datasetID, RoutineId: rest[1]},
+			RoutineType:      "SCALAR_FUNCTION",
+			Language:         "SQL",
+		})
+	case rest[0] == "models" && len(rest) == 1:
+		models := f.models[key]
+		i, next, err := fakePage(len(models), r.URL.Query().Get("pageToken"), f.listErr, f.listErrPage)
+		if err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resp := &bigqueryapi.ListModelsResponse{NextPageToken: next}
+		if len(models) > 0 {
+			resp.Models = append(resp.Models, &bigqueryapi.Model{
+				ModelReference: &bigqueryapi.ModelReference{ProjectId: projectID, DatasetId: datasetID, ModelId: models[i]},
+			})
+		}
+		writeFakeJSON(w, resp)
+	case rest[0] == "models" && len(rest) == 2:
+		if !slices.Contains(f.models[key], rest[1]) {
+			writeFakeError(w, http.StatusNotFound, "Not found: Model "+rest[1])
+			return
+		}
+		writeFakeJSON(w, &bigqueryapi.Model{
+			ModelReference: &bigqueryapi.ModelReference{ProjectId: projectID, DatasetId: datasetID, ModelId: rest[1]},
+			ModelType:      "LINEAR_REGRESSION",
+			Location:       "US",
+		})
+	case rest[0] == "tables" && len(rest) == 1 && r.Method == http.MethodGet:
+		var ids []string
+		for id := range f.tables[key] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		resp := &bigqueryapi.TableList{TotalItems: int64(len(ids))}
+		for _, id := range ids {
+			resp.Tables = append(resp.Tables, &bigqueryapi.TableListTables{
+				TableReference: f.tables[key][id].TableReference,
+				Type:           "TABLE",
+			})
+		}
+		writeFakeJSON(w, resp)
+	case rest[0] == "tables" && len(rest) == 1 && r.Method == http.MethodPost:
+		table := &bigqueryapi.Table{}
+		if err := json.NewDecoder(r.Body).Decode(table); err != nil {
+			writeFakeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := f.tables[key][table.TableReference.TableId]; ok {
+			writeFakeError(w, http.StatusConflict, "Already Exists: Table "+table.TableReference.TableId)
+			return
+		}
+		if f.tables[key] == nil {
+			f.tables[key] = make(map[string]*bigqueryapi.Table)
+		}
+		f.tables[key][table.TableReference.TableId] = table
+		writeFakeJSON(w, table)
+	case rest[0] == "tables" && len(rest) == 2:
+		table, ok := f.tables[key][rest[1]]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "Not found: Table "+rest[1])
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeFakeJSON(w, table)
+		case http.MethodDelete:
+			if f.failTableDelete {
+				writeFakeError(w, http.StatusBadRequest, "table deletion failed")
+				return
+			}
+			delete(f.tables[key], rest[1])
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeFakeError(w, http.StatusMethodNotAllowed, r.Method+" "+r.URL.Path)
+		}
+	default:
+		writeFakeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	}
+}
+
+func writeFakeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeFakeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
+
+// fakeCloudAsset serves the Cloud Asset Inventory searches of a scope from memory, and counts them.
+type fakeCloudAsset struct {
+	mtx       sync.Mutex
+	resources []*cloudasset.ResourceSearchResult
+	searches  int
+}
+
+// newFakeCloudAsset starts a fake Cloud Asset Inventory and returns the client pointed at it.
+func newFakeCloudAsset(t *testing.T) (*fakeCloudAsset, *cloudasset.Service) {
+	f := &fakeCloudAsset{}
+	srv := httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(srv.Close)
+
+	service, err := cloudasset.NewService(ctxTest,
+		option.WithEndpoint(srv.URL+"/"),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	require.NoError(t, err)
+
+	return f, service
+}
+
+// addProject adds a project to the resources of the scope.
+func (f *fakeCloudAsset) addProject(projectNumber string, projectID string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.resources = append(f.resources, &cloudasset.ResourceSearchResult{
+		AssetType:            projectAssetType,
+		Name:                 "//cloudresourcemanager.googleapis.com/projects/" + projectNumber,
+		Project:              "projects/" + projectNumber,
+		AdditionalAttributes: []byte(fmt.Sprintf(`{"projectId":%q}`, projectID)),
+	})
+}
+
+func (f *fakeCloudAsset) searchCount() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.searches
+}
+
+func (f *fakeCloudAsset) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, ":searchAllResources"):
+		f.searches++
+		writeFakeJSON(w, &cloudasset.SearchAllResourcesResponse{Results: f.resources})
+	case strings.HasSuffix(r.URL.Path, ":searchAllIamPolicies"):
+		writeFakeJSON(w, &cloudasset.SearchAllIamPoliciesResponse{})
+	default:
+		writeFakeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	}
+}
+
+// fakeIAM serves, from memory, the gRPC APIs holding IAM policies (projects and data policies) and service accounts.
+type fakeIAM struct {
+	mtx             sync.Mutex
+	projects        []*resourcemanagerpb.Project
+	folders         []*resourcemanagerpb.Folder
+	organizations   []*resourcemanagerpb.Organization
+	policies        map[string]*iampb.Policy
+	granted         map[string][]string
+	serviceAccounts map[string]*adminpb.ServiceAccount
+	keys            map[string]int
+	// failKeys makes service account key creation fail.
+	failKeys bool
+	// searchErr is returned by the project, folder and organization searches from page searchErrPage on.
+	searchErr     error
+	searchErrPage int
+}
+
+// newFakeIAM starts a fake IAM server and returns the client options that point at it.
+func newFakeIAM(t *testing.T) (*fakeIAM, []option.ClientOption) {
+	f := &fakeIAM{
+		policies:        make(map[string]*iampb.Policy),
+		granted:         make(map[string][]string),
+		serviceAccounts: make(map[string]*adminpb.ServiceAccount),
+		keys:            make(map[string]int),
+	}
+
+	return f, startFakeGRPC(t, func(srv *grpc.Server) {
+		resourcemanagerpb.RegisterProjectsServer(srv, &fakeProjectsServer{fakeIAM: f})
+		resourcemanagerpb.RegisterFoldersServer(srv, &fakeFoldersServer{fakeIAM: f})
+		resourcemanagerpb.RegisterOrganizationsServer(srv, &fakeOrganizationsServer{fakeIAM: f})
+		datapoliciespb.RegisterDataPolicyServiceServer(srv, &fakeDataPolicyServer{fakeIAM: f})
+		adminpb.RegisterIAMServer(srv, &fakeIAMAdminServer{fakeIAM: f})
+	})
+}
+
+// startFakeGRPC starts a gRPC server with the services registered by register and returns the client options that
+// point at it.
+func startFakeGRPC(t *testing.T, register func(srv *grpc.Server)) []option.ClientOption {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	register(srv)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	return []option.ClientOption{
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
+
+// fakePage serves a list of n items one per page, the page token is the index of the item. It returns the index of
+// the item to serve and the next page token, or listErr once the page listErrPage is reached.
+func fakePage(n int, pageToken string, listErr error, listErrPage int) (int, string, error) {
+	i := 0
+	if pageToken != "" {
+		i, _ = strconv.Atoi(pageToken)
+	}
+	if listErr != nil && i >= listErrPage {
+		return 0, "", listErr
+	}
+	if i+1 < n {
+		return i, strconv.Itoa(i + 1), nil
+	}
+
+	return i, "", nil
+}
+
+func (f *fakeIAM) addProject(projectID string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.projects = append(f.projects, &resourcemanagerpb.Project{
+		Name:      "projects/" + projectID,
+		ProjectId: projectID,
+		State:     resourcemanagerpb.Project_ACTIVE,
+	})
+}
+
+func (f *fakeIAM) addProjectIn(projectID string, parent string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.projects = append(f.projects, &resourcemanagerpb.Project{
+		Name:      "projects/" + projectID,
+		ProjectId: projectID,
+		Parent:    parent,
+		State:     resourcemanagerpb.Project_ACTIVE,
+	})
+}
+
+func (f *fakeIAM) addFolder(folderID string, parent string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.folders = append(f.folders, &resourcemanagerpb.Folder{
+		Name:        "folders/" + folderID,
+		DisplayName: folderID,
+		Parent:      parent,
+		State:       resourcemanagerpb.Folder_ACTIVE,
+	})
+}
+
+func (f *fakeIAM) addOrganization(organizationID string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.organizations = append(f.organizations, &resourcemanagerpb.Organization{
+		Name:        "organizations/" + organizationID,
+		DisplayName: organizationID,
+		State:       resourcemanagerpb.Organization_ACTIVE,
+	})
+}
+
+func (f *fakeIAM) setSearchError(err error, page int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.searchErr = err
+	f.searchErrPage = page
+}
+
+func (f *fakeIAM) searchPage(n int, pageToken string) (int, string, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return fakePage(n, pageToken, f.searchErr, f.searchErrPage)
+}
+
+func (f *fakeIAM) setFailKeys(fail bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.failKeys = fail
+}
+
+func (f *fakeIAM) serviceAccount(email string) *adminpb.ServiceAccount {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.serviceAccounts[email]
+}
+
+func (f *fakeIAM) setPolicy(resource string, policy *iampb.Policy) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.policies[resource] = policy
+}
+
+// setGranted sets the permissions the credentials hold on a resource.
+func (f *fakeIAM) setGranted(resource string, permissions ...string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.granted[resource] = permissions
+}
+
+func (f *fakeIAM) policy(resource string) *iampb.Policy {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return proto.Clone(f.policies[resource]).(*iampb.Policy)
+}
+
+func (f *fakeIAM) getIamPolicy(resource string) (*iampb.Policy, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	policy, ok := f.policies[resource]
+	if !ok {
+		return &iampb.Policy{Etag: []byte("1")}, nil
+	}
+
+	return proto.Clone(policy).(*iampb.Policy), nil
+}
+
+func (f *fakeIAM) setIamPolicy(resource string, policy *iampb.Policy) (*iampb.Policy, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if current, ok := f.policies[resource]; ok && string(current.Etag) != string(policy.Etag) {
+		return nil, status.Error(codes.Aborted, "etag mismatch")
+	}
+
+	stored := proto.Clone(policy).(*iampb.Policy)
+	etag, _ := strconv.Atoi(string(policy.Etag))
+	stored.Etag = []byte(strconv.Itoa(etag + 1))
+	f.policies[resource] = stored
+
+	return proto.Clone(stored).(*iampb.Policy), nil
+}
+
+// fakeProjectsServer, fakeDataPolicyServer and fakeIAMAdminServer expose the shared fakeIAM state through each
+// service; the generated servers can't be embedded together as their TestIamPermissions methods clash.
+type fakeProjectsServer struct {
+	resourcemanagerpb.UnimplementedProjectsServer
+	*fakeIAM
+}
+
+type fakeFoldersServer struct {
+	resourcemanagerpb.UnimplementedFoldersServer
+	*fakeIAM
+}
+
+type fakeOrganizationsServer struct {
+	resourcemanagerpb.UnimplementedOrganizationsServer
+	*fakeIAM
+}
+
+type fakeDataPolicyServer struct {
+	datapoliciespb.UnimplementedDataPolicyServiceServer
+	*fakeIAM
+}
+
+type fakeIAMAdminServer struct {
+	adminpb.UnimplementedIAMServer
+	*fakeIAM
+}
+
+func (f *fakeProjectsServer) SearchProjects(_ context.Context, req *resourcemanagerpb.SearchProjectsRequest) (*resourcemanagerpb.SearchProjectsResponse, error) {
+	f.mtx.Lock()
+	projects := f.projects
+	f.mtx.Unlock()
+
+	i, next, err := f.searchPage(len(projects), req.GetPageToken())
+	if err != nil || len(projects) == 0 {
+		return &resourcemanagerpb.SearchProjectsResponse{}, err
+	}
+
+	return &resourcemanagerpb.SearchProjectsResponse{Projects: projects[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeFoldersServer) SearchFolders(_ context.Context, req *resourcemanagerpb.SearchFoldersRequest) (*resourcemanagerpb.SearchFoldersResponse, error) {
+	f.mtx.Lock()
+	folders := f.folders
+	f.mtx.Unlock()
+
+	i, next, err := f.searchPage(len(folders), req.GetPageToken())
+	if err != nil || len(folders) == 0 {
+		return &resourcemanagerpb.SearchFoldersResponse{}, err
+	}
+
+	return &resourcemanagerpb.SearchFoldersResponse{Folders: folders[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeOrganizationsServer) SearchOrganizations(_ context.Context, req *resourcemanagerpb.SearchOrganizationsRequest) (*resourcemanagerpb.SearchOrganizationsResponse, error) {
+	f.mtx.Lock()
+	organizations := f.organizations
+	f.mtx.Unlock()
+
+	i, next, err := f.searchPage(len(organizations), req.GetPageToken())
+	if err != nil || len(organizations) == 0 {
+		return &resourcemanagerpb.SearchOrganizationsResponse{}, err
+	}
+
+	return &resourcemanagerpb.SearchOrganizationsResponse{Organizations: organizations[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeProjectsServer) TestIamPermissions(_ context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	resp := &iampb.TestIamPermissionsResponse{}
+	for _, permission := range req.GetPermissions() {
+		if slices.Contains(f.granted[req.GetResource()], permission) {
+			resp.Permissions = append(resp.Permissions, permission)
+		}
+	}
+
+	return resp, nil
+}
+
+func (f *fakeProjectsServer) GetIamPolicy(_ context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	return f.getIamPolicy(req.GetResource())
+}
+
+func (f *fakeProjectsServer) SetIamPolicy(_ context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) {
+	return f.setIamPolicy(req.GetResource(), req.GetPolicy())
+}
+
+func (f *fakeDataPolicyServer) GetIamPolicy(_ context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	return f.getIamPolicy(req.GetResource())
+}
+
+func (f *fakeDataPolicyServer) SetIamPolicy(_ context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) {
+	return f.setIamPolicy(req.GetResource(), req.GetPolicy())
+}
+
+func (f *fakeIAMAdminServer) CreateServiceAccount(_ context.Context, req *adminpb.CreateServiceAccountRequest) (*adminpb.ServiceAccount, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	// The service accounts of a domain-scoped project DOMAIN:PROJECT are in the PROJECT.DOMAIN subdomain.
+	projectID := strings.TrimPrefix(req.GetName(), "projects/")
+	subdomain := projectID
+	if domain, project, ok := strings.Cut(projectID, ":"); ok {
+		subdomain = project + "." + domain
+	}
+	email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", req.GetAccountId(), subdomain)
+	if _, ok := f.serviceAccounts[email]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "service account %s already exists", email)
+	}
+
+	sa := proto.Clone(req.GetServiceAccount()).(*adminpb.ServiceAccount)
+	sa.Name = fmt.Sprintf("projects/%s/serviceAccounts/%s", projectID, email)
+	sa.ProjectId = projectID
+	sa.Email = email
+	f.serviceAccounts[email] = sa
+
+	return proto.Clone(sa).(*adminpb.ServiceAccount), nil
+}
+
+func (f *fakeIAMAdminServer) GetServiceAccount(_ context.Context, req *adminpb.GetServiceAccountRequest) (*adminpb.ServiceAccount, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	sa, ok := f.serviceAccounts[serviceAccountEmail(req.GetName())]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "service account %s not found", req.GetName())
+	}
+
+	return proto.Clone(sa).(*adminpb.ServiceAccount), nil
+}
+
+func (f *fakeIAMAdminServer) ListServiceAccounts(_ context.Context, req *adminpb.ListServiceAccountsRequest) (*adminpb.ListServiceAccountsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	projectID := strings.TrimPrefix(req.GetName(), "projects/")
+	var emails []string
+	for email, sa := range f.serviceAccounts {
+		if sa.GetProjectId() == projectID {
+			emails = append(emails, email)
+		}
+	}
+	sort.Strings(emails)
+
+	offset, _ := strconv.Atoi(req.GetPageToken())
+	end := min(offset+int(req.GetPageSize()), len(emails))
+	if req.GetPageSize() == 0 {
+		end = len(emails)
+	}
+
+	resp := &adminpb.ListServiceAccountsResponse{}
+	for _, email := range emails[offset:end] {
+		resp.Accounts = append(resp.Accounts, proto.Clone(f.serviceAccounts[email]).(*adminpb.ServiceAccount))
+	}
+	if end < len(emails) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+
+	return resp, nil
+}
+
+func (f *fakeIAMAdminServer) CreateServiceAccountKey(_ context.Context, req *adminpb.CreateServiceAccountKeyRequest) (*adminpb.ServiceAccountKey, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	email := serviceAccountEmail(req.GetName())
+	if _, ok := f.serviceAccounts[email]; !ok {
+		return nil, status.Errorf(codes.NotFound, "service account %s not found", req.GetName())
+	}
+	if f.failKeys {
+		return nil, status.Error(codes.FailedPrecondition, "key creation is disabled by organization policy")
+	}
+	f.keys[email]++
+
+	return &adminpb.ServiceAccountKey{
+		Name:           fmt.Sprintf("%s/keys/%d", req.GetName(), f.keys[email]),
+		PrivateKeyData: []byte(fmt.Sprintf(`{"type":"service_account","client_email":%q}`, email)),
+	}, nil
+}
+
+func (f *fakeIAMAdminServer) DeleteServiceAccount(_ context.Context, req *adminpb.DeleteServiceAccountRequest) (*emptypb.Empty, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	email := serviceAccountEmail(req.GetName())
+	if _, ok := f.serviceAccounts[email]; !ok {
+		return nil, status.Errorf(codes.NotFound, "service account %s not found", req.GetName())
+	}
+	delete(f.serviceAccounts, email)
+
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeIAMAdminServer) DisableServiceAccount(_ context.Context, req *adminpb.DisableServiceAccountRequest) (*emptypb.Empty, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	sa, ok := f.serviceAccounts[serviceAccountEmail(req.GetName())]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "service account %s not found", req.GetName())
+	}
+	sa.Disabled = true
+
+	return &emptypb.Empty{}, nil
+}
+
+// newFakeDatasetBuilder returns a dataset builder reading datasets from a fake BigQuery and project policies from a
+// fake IAM.
+func newFakeDatasetBuilder(t *testing.T) (*fakeBigQuery, *fakeIAM, *datasetBuilder) {
+	bq, client, service := newFakeBigQuery(t)
+	iam, opts := newFakeIAM(t)
+	projectsClient, err := resourcemanager.NewProjectsClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = projectsClient.Close() })
+
+	backend := newDirectBackend(projectsClient, client, service)
+	return bq, iam, newDatasetBuilder(client, service, projectsClient, backend, nil, nil)
+}
+
+const listAllMaxPages = 100
+
+// resourceLister is the List method of a resource syncer.
+type resourceLister interface {
+	List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error)
+}
+
+// listAll follows the page tokens of a syncer and returns its resources, or the error of the first page that fails.
+// A syncer that keeps returning the same page fails once listAllMaxPages pages are read.
+func listAll(lister resourceLister, parentResourceID *v2.ResourceId) ([]*v2.Resource, error) {
+	var resources []*v2.Resource
+	pageToken := ""
+	for page := 0; ; page++ {
+		if page == listAllMaxPages {
+			return nil, fmt.Errorf("no last page after %d pages", listAllMaxPages)
+		}
+		list, next, _, err := lister.List(ctxTest, parentResourceID, &pagination.Token{Token: pageToken})
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, list...)
+		if next == "" {
+			return resources, nil
+		}
+		pageToken = next
+	}
+}
+
+// serviceAccountEmail returns the email of a projects/PROJECT/serviceAccounts/EMAIL name.
+func serviceAccountEmail(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// fakeAnalyticsHub serves, from memory, the Analytics Hub data exchanges and listings of their parent, the
+// subscriptions of the listings and their IAM policies.
+type fakeAnalyticsHub struct {
+	analyticshubpb.UnimplementedAnalyticsHubServiceServer
+	mtx           sync.Mutex
+	exchanges     map[string][]*analyticshubpb.DataExchange
+	listings      map[string][]*analyticshubpb.Listing
+	subscriptions map[string][]*analyticshubpb.Subscription
+	policies      map[string]*iampb.Policy
+	// listErr is returned by the list calls from page listErrPage on.
+	listErr     error
+	listErrPage int
+}
+
+func newFakeAnalyticsHub(t *testing.T) (*fakeAnalyticsHub, *analyticshub.Client) {
+	f := &fakeAnalyticsHub{
+		exchanges:     make(map[string][]*analyticshubpb.DataExchange),
+		listings:      make(map[string][]*analyticshubpb.Listing),
+		subscriptions: make(map[string][]*analyticshubpb.Subscription),
+		policies:      make(map[string]*iampb.Policy),
+	}
+	opts := startFakeGRPC(t, func(srv *grpc.Server) {
+		analyticshubpb.RegisterAnalyticsHubServiceServer(srv, f)
+	})
+
+	client, err := analyticshub.NewClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return f, client
+}
+
+func (f *fakeAnalyticsHub) addExchange(parent string, exchangeID string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	name := parent + "/dataExchanges/" + exchangeID
+	f.exchanges[parent] = append(f.exchanges[parent], &analyticshubpb.DataExchange{Name: name, DisplayName: exchangeID})
+	return name
+}
+
+func (f *fakeAnalyticsHub) addListing(exchange string, listingID string, sourceDataset string, linkedDatasets ...string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	name := exchange + "/listings/" + listingID
+	f.listings[exchange] = append(f.listings[exchange], &analyticshubpb.Listing{
+		Name:        name,
+		DisplayName: listingID,
+		Source: &analyticshubpb.Listing_BigqueryDataset{
+			BigqueryDataset: &analyticshubpb.Listing_BigQueryDatasetSource{Dataset: sourceDataset},
+		},
+	})
+	for i, linked := range linkedDatasets {
+		f.subscriptions[name] = append(f.subscriptions[name], &analyticshubpb.Subscription{
+			Name: fmt.Sprintf("%s/subscriptions/%d", name, i),
+			LinkedDatasetMap: map[string]*analyticshubpb.Subscription_LinkedResource{
+				name: {Reference: &analyticshubpb.Subscription_LinkedResource_LinkedDataset{LinkedDataset: linked}},
+			},
+		})
+	}
+	return name
+}
+
+func (f *fakeAnalyticsHub) setPolicy(resource string, policy *iampb.Policy) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.policies[resource] = policy
+}
+
+func (f *fakeAnalyticsHub) setListError(err error, page int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.listErr = err
+	f.listErrPage = page
+}
+
+func (f *fakeAnalyticsHub) ListDataExchanges(_ context.Context, req *analyticshubpb.ListDataExchangesRequest) (*analyticshubpb.ListDataExchangesResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	exchanges := f.exchanges[req.GetParent()]
+	i, next, err := fakePage(len(exchanges), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(exchanges) == 0 {
+		return &analyticshubpb.ListDataExchangesResponse{}, err
+	}
+
+	return &analyticshubpb.ListDataExchangesResponse{DataExchanges: exchanges[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeAnalyticsHub) ListListings(_ context.Context, req *analyticshubpb.ListListingsRequest) (*analyticshubpb.ListListingsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	listings := f.listings[req.GetParent()]
+	i, next, err := fakePage(len(listings), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(listings) == 0 {
+		return &analyticshubpb.ListListingsResponse{}, err
+	}
+
+	return &analyticshubpb.ListListingsResponse{Listings: listings[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeAnalyticsHub) GetListing(_ context.Context, req *analyticshubpb.GetListingRequest) (*analyticshubpb.Listing, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for _, listings := range f.listings {
+		for _, listing := range listings {
+			if listing.GetName() == req.GetName() {
+				return listing, nil
+			}
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "listing not found")
+}
+
+func (f *fakeAnalyticsHub) ListSharedResourceSubscriptions(_ context.Context, req *analyticshubpb.ListSharedResourceSubscriptionsRequest) (*analyticshubpb.ListSharedResourceSubscriptionsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	subscriptions := f.subscriptions[req.GetResource()]
+	i, next, err := fakePage(len(subscriptions), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(subscriptions) == 0 {
+		return &analyticshubpb.ListSharedResourceSubscriptionsResponse{}, err
+	}
+
+	return &analyticshubpb.ListSharedResourceSubscriptionsResponse{SharedResourceSubscriptions: subscriptions[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeAnalyticsHub) GetIamPolicy(_ context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if policy, ok := f.policies[req.GetResource()]; ok {
+		return proto.Clone(policy).(*iampb.Policy), nil
+	}
+
+	return &iampb.Policy{}, nil
+}
+
+// fakeConnections serves, from memory, the BigQuery connections of their parent location and their IAM policies.
+type fakeConnections struct {
+	connectionpb.UnimplementedConnectionServiceServer
+	mtx         sync.Mutex
+	connections map[string][]*connectionpb.Connection
+	policies    map[string]*iampb.Policy
+	// listErr is returned by the list calls from page listErrPage on.
+	listErr     error
+	listErrPage int
+}
+
+func newFakeConnections(t *testing.T) (*fakeConnections, *connection.Client) {
+	f := &fakeConnections{
+		connections: make(map[string][]*connectionpb.Connection),
+		policies:    make(map[string]*iampb.Policy),
+	}
+	opts := startFakeGRPC(t, func(srv *grpc.Server) {
+		connectionpb.RegisterConnectionServiceServer(srv, f)
+	})
+
+	client, err := connection.NewClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return f, client
+}
+
+// addConnection adds a Cloud resource connection, whose service account BigQuery uses to reach the external data.
+func (f *fakeConnections) addConnection(parent string, connectionID string, serviceAccount string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	name := parent + "/connections/" + connectionID
+	f.connections[parent] = append(f.connections[parent], &connectionpb.Connection{
+		Name: name,
+		Properties: &connectionpb.Connection_CloudResource{
+			CloudResource: &connectionpb.CloudResourceProperties{ServiceAccountId: serviceAccount},
+		},
+	})
+	return name
+}
+
+func (f *fakeConnections) setPolicy(resource string, policy *iampb.Policy) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.policies[resource] = policy
+}
+
+func (f *fakeConnections) setListError(err error, page int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.listErr = err
+	f.listErrPage = page
+}
+
+func (f *fakeConnections) ListConnections(_ context.Context, req *connectionpb.ListConnectionsRequest) (*connectionpb.ListConnectionsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	connections := f.connections[req.GetParent()]
+	i, next, err := fakePage(len(connections), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(connections) == 0 {
+		return &connectionpb.ListConnectionsResponse{}, err
+	}
+
+	return &connectionpb.ListConnectionsResponse{Connections: connections[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeConnections) GetIamPolicy(_ context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if policy, ok := f.policies[req.GetResource()]; ok {
+		return proto.Clone(policy).(*iampb.Policy), nil
+	}
+
+	return &iampb.Policy{}, nil
+}
+
+// fakeReservations serves, from memory, the reservations and capacity commitments of their parent location, the
+// assignments of the reservations and their IAM policies.
+type fakeReservations struct {
+	reservationpb.UnimplementedReservationServiceServer
+	mtx          sync.Mutex
+	reservations map[string][]*reservationpb.Reservation
+	assignments  map[string][]*reservationpb.Assignment
+	commitments  map[string][]*reservationpb.CapacityCommitment
+	policies     map[string]*iampb.Policy
+	// listErr is returned by the list calls from page listErrPage on.
+	listErr     error
+	listErrPage int
+}
+
+func newFakeReservations(t *testing.T) (*fakeReservations, *reservation.Client) {
+	f := &fakeReservations{
+		reservations: make(map[string][]*reservationpb.Reservation),
+		assignments:  make(map[string][]*reservationpb.Assignment),
+		commitments:  make(map[string][]*reservationpb.CapacityCommitment),
+		policies:     make(map[string]*iampb.Policy),
+	}
+	opts := startFakeGRPC(t, func(srv *grpc.Server) {
+		reservationpb.RegisterReservationServiceServer(srv, f)
+	})
+
+	client, err := reservation.NewClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return f, client
+}
+
+// addReservation adds a reservation of slots, assigned to the given projects, folders or organizations.
+func (f *fakeReservations) addReservation(parent string, reservationID string, slots int64, assignees ...string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	name := parent + "/reservations/" + reservationID
+	f.reservations[parent] = append(f.reservations[parent], &reservationpb.Reservation{Name: name, SlotCapacity: slots})
+	for i, assignee := range assignees {
+		f.assignments[name] = append(f.assignments[name], &reservationpb.Assignment{
+			Name:     fmt.Sprintf("%s/assignments/%d", name, i),
+			Assignee: assignee,
+			JobType:  reservationpb.Assignment_QUERY,
+		})
+	}
+	return name
+}
+
+func (f *fakeReservations) addCommitment(parent string, commitmentID string, slots int64) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	name := parent + "/capacityCommitments/" + commitmentID
+	f.commitments[parent] = append(f.commitments[parent], &reservationpb.CapacityCommitment{
+		Name:      name,
+		SlotCount: slots,
+		Plan:      reservationpb.CapacityCommitment_ANNUAL,
+		State:     reservationpb.CapacityCommitment_ACTIVE,
+	})
+	return name
+}
+
+func (f *fakeReservations) setPolicy(resource string, policy *iampb.Policy) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.policies[resource] = policy
+}
+
+func (f *fakeReservations) setListError(err error, page int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.listErr = err
+	f.listErrPage = page
+}
+
+func (f *fakeReservations) ListReservations(_ context.Context, req *reservationpb.ListReservationsRequest) (*reservationpb.ListReservationsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	reservations := f.reservations[req.GetParent()]
+	i, next, err := fakePage(len(reservations), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(reservations) == 0 {
+		return &reservationpb.ListReservationsResponse{}, err
+	}
+
+	return &reservationpb.ListReservationsResponse{Reservations: reservations[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeReservations) ListAssignments(_ context.Context, req *reservationpb.ListAssignmentsRequest) (*reservationpb.ListAssignmentsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	assignments := f.assignments[req.GetParent()]
+	i, next, err := fakePage(len(assignments), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(assignments) == 0 {
+		return &reservationpb.ListAssignmentsResponse{}, err
+	}
+
+	return &reservationpb.ListAssignmentsResponse{Assignments: assignments[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeReservations) ListCapacityCommitments(_ context.Context, req *reservationpb.ListCapacityCommitmentsRequest) (*reservationpb.ListCapacityCommitmentsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	commitments := f.commitments[req.GetParent()]
+	i, next, err := fakePage(len(commitments), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(commitments) == 0 {
+		return &reservationpb.ListCapacityCommitmentsResponse{}, err
+	}
+
+	return &reservationpb.ListCapacityCommitmentsResponse{CapacityCommitments: commitments[i : i+1], NextPageToken: next}, nil
+}
+
+func (f *fakeReservations) GetIamPolicy(_ context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if policy, ok := f.policies[req.GetResource()]; ok {
+		return proto.Clone(policy).(*iampb.Policy), nil
+	}
+
+	return &iampb.Policy{}, nil
+}
+
+// fakeDataTransfer serves, from memory, the transfer configs of their parent location. As the real service, listing
+// leaves out the identity a config runs as, only reading the config returns it.
+type fakeDataTransfer struct {
+	datatransferpb.UnimplementedDataTransferServiceServer
+	mtx     sync.Mutex
+	configs map[string][]*datatransferpb.TransferConfig
+	// listErr is returned by the list calls from page listErrPage on.
+	listErr     error
+	listErrPage int
+}
+
+func newFakeDataTransfer(t *testing.T) (*fakeDataTransfer, *datatransfer.Client) {
+	f := &fakeDataTransfer{
+		configs: make(map[string][]*datatransferpb.TransferConfig),
+	}
+	opts := startFakeGRPC(t, func(srv *grpc.Server) {
+		datatransferpb.RegisterDataTransferServiceServer(srv, f)
+	})
+
+	client, err := datatransfer.NewClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return f, client
+}
+
+// addConfig adds a scheduled query writing into a dataset of the parent project, run as owner.
+func (f *fakeDataTransfer) addConfig(parent string, configID string, datasetID string, owner string) string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	name := parent + "/transferConfigs/" + configID
+	f.configs[parent] = append(f.configs[parent], &datatransferpb.TransferConfig{
+		Name:         name,
+		DisplayName:  configID,
+		DataSourceId: "scheduled_query",
+		Destination:  &datatransferpb.TransferConfig_DestinationDatasetId{DestinationDatasetId: datasetID},
+		OwnerInfo:    &datatransferpb.UserInfo{Email: proto.String(owner)},
+		State:        datatransferpb.TransferState_SUCCEEDED,
+	})
+	return name
+}
+
+func (f *fakeDataTransfer) setListError(err error, page int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.listErr = err
+	f.listErrPage = page
+}
+
+func (f *fakeDataTransfer) ListTransferConfigs(_ context.Context, req *datatransferpb.ListTransferConfigsRequest) (*datatransferpb.ListTransferConfigsResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	configs := f.configs[req.GetParent()]
+	i, next, err := fakePage(len(configs), req.GetPageToken(), f.listErr, f.listErrPage)
+	if err != nil || len(configs) == 0 {
+		return &datatransferpb.ListTransferConfigsResponse{}, err
+	}
+
+	listed := proto.Clone(configs[i]).(*datatransferpb.TransferConfig)
+	listed.OwnerInfo = nil
+	return &datatransferpb.ListTransferConfigsResponse{TransferConfigs: []*datatransferpb.TransferConfig{listed}, NextPageToken: next}, nil
+}
+
+func (f *fakeDataTransfer) GetTransferConfig(_ context.Context, req *datatransferpb.GetTransferConfigRequest) (*datatransferpb.TransferConfig, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for _, configs := range f.configs {
+		for _, config := range configs {
+			if config.GetName() == req.GetName() {
+				return config, nil
+			}
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "transfer config not found")
+}
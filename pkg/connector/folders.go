@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/api/iterator"
+)
+
+type folderBuilder struct {
+	resourceType  *v2.ResourceType
+	foldersClient *resourcemanager.FoldersClient
+}
+
+func (f *folderBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return folderResourceType
+}
+
+// List returns the folders visible to the credentials, they are synced so that projects can reference them as parent.
+func (f *folderBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var (
+		resources []*v2.Resource
+		bag       = &pagination.Bag{}
+	)
+	err := bag.Unmarshal(pToken.Token)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if bag.Current() == nil {
+		bag.Push(pagination.PageState{
+			ResourceTypeID: folderResourceType.Id,
+		})
+	}
+
+	it := f.foldersClient.SearchFolders(ctx,
+		&resourcemanagerpb.SearchFoldersRequest{
+			PageToken: bag.PageToken(),
+		},
+	)
+
+	for {
+		folder, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch folders")
+			}
+			break
+		}
+
+		resource, err := folderResource(folder)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create folder resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	err = bag.Next(it.PageInfo().Token)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
+	}
+
+	pageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, pageToken, nil, nil
+}
+
+func (f *folderBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (f *folderBuilder) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func folderResource(folder *resourcemanagerpb.Folder) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":        folder.Name,
+		"displayName": folder.DisplayName,
+		"state":       folder.State.String(),
+		"parent":      folder.Parent,
+	}
+	addLifecycleProfileFields(profile, folder.CreateTime, folder.UpdateTime, folder.DeleteTime)
+
+	opts := []rs.ResourceOption{
+		rs.WithResourceProfile(profile),
+		rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: denyPolicyResourceType.Id}),
+	}
+	opts = append(opts, lifecycleStatus(folder.State.String(), folder.DeleteTime)...)
+	if parent := containerResourceID(folder.Parent); parent != nil {
+		opts = append(opts, rs.WithParentResourceID(parent))
+	}
+
+	return rs.NewResource(
+		folder.DisplayName,
+		folderResourceType,
+		strings.TrimPrefix(folder.Name, "folders/"),
+		opts...,
+	)
+}
+
+func newFolderBuilder(foldersClient *resourcemanager.FoldersClient) *folderBuilder {
+	return &folderBuilder{
+		resourceType:  folderResourceType,
+		foldersClient: foldersClient,
+	}
+}
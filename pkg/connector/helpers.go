@@ -5,15 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/iam/apiv1/iampb"
 	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/googleapis/gax-go/v2/apierror"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const (
@@ -105,18 +111,115 @@ func removeRolesPrefix(role string) string {
 	return strings.TrimPrefix(role, "roles/")
 }
 
-func datasetResource(_ context.Context, datasetName string, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+// datasetResourceID qualifies a dataset ID with its project, dataset names are only unique within a project.
+func datasetResourceID(projectID string, datasetID string) string {
+	return projectID + ":" + datasetID
+}
+
+// parseDatasetResourceID splits a dataset resource ID into its project and dataset IDs.
+// Dataset IDs cannot contain a colon, domain-scoped project IDs (example.com:project) can.
+// An unqualified ID returns an empty project ID.
+func parseDatasetResourceID(id string) (string, string) {
+	i := strings.LastIndex(id, ":")
+	if i == NF {
+		return "", id
+	}
+
+	return id[:i], id[i+1:]
+}
+
+// datasetChildResourceID qualifies a routine or model ID with its dataset, as project:dataset.id.
+func datasetChildResourceID(projectID string, datasetID string, id string) string {
+	return datasetResourceID(projectID, datasetID) + "." + id
+}
+
+// parseDatasetChildResourceID splits a routine or model resource ID into its project, dataset and own IDs.
+// Neither dataset nor routine and model IDs can contain a dot.
+func parseDatasetChildResourceID(id string) (string, string, string) {
+	projectID, rest := parseDatasetResourceID(id)
+	datasetID, childID, found := strings.Cut(rest, ".")
+	if !found {
+		return projectID, "", rest
+	}
+
+	return projectID, datasetID, childID
+}
+
+// parseResourceName extracts the project and dataset IDs from names such as
+// projects/P, projects/P/datasets/D or projects/P/datasets/D/tables/T.
+func parseResourceName(resourceName string) (string, string) {
+	parts := strings.Split(resourceName, "/")
+	if len(parts) < 2 || parts[0] != "projects" {
+		return "", ""
+	}
+
+	if len(parts) >= 4 && parts[2] == "datasets" {
+		return parts[1], parts[3]
+	}
+
+	return parts[1], ""
+}
+
+// datasetResource builds a dataset resource. The dataset is optional, when present its metadata is added to the profile.
+func datasetResource(_ context.Context, projectID string, datasetID string, dataset *bigqueryapi.Dataset, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
 	profile := map[string]interface{}{
-		"name": datasetName,
+		"name":       datasetID,
+		"project_id": projectID,
+		"dataset_id": datasetID,
+	}
+
+	if dataset != nil {
+		profile["location"] = dataset.Location
+		profile["type"] = dataset.Type
+		if dataset.Description != "" {
+			profile["description"] = dataset.Description
+		}
+		if dataset.FriendlyName != "" {
+			profile["friendly_name"] = dataset.FriendlyName
+		}
+		if len(dataset.Labels) > 0 {
+			labels := make(map[string]interface{}, len(dataset.Labels))
+			for key, value := range dataset.Labels {
+				labels[key] = value
+			}
+			profile["labels"] = labels
+		}
+		if dataset.CreationTime > 0 {
+			profile["creation_time"] = time.UnixMilli(dataset.CreationTime).UTC().Format(time.RFC3339)
+		}
+		if dataset.LastModifiedTime > 0 {
+			profile["last_modified_time"] = time.UnixMilli(dataset.LastModifiedTime).UTC().Format(time.RFC3339)
+		}
+		if dataset.DefaultEncryptionConfiguration != nil && dataset.DefaultEncryptionConfiguration.KmsKeyName != "" {
+			profile["kms_key_name"] = dataset.DefaultEncryptionConfiguration.KmsKeyName
+		}
+		if dataset.DefaultTableExpirationMs > 0 {
+			profile["default_table_expiration"] = dataset.DefaultTableExpirationMs / 1000
+		}
+
+		// Linked datasets are read-only replicas of a dataset shared through an Analytics Hub listing.
+		profile["linked"] = dataset.LinkedDatasetSource != nil
+		if dataset.LinkedDatasetSource != nil && dataset.LinkedDatasetSource.SourceDataset != nil {
+			source := dataset.LinkedDatasetSource.SourceDataset
+			profile["linked_dataset_source"] = datasetResourceID(source.ProjectId, source.DatasetId)
+		}
+		if dataset.ExternalDatasetReference != nil {
+			profile["external_source"] = dataset.ExternalDatasetReference.ExternalSource
+		}
 	}
 
 	resource, err := rs.NewGroupResource(
-		datasetName,
+		datasetID,
 		datasetResourceType,
-		datasetName,
+		datasetResourceID(projectID, datasetID),
 		nil,
 		rs.WithParentResourceID(parentResourceID),
 		rs.WithResourceProfile(profile),
+		rs.WithAnnotation(
+			&v2.ChildResourceType{ResourceTypeId: routineResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: modelResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: viewResourceType.Id},
+		),
 	)
 	if err != nil {
 		return nil, err
@@ -125,11 +228,71 @@ func datasetResource(_ context.Context, datasetName string, parentResourceID *v2
 	return resource, nil
 }
 
-func isUserOrServiceAccount(policy *iampb.Policy, memberGranted string) bool {
-	for _, binding := range policy.Bindings {
-		for _, member := range binding.Members {
-			if member == fmt.Sprintf("%s:%s", serviceAccount, memberGranted) ||
-				member == fmt.Sprintf("%s:%s", user, memberGranted) {
+// accessEntryPrincipal resolves the user or service account of a dataset access entry without requiring a project
+// role. IAM member entries carry their type as prefix; for email entries, service accounts are recognized by their
+// gserviceaccount.com domain or, for other domains, by a serviceAccount member in the project policy, which may be nil.
+func accessEntryPrincipal(access *bigquery.AccessEntry, policy *iampb.Policy) (string, bool, bool) {
+	switch access.EntityType {
+	case bigquery.UserEmailEntity:
+		email := access.Entity
+		if isServiceAccountEmail(email) || policyHasMember(policy, fmt.Sprintf("%s:%s", serviceAccount, email)) {
+			return email, true, true
+		}
+		return email, false, true
+	case bigquery.IAMMemberEntity:
+		if ok, email := isServiceAccount(access.Entity); ok {
+			return email, true, true
+		}
+		if ok, email := isUser(access.Entity); ok {
+			return email, false, true
+		}
+	}
+
+	return "", false, false
+}
+
+// accessEntryFromAPI converts a REST dataset access entry, which carries the conditions of a version 3 access policy,
+// to the client library representation.
+func accessEntryFromAPI(access *bigqueryapi.DatasetAccess) *bigquery.AccessEntry {
+	entry := &bigquery.AccessEntry{
+		Role: bigquery.AccessRole(access.Role),
+	}
+
+	switch {
+	case access.UserByEmail != "":
+		entry.EntityType, entry.Entity = bigquery.UserEmailEntity, access.UserByEmail
+	case access.GroupByEmail != "":
+		entry.EntityType, entry.Entity = bigquery.GroupEmailEntity, access.GroupByEmail
+	case access.Domain != "":
+		entry.EntityType, entry.Entity = bigquery.DomainEntity, access.Domain
+	case access.SpecialGroup != "":
+		entry.EntityType, entry.Entity = bigquery.SpecialGroupEntity, access.SpecialGroup
+	case access.IamMember != "":
+		entry.EntityType, entry.Entity = bigquery.IAMMemberEntity, access.IamMember
+	case access.View != nil:
+		entry.EntityType = bigquery.ViewEntity
+		entry.View = &bigquery.Table{
+			ProjectID: access.View.ProjectId,
+			DatasetID: access.View.DatasetId,
+			TableID:   access.View.TableId,
+		}
+	case access.Routine != nil:
+		entry.EntityType = bigquery.RoutineEntity
+	case access.Dataset != nil:
+		entry.EntityType = bigquery.DatasetEntity
+	}
+
+	return entry
+}
+
+func isServiceAccountEmail(email string) bool {
+	return strings.HasSuffix(strings.ToLower(email), ".gserviceaccount.com")
+}
+
+func policyHasMember(policy *iampb.Policy, member string) bool {
+	for _, binding := range policy.GetBindings() {
+		for _, m := range binding.Members {
+			if m == member {
 				return true
 			}
 		}
@@ -143,9 +306,37 @@ func projectResource(projects *resourcemanagerpb.Project) (*v2.Resource, error)
 		"id":          projects.ProjectId,
 		"name":        projects.Name,
 		"displayName": projects.DisplayName,
+		"state":       projects.State.String(),
+		"parent":      projects.Parent,
+	}
+	addLifecycleProfileFields(profile, projects.CreateTime, projects.UpdateTime, projects.DeleteTime)
+	if len(projects.Labels) > 0 {
+		labels := make(map[string]interface{}, len(projects.Labels))
+		for key, value := range projects.Labels {
+			labels[key] = value
+		}
+		profile["labels"] = labels
+	}
+
+	opts = append(opts,
+		rs.WithAppTrait(),
+		rs.WithResourceProfile(profile),
+		rs.WithAnnotation(
+			&v2.ChildResourceType{ResourceTypeId: dataExchangeResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: connectionResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: reservationResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: capacityCommitmentResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: dataPolicyResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: transferConfigResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: denyPolicyResourceType.Id},
+			&v2.ChildResourceType{ResourceTypeId: serviceAccountResourceType.Id},
+		),
+	)
+	opts = append(opts, lifecycleStatus(projects.State.String(), projects.DeleteTime)...)
+	if parent := containerResourceID(projects.Parent); parent != nil {
+		opts = append(opts, rs.WithParentResourceID(parent))
 	}
 
-	opts = append(opts, rs.WithAppTrait(), rs.WithResourceProfile(profile))
 	resource, err := rs.NewResource(
 		projects.DisplayName,
 		projectResourceType,
@@ -159,6 +350,57 @@ func projectResource(projects *resourcemanagerpb.Project) (*v2.Resource, error)
 	return resource, nil
 }
 
+// containerResourceID maps a resource manager name (projects/ID, folders/ID or organizations/ID) to its resource ID.
+func containerResourceID(name string) *v2.ResourceId {
+	switch {
+	case strings.HasPrefix(name, "projects/"):
+		return &v2.ResourceId{
+			ResourceType: projectResourceType.Id,
+			Resource:     strings.TrimPrefix(name, "projects/"),
+		}
+	case strings.HasPrefix(name, "folders/"):
+		return &v2.ResourceId{
+			ResourceType: folderResourceType.Id,
+			Resource:     strings.TrimPrefix(name, "folders/"),
+		}
+	case strings.HasPrefix(name, "organizations/"):
+		return &v2.ResourceId{
+			ResourceType: organizationResourceType.Id,
+			Resource:     strings.TrimPrefix(name, "organizations/"),
+		}
+	default:
+		return nil
+	}
+}
+
+// lifecycleStatus reports resource manager resources pending deletion as disabled.
+func lifecycleStatus(state string, deleteTime *timestamppb.Timestamp) []rs.ResourceOption {
+	switch state {
+	case "ACTIVE":
+		return []rs.ResourceOption{rs.WithResourceStatus(v2.Status_RESOURCE_STATUS_ENABLED, "")}
+	case "DELETE_REQUESTED":
+		details := "deletion requested"
+		if deleteTime != nil {
+			details = fmt.Sprintf("deletion requested on %s", deleteTime.AsTime().UTC().Format(time.RFC3339))
+		}
+		return []rs.ResourceOption{rs.WithResourceStatus(v2.Status_RESOURCE_STATUS_DISABLED, details)}
+	default:
+		return nil
+	}
+}
+
+func addLifecycleProfileFields(profile map[string]interface{}, createTime, updateTime, deleteTime *timestamppb.Timestamp) {
+	for key, value := range map[string]*timestamppb.Timestamp{
+		"createTime": createTime,
+		"updateTime": updateTime,
+		"deleteTime": deleteTime,
+	} {
+		if value != nil {
+			profile[key] = value.AsTime().UTC().Format(time.RFC3339)
+		}
+	}
+}
+
 func isUser(member string) (bool, string) {
 	if strings.HasPrefix(member, "user:") {
 		return true, strings.TrimPrefix(member, "user:")
@@ -175,6 +417,148 @@ func isServiceAccount(member string) (bool, string) {
 	return false, ""
 }
 
+// deletedMemberPrefix marks IAM members whose principal was deleted after being bound,
+// e.g. deleted:user:EMAIL?uid=ID or deleted:serviceAccount:EMAIL?uid=ID.
+const deletedMemberPrefix = "deleted:"
+
+// isDeletedUserOrServiceAccountMember returns the member type and email of a deleted user or service account member.
+func isDeletedUserOrServiceAccountMember(member string) (bool, string, string) {
+	if !strings.HasPrefix(member, deletedMemberPrefix) {
+		return false, "", ""
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(member, deletedMemberPrefix), ":", 2)
+	if len(parts) < 2 || (parts[0] != user && parts[0] != serviceAccount) {
+		return false, "", ""
+	}
+
+	email, _, _ := strings.Cut(parts[1], "?")
+	return true, parts[0], email
+}
+
+// deletedUserResource builds a disabled principal for a deleted member. The member string is kept as ID, it
+// carries the unique ID of the deleted principal and so never collides with a principal recreated with the same email.
+func deletedUserResource(member string, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	_, memberType, email := isDeletedUserOrServiceAccountMember(member)
+	profile := map[string]interface{}{
+		"email":   email,
+		"member":  member,
+		"deleted": true,
+	}
+
+	userTraits := []rs.UserTraitOption{
+		rs.WithUserLogin(email),
+		rs.WithStatus(v2.UserTrait_Status_STATUS_DISABLED),
+	}
+	if memberType == serviceAccount {
+		userTraits = append(userTraits, rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE))
+	}
+
+	return rs.NewUserResource(fmt.Sprintf("%s (deleted)", email),
+		userResourceType,
+		member,
+		userTraits,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+		rs.WithResourceStatus(v2.Status_RESOURCE_STATUS_DISABLED, "principal was deleted"),
+	)
+}
+
+// iamMemberPrincipalID returns the user resource ID of an IAM member. Deleted principals keep the full member as ID,
+// members that are neither users nor service accounts are not synced.
+func iamMemberPrincipalID(member string) (*v2.ResourceId, bool) {
+	if isDeleted, _, _ := isDeletedUserOrServiceAccountMember(member); isDeleted {
+		return &v2.ResourceId{ResourceType: userResourceType.Id, Resource: member}, true
+	}
+	if isUser, user := isUserOrServiceAccountMember(member); isUser {
+		return &v2.ResourceId{ResourceType: userResourceType.Id, Resource: user}, true
+	}
+
+	return nil, false
+}
+
+// principalMember returns the IAM member (user:EMAIL or serviceAccount:EMAIL) of a user principal.
+func principalMember(principal *v2.Resource) (string, error) {
+	if principal.GetId().GetResourceType() != userResourceType.Id {
+		return "", fmt.Errorf("baton-google-bigquery: only users and service accounts can be granted, got %s", principal.GetId().GetResourceType())
+	}
+
+	email := principal.GetId().GetResource()
+	if strings.HasPrefix(email, deletedMemberPrefix) {
+		return "", fmt.Errorf("baton-google-bigquery: %s was deleted and cannot be granted", email)
+	}
+
+	if trait, err := rs.GetUserTrait(principal); err == nil && trait.GetAccountType() == v2.UserTrait_ACCOUNT_TYPE_SERVICE {
+		return serviceAccount + ":" + email, nil
+	}
+	if isServiceAccountEmail(email) {
+		return serviceAccount + ":" + email, nil
+	}
+
+	return user + ":" + email, nil
+}
+
+// entitlementSlug returns the slug of an entitlement. Grants only carry the entitlement ID, made of the resource
+// type, the resource ID and the slug.
+func entitlementSlug(entitlement *v2.Entitlement) string {
+	if entitlement.GetSlug() != "" {
+		return entitlement.GetSlug()
+	}
+
+	resourceID := entitlement.GetResource().GetId()
+	return strings.TrimPrefix(entitlement.GetId(), fmt.Sprintf("%s:%s:", resourceID.GetResourceType(), resourceID.GetResource()))
+}
+
+// addPolicyMember adds the member to the binding of the role, it reports false when the member already had the role.
+// Conditional bindings are left untouched.
+func addPolicyMember(policy *iampb.Policy, role string, member string) bool {
+	for _, binding := range policy.Bindings {
+		if binding.Role != role || binding.Condition != nil {
+			continue
+		}
+		for _, m := range binding.Members {
+			if m == member {
+				return false
+			}
+		}
+		binding.Members = append(binding.Members, member)
+		return true
+	}
+
+	policy.Bindings = append(policy.Bindings, &iampb.Binding{
+		Role:    role,
+		Members: []string{member},
+	})
+	return true
+}
+
+// removePolicyMember removes the member from the unconditional binding of the role, it reports false when the member
+// did not have the role. Bindings left without members are dropped.
+func removePolicyMember(policy *iampb.Policy, role string, member string) bool {
+	removed := false
+	bindings := make([]*iampb.Binding, 0, len(policy.Bindings))
+	for _, binding := range policy.Bindings {
+		if binding.Role == role && binding.Condition == nil {
+			members := make([]string, 0, len(binding.Members))
+			for _, m := range binding.Members {
+				if m == member {
+					removed = true
+					continue
+				}
+				members = append(members, m)
+			}
+			if len(members) == 0 {
+				continue
+			}
+			binding.Members = members
+		}
+		bindings = append(bindings, binding)
+	}
+
+	policy.Bindings = bindings
+	return removed
+}
+
 func isUserOrServiceAccountMember(member string) (bool, string) {
 	if strings.HasPrefix(member, "deleted:") {
 		return false, ""
@@ -186,3 +570,127 @@ func isUserOrServiceAccountMember(member string) (bool, string) {
 	}
 	return false, ""
 }
+
+func addResourceProfileFields(resource *v2.Resource, fields map[string]interface{}) error {
+	profile := resource.GetProfile()
+	if profile == nil {
+		profile = &structpb.Struct{}
+	}
+	if profile.Fields == nil {
+		profile.Fields = make(map[string]*structpb.Value)
+	}
+
+	for k, v := range fields {
+		value, err := structpb.NewValue(v)
+		if err != nil {
+			return err
+		}
+		profile.Fields[k] = value
+	}
+
+	resource.SetProfile(profile)
+	return nil
+}
+
+// addGrantMetadata merges fields into the grant's metadata annotation, keeping any fields already set.
+func addGrantMetadata(g *v2.Grant, fields map[string]interface{}) error {
+	annos := annotations.Annotations(g.GetAnnotations())
+	md := &v2.GrantMetadata{}
+	if _, err := annos.Pick(md); err != nil {
+		return err
+	}
+	if md.GetMetadata() == nil {
+		md.SetMetadata(&structpb.Struct{})
+	}
+	if md.GetMetadata().Fields == nil {
+		md.GetMetadata().Fields = make(map[string]*structpb.Value)
+	}
+
+	for k, v := range fields {
+		value, err := structpb.NewValue(v)
+		if err != nil {
+			return err
+		}
+		md.GetMetadata().Fields[k] = value
+	}
+
+	annos.Update(md)
+	g.SetAnnotations(annos)
+	return nil
+}
+
+var accessEntityTypes = map[string]bigquery.EntityType{
+	"user":          bigquery.UserEmailEntity,
+	"group":         bigquery.GroupEmailEntity,
+	"domain":        bigquery.DomainEntity,
+	"special_group": bigquery.SpecialGroupEntity,
+	"iam_member":    bigquery.IAMMemberEntity,
+}
+
+// datasetMetadataFromProfile reads the settings of a dataset to create from a resource profile:
+//   - location: the dataset location, for example "US" or "europe-west1".
+//   - default_table_expiration: seconds, or a Go duration string such as "720h".
+//   - labels: a map of label keys to values.
+//   - access: a list of {"role", "entity_type", "entity"} entries, entity_type being one of
+//     user, group, domain, special_group or iam_member.
+func datasetMetadataFromProfile(profile *structpb.Struct) (*bigquery.DatasetMetadata, error) {
+	meta := &bigquery.DatasetMetadata{}
+	if profile == nil {
+		return meta, nil
+	}
+	fields := profile.GetFields()
+
+	if v, ok := fields["location"]; ok {
+		meta.Location = v.GetStringValue()
+	}
+
+	if v, ok := fields["description"]; ok {
+		meta.Description = v.GetStringValue()
+	}
+
+	if v, ok := fields["kms_key_name"]; ok {
+		meta.DefaultEncryptionConfig = &bigquery.EncryptionConfig{
+			KMSKeyName: v.GetStringValue(),
+		}
+	}
+
+	if v, ok := fields["default_table_expiration"]; ok {
+		switch kind := v.GetKind().(type) {
+		case *structpb.Value_NumberValue:
+			meta.DefaultTableExpiration = time.Duration(kind.NumberValue) * time.Second
+		case *structpb.Value_StringValue:
+			d, err := time.ParseDuration(kind.StringValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid default_table_expiration %q: %w", kind.StringValue, err)
+			}
+			meta.DefaultTableExpiration = d
+		default:
+			return nil, fmt.Errorf("default_table_expiration must be a number of seconds or a duration")
+		}
+	}
+
+	if v, ok := fields["labels"]; ok {
+		meta.Labels = make(map[string]string)
+		for key, value := range v.GetStructValue().GetFields() {
+			meta.Labels[key] = value.GetStringValue()
+		}
+	}
+
+	if v, ok := fields["access"]; ok {
+		for _, item := range v.GetListValue().GetValues() {
+			entry := item.GetStructValue().GetFields()
+			entityType, ok := accessEntityTypes[entry["entity_type"].GetStringValue()]
+			if !ok {
+				return nil, fmt.Errorf("unsupported access entity_type %q", entry["entity_type"].GetStringValue())
+			}
+
+			meta.Access = append(meta.Access, &bigquery.AccessEntry{
+				Role:       bigquery.AccessRole(entry["role"].GetStringValue()),
+				EntityType: entityType,
+				Entity:     entry["entity"].GetStringValue(),
+			})
+		}
+	}
+
+	return meta, nil
+}
@@ -0,0 +1,418 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	iamv2pb "cloud.google.com/go/iam/apiv2/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	cloudasset "google.golang.org/api/cloudasset/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestDatasetMetadataFromProfile(t *testing.T) {
+	profile, err := structpb.NewStruct(map[string]interface{}{
+		"location":                 "EU",
+		"default_table_expiration": "720h",
+		"labels": map[string]interface{}{
+			"team": "analytics",
+		},
+		"access": []interface{}{
+			map[string]interface{}{"role": "roles/bigquery.dataViewer", "entity_type": "user", "entity": "alice@example.com"},
+			map[string]interface{}{"role": "OWNER", "entity_type": "special_group", "entity": "projectOwners"},
+		},
+	})
+	require.NoError(t, err)
+
+	meta, err := datasetMetadataFromProfile(profile)
+	require.NoError(t, err)
+	require.Equal(t, "EU", meta.Location)
+	require.Equal(t, 720*time.Hour, meta.DefaultTableExpiration)
+	require.Equal(t, map[string]string{"team": "analytics"}, meta.Labels)
+	require.Len(t, meta.Access, 2)
+	require.Equal(t, bigquery.UserEmailEntity, meta.Access[0].EntityType)
+	require.Equal(t, bigquery.SpecialGroupEntity, meta.Access[1].EntityType)
+
+	profile, err = structpb.NewStruct(map[string]interface{}{
+		"default_table_expiration": 3600,
+		"access": []interface{}{
+			map[string]interface{}{"role": "READER", "entity_type": "unknown", "entity": "x"},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = datasetMetadataFromProfile(profile)
+	require.Error(t, err)
+}
+
+func TestDatasetResource(t *testing.T) {
+	projectID, datasetID := parseDatasetResourceID("example.com:demo-project:sales")
+	require.Equal(t, "example.com:demo-project", projectID)
+	require.Equal(t, "sales", datasetID)
+
+	projectID, datasetID = parseDatasetResourceID("sales")
+	require.Empty(t, projectID)
+	require.Equal(t, "sales", datasetID)
+
+	// The profile of a dataset resource creates the same dataset again.
+	resource, err := datasetResource(ctxTest, "demo-project", "sales", &bigqueryapi.Dataset{
+		Location:                       "EU",
+		Labels:                         map[string]string{"team": "analytics"},
+		DefaultTableExpirationMs:       3600000,
+		DefaultEncryptionConfiguration: &bigqueryapi.EncryptionConfiguration{KmsKeyName: "projects/p/locations/eu/keyRings/r/cryptoKeys/k"},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "demo-project:sales", resource.GetId().GetResource())
+
+	meta, err := datasetMetadataFromProfile(resource.GetProfile())
+	require.NoError(t, err)
+	require.Equal(t, "EU", meta.Location)
+	require.Equal(t, map[string]string{"team": "analytics"}, meta.Labels)
+	require.Equal(t, time.Hour, meta.DefaultTableExpiration)
+	require.Equal(t, "projects/p/locations/eu/keyRings/r/cryptoKeys/k", meta.DefaultEncryptionConfig.KMSKeyName)
+}
+
+func TestDeletedUserResource(t *testing.T) {
+	isDeleted, memberType, email := isDeletedUserOrServiceAccountMember("deleted:serviceAccount:etl@demo.iam.gserviceaccount.com?uid=123")
+	require.True(t, isDeleted)
+	require.Equal(t, serviceAccount, memberType)
+	require.Equal(t, "etl@demo.iam.gserviceaccount.com", email)
+
+	isDeleted, _, _ = isDeletedUserOrServiceAccountMember("deleted:group:analysts@example.com?uid=456")
+	require.False(t, isDeleted)
+	isDeleted, _, _ = isDeletedUserOrServiceAccountMember("user:alice@example.com")
+	require.False(t, isDeleted)
+
+	resource, err := deletedUserResource("deleted:user:alice@example.com?uid=789", nil)
+	require.NoError(t, err)
+	require.Equal(t, "deleted:user:alice@example.com?uid=789", resource.GetId().GetResource())
+	require.Equal(t, v2.Status_RESOURCE_STATUS_DISABLED, resource.GetStatus().GetStatus())
+	require.True(t, resource.GetProfile().GetFields()["deleted"].GetBoolValue())
+}
+
+func TestPolicyMembers(t *testing.T) {
+	sa, err := userResource("etl@demo.iam.gserviceaccount.com", nil, rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE))
+	require.NoError(t, err)
+	member, err := principalMember(sa)
+	require.NoError(t, err)
+	require.Equal(t, "serviceAccount:etl@demo.iam.gserviceaccount.com", member)
+
+	deleted, err := deletedUserResource("deleted:user:alice@example.com?uid=789", nil)
+	require.NoError(t, err)
+	_, err = principalMember(deleted)
+	require.Error(t, err)
+
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: maskedReaderEntitlement, Members: []string{"user:bob@example.com"}},
+		},
+	}
+	require.True(t, addPolicyMember(policy, maskedReaderEntitlement, member))
+	require.False(t, addPolicyMember(policy, maskedReaderEntitlement, member))
+	require.Equal(t, []string{"user:bob@example.com", member}, policy.Bindings[0].Members)
+
+	require.True(t, removePolicyMember(policy, maskedReaderEntitlement, member))
+	require.True(t, removePolicyMember(policy, maskedReaderEntitlement, "user:bob@example.com"))
+	require.False(t, removePolicyMember(policy, maskedReaderEntitlement, "user:bob@example.com"))
+	require.Empty(t, policy.Bindings)
+
+	// Synced grants carry the entitlement ID without its slug.
+	require.Equal(t, maskedReaderEntitlement, entitlementSlug(&v2.Entitlement{
+		Id:       "data_policy:projects/p/locations/us/dataPolicies/ssn:" + maskedReaderEntitlement,
+		Resource: &v2.Resource{Id: &v2.ResourceId{ResourceType: dataPolicyResourceType.Id, Resource: "projects/p/locations/us/dataPolicies/ssn"}},
+	}))
+}
+
+func TestAccessEntryPrincipal(t *testing.T) {
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"serviceAccount:robot@example.com"}},
+		},
+	}
+
+	for _, tc := range []struct {
+		access           *bigquery.AccessEntry
+		email            string
+		isServiceAccount bool
+		ok               bool
+	}{
+		{&bigquery.AccessEntry{EntityType: bigquery.UserEmailEntity, Entity: "alice@example.com"}, "alice@example.com", false, true},
+		{&bigquery.AccessEntry{EntityType: bigquery.UserEmailEntity, Entity: "etl@demo.iam.gserviceaccount.com"}, "etl@demo.iam.gserviceaccount.com", true, true},
+		{&bigquery.AccessEntry{EntityType: bigquery.UserEmailEntity, Entity: "robot@example.com"}, "robot@example.com", true, true},
+		{&bigquery.AccessEntry{EntityType: bigquery.IAMMemberEntity, Entity: "serviceAccount:ci@example.com"}, "ci@example.com", true, true},
+		{&bigquery.AccessEntry{EntityType: bigquery.IAMMemberEntity, Entity: "group:analysts@example.com"}, "", false, false},
+		{&bigquery.AccessEntry{EntityType: bigquery.GroupEmailEntity, Entity: "analysts@example.com"}, "", false, false},
+	} {
+		email, isServiceAccount, ok := accessEntryPrincipal(tc.access, policy)
+		require.Equal(t, tc.email, email, tc.access.Entity)
+		require.Equal(t, tc.isServiceAccount, isServiceAccount, tc.access.Entity)
+		require.Equal(t, tc.ok, ok, tc.access.Entity)
+	}
+
+	email, isServiceAccount, ok := accessEntryPrincipal(&bigquery.AccessEntry{EntityType: bigquery.UserEmailEntity, Entity: "bob@example.com"}, nil)
+	require.Equal(t, "bob@example.com", email)
+	require.False(t, isServiceAccount)
+	require.True(t, ok)
+}
+
+func TestDatasetRoleEntitlement(t *testing.T) {
+	for role, expected := range map[string]string{
+		"OWNER":                         "roles/bigquery.dataOwner",
+		"WRITER":                        "roles/bigquery.dataEditor",
+		"READER":                        "roles/bigquery.dataViewer",
+		"roles/bigquery.metadataViewer": "roles/bigquery.metadataViewer",
+	} {
+		e, ok := datasetRoleEntitlement(role)
+		require.True(t, ok, role)
+		require.Equal(t, expected, e)
+	}
+
+	_, ok := datasetRoleEntitlement("roles/reader")
+	require.False(t, ok)
+
+	access := accessEntryFromAPI(&bigqueryapi.DatasetAccess{
+		Role:        "roles/bigquery.dataViewer",
+		UserByEmail: "alice@example.com",
+		Condition:   &bigqueryapi.Expr{Expression: "request.time < timestamp('2030-01-01T00:00:00Z')"},
+	})
+	require.Equal(t, bigquery.UserEmailEntity, access.EntityType)
+	require.Equal(t, "alice@example.com", access.Entity)
+
+	view := accessEntryFromAPI(&bigqueryapi.DatasetAccess{
+		View: &bigqueryapi.TableReference{ProjectId: "demo-project", DatasetId: "reporting", TableId: "orders_v"},
+	})
+	require.Equal(t, bigquery.ViewEntity, view.EntityType)
+	require.Equal(t, "orders_v", view.View.TableID)
+}
+
+func TestSpecialGroupGrant(t *testing.T) {
+	dataset, err := datasetResource(context.Background(), "demo-project", "sales", nil, nil)
+	require.NoError(t, err)
+	policy := &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/viewer", Members: []string{"user:alice@example.com", "user:bob@example.com"}},
+		},
+	}
+
+	o := &datasetBuilder{}
+	grants := o.accessEntryGrants(context.Background(), dataset, policy, &bigquery.AccessEntry{
+		Role:       bigquery.ReaderRole,
+		EntityType: bigquery.SpecialGroupEntity,
+		Entity:     "projectReaders",
+	})
+	// The group is granted to the members of the dataset's project, not to the role shared by every project.
+	principals := make([]string, 0, len(grants))
+	for _, g := range grants {
+		require.Equal(t, userResourceType.Id, g.GetPrincipal().GetId().GetResourceType())
+		require.Equal(t, "dataset:demo-project:sales:roles/bigquery.dataViewer", g.GetEntitlement().GetId())
+		principals = append(principals, g.GetPrincipal().GetId().GetResource())
+	}
+	require.ElementsMatch(t, []string{"alice@example.com", "bob@example.com"}, principals)
+
+	require.Empty(t, o.accessEntryGrants(context.Background(), dataset, policy, &bigquery.AccessEntry{
+		Role:       bigquery.OwnerRole,
+		EntityType: bigquery.SpecialGroupEntity,
+		Entity:     "projectOwners",
+	}))
+}
+
+func TestAssetBackendReset(t *testing.T) {
+	assets, service := newFakeCloudAsset(t)
+	assets.addProject("123", "demo-project")
+	backend := newAssetBackend(service, "organizations/456")
+
+	projects, err := backend.Projects(ctxTest)
+	require.NoError(t, err)
+	require.Len(t, projects, 1)
+	_, _, err = backend.ProjectsPage(ctxTest, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, assets.searchCount())
+
+	// A new sync searches the scope again and sees the projects created since.
+	assets.addProject("124", "new-project")
+	backend.reset()
+	projects, err = backend.Projects(ctxTest)
+	require.NoError(t, err)
+	require.Len(t, projects, 2)
+	require.Equal(t, 2, assets.searchCount())
+}
+
+func TestAssetIndex(t *testing.T) {
+	index := newAssetIndex()
+	index.addResource(&cloudasset.ResourceSearchResult{
+		AssetType:            projectAssetType,
+		Name:                 "//cloudresourcemanager.googleapis.com/projects/123",
+		Project:              "projects/123",
+		AdditionalAttributes: []byte(`{"projectId":"demo-project"}`),
+	})
+	index.addResource(&cloudasset.ResourceSearchResult{
+		AssetType:  datasetAssetType,
+		Name:       "//bigquery.googleapis.com/projects/demo-project/datasets/sales",
+		Project:    "projects/123",
+		Location:   "EU",
+		CreateTime: "2024-03-01T10:00:00Z",
+	})
+	index.addPolicy(&cloudasset.IamPolicySearchResult{
+		AssetType: projectAssetType,
+		Resource:  "//cloudresourcemanager.googleapis.com/projects/123",
+		Policy: &cloudasset.Policy{
+			Bindings: []*cloudasset.Binding{
+				{Role: "roles/viewer", Members: []string{"user:alice@example.com"}},
+			},
+		},
+	})
+	index.addPolicy(&cloudasset.IamPolicySearchResult{
+		AssetType: datasetAssetType,
+		Resource:  "//bigquery.googleapis.com/projects/demo-project/datasets/sales",
+		Policy: &cloudasset.Policy{
+			Bindings: []*cloudasset.Binding{
+				{Role: "roles/bigquery.dataViewer", Members: []string{"projectViewer:demo-project", "serviceAccount:etl@demo-project.iam.gserviceaccount.com"}},
+				{
+					Role:      "roles/bigquery.dataEditor",
+					Members:   []string{"user:bob@example.com"},
+					Condition: &cloudasset.Expr{Title: "until-june", Expression: "request.time < timestamp('2024-06-01T00:00:00Z')"},
+				},
+			},
+		},
+	})
+
+	policy := index.projectPolicy("demo-project")
+	require.True(t, policyHasMember(policy, "user:alice@example.com"))
+	require.Equal(t, []string{"sales"}, index.datasetIDs["demo-project"])
+
+	dataset := index.datasets[datasetResourceID("demo-project", "sales")]
+	require.Equal(t, "EU", dataset.Location)
+	require.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).UnixMilli(), dataset.CreationTime)
+	require.Len(t, dataset.Access, 3)
+	require.Equal(t, "projectReaders", dataset.Access[0].SpecialGroup)
+	require.Equal(t, "serviceAccount:etl@demo-project.iam.gserviceaccount.com", dataset.Access[1].IamMember)
+	require.Equal(t, "bob@example.com", dataset.Access[2].UserByEmail)
+	require.Equal(t, "roles/bigquery.dataEditor", dataset.Access[2].Role)
+	require.Equal(t, "until-june", dataset.Access[2].Condition.Title)
+}
+
+func TestDenyEvaluator(t *testing.T) {
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"}
+	organization := &v2.ResourceId{ResourceType: organizationResourceType.Id, Resource: "456"}
+	require.Equal(t, "policies/cloudresourcemanager.googleapis.com%2Forganizations%2F456/denypolicies", denyAttachmentPoint(organization))
+
+	policy := &iamv2pb.Policy{
+		Name:        denyAttachmentPoint(organization) + "/no-exports",
+		DisplayName: "No exports",
+		Rules: []*iamv2pb.PolicyRule{
+			{Kind: &iamv2pb.PolicyRule_DenyRule{DenyRule: &iamv2pb.DenyRule{
+				DeniedPrincipals:     []string{"principalSet://goog/public:all"},
+				ExceptionPrincipals:  []string{"principal://iam.googleapis.com/projects/-/serviceAccounts/etl@demo-project.iam.gserviceaccount.com"},
+				DeniedPermissions:    []string{"bigquery.googleapis.com/tables.export", "bigquery.googleapis.com/datasets.*"},
+				ExceptionPermissions: []string{"bigquery.googleapis.com/datasets.get"},
+			}}},
+			{Kind: &iamv2pb.PolicyRule_DenyRule{DenyRule: &iamv2pb.DenyRule{
+				DeniedPrincipals:  []string{"principal://goog/subject/bob@example.com"},
+				DeniedPermissions: []string{"bigquery.googleapis.com/tables.getData"},
+			}}},
+		},
+	}
+
+	e := newDenyEvaluator(nil, nil, nil, nil)
+	e.ancestors["demo-project"] = []*v2.ResourceId{project, organization}
+	e.policies[denyAttachmentPoint(project)] = nil
+	e.policies[denyAttachmentPoint(organization)] = []*iamv2pb.Policy{policy}
+	e.permissions["roles/bigquery.dataViewer"] = []string{
+		"bigquery.datasets.get",
+		"bigquery.datasets.getIamPolicy",
+		"bigquery.tables.export",
+		"bigquery.tables.getData",
+		"resourcemanager.projects.get",
+	}
+
+	role, err := roleResource("roles/bigquery.dataViewer", project)
+	require.NoError(t, err)
+	principal := func(email string) *v2.ResourceId {
+		return &v2.ResourceId{ResourceType: userResourceType.Id, Resource: email}
+	}
+	bob := grant.NewGrant(role, assignedEntitlement, principal("bob@example.com"))
+	etl := grant.NewGrant(role, assignedEntitlement, principal("etl@demo-project.iam.gserviceaccount.com"))
+	require.NoError(t, e.annotateGrants(ctxTest, "demo-project", "roles/bigquery.dataViewer", []*v2.Grant{bob, etl}))
+
+	md := &v2.GrantMetadata{}
+	annos := annotations.Annotations(bob.GetAnnotations())
+	ok, err := annos.Pick(md)
+	require.NoError(t, err)
+	require.True(t, ok)
+	fields := md.GetMetadata().GetFields()
+	require.Equal(t, policy.Name, fields["denied_by"].GetListValue().GetValues()[0].GetStringValue())
+	var denied []string
+	for _, v := range fields["denied_permissions"].GetListValue().GetValues() {
+		denied = append(denied, v.GetStringValue())
+	}
+	require.Equal(t, []string{"bigquery.datasets.getIamPolicy", "bigquery.tables.export", "bigquery.tables.getData"}, denied)
+	require.False(t, fields["denial_conditional"].GetBoolValue())
+
+	// The service account is an exception principal of the first rule and not named by the second.
+	require.Empty(t, etl.GetAnnotations())
+
+	resource, err := denyPolicyResource(policy, organization)
+	require.NoError(t, err)
+	require.Equal(t, "No exports", resource.GetDisplayName())
+	require.Equal(t, organization, resource.GetParentResourceId())
+
+	// A new sync reads the policies, ancestries and role permissions again.
+	e.reset()
+	require.Empty(t, e.policies)
+	require.Empty(t, e.ancestors)
+	require.Empty(t, e.permissions)
+}
+
+func TestImpersonationGrants(t *testing.T) {
+	sa, err := userResource("etl@demo-project.iam.gserviceaccount.com", nil, rs.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE))
+	require.NoError(t, err)
+	require.True(t, isServiceAccountResource(sa))
+	require.Equal(t, "demo-project", serviceAccountProject(sa.GetId().GetResource()))
+	require.Empty(t, serviceAccountProject("123-compute@developer.gserviceaccount.com"))
+
+	seen := make(map[string]struct{})
+	direct := impersonationPolicyGrants(ctxTest, sa, &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/iam.serviceAccountUser", Members: []string{"user:alice@example.com"}},
+			{Role: "roles/iam.serviceAccountTokenCreator", Members: []string{"serviceAccount:ci@demo-project.iam.gserviceaccount.com", "group:ops@example.com"}},
+		},
+	}, "", seen)
+	inherited := impersonationPolicyGrants(ctxTest, sa, &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/iam.serviceAccountUser", Members: []string{"user:alice@example.com", "user:bob@example.com"}},
+			{Role: "roles/bigquery.admin", Members: []string{"user:carol@example.com"}},
+		},
+	}, "projects/demo-project", seen)
+
+	require.Len(t, direct, 2)
+	require.Equal(t, "user:etl@demo-project.iam.gserviceaccount.com:service_account_user", direct[0].GetEntitlement().GetId())
+	require.Equal(t, "alice@example.com", direct[0].GetPrincipal().GetId().GetResource())
+
+	// A service account able to mint tokens passes on the access of the service accounts it impersonates.
+	expandable := &v2.GrantExpandable{}
+	annos := annotations.Annotations(direct[1].GetAnnotations())
+	ok, err := annos.Pick(expandable)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []string{
+		"user:ci@demo-project.iam.gserviceaccount.com:service_account_user",
+		"user:ci@demo-project.iam.gserviceaccount.com:token_creator",
+	}, expandable.GetEntitlementIds())
+
+	require.Len(t, inherited, 1)
+	require.Equal(t, "bob@example.com", inherited[0].GetPrincipal().GetId().GetResource())
+	md := &v2.GrantMetadata{}
+	annos = annotations.Annotations(inherited[0].GetAnnotations())
+	ok, err = annos.Pick(md)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "projects/demo-project", md.GetMetadata().GetFields()["inherited_from"].GetStringValue())
+}
@@ -0,0 +1,190 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	iamadmin "cloud.google.com/go/iam/admin/apiv1"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// serviceAccountUserEntitlement is held by the principals allowed to attach or act as a service account.
+	serviceAccountUserEntitlement = "service_account_user"
+	// tokenCreatorEntitlement is held by the principals allowed to mint tokens for a service account.
+	tokenCreatorEntitlement = "token_creator"
+)
+
+// impersonationRoles maps the roles that let a principal impersonate a service account to the entitlement of the
+// service account they are synced as.
+var impersonationRoles = map[string]string{
+	"roles/iam.serviceAccountUser":         serviceAccountUserEntitlement,
+	"roles/iam.serviceAccountTokenCreator": tokenCreatorEntitlement,
+}
+
+// serviceAccountGrant returns a grant to a service account, expanded to the principals able to impersonate it so
+// that they are reported with the access of the service account.
+func serviceAccountGrant(resource *v2.Resource, entitlement string, email string) *v2.Grant {
+	principalID := &v2.ResourceId{
+		ResourceType: userResourceType.Id,
+		Resource:     email,
+	}
+	principal := &v2.Resource{Id: principalID}
+
+	return grant.NewGrant(resource, entitlement, principalID,
+		grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{
+				ent.NewEntitlementID(principal, serviceAccountUserEntitlement),
+				ent.NewEntitlementID(principal, tokenCreatorEntitlement),
+			},
+		}),
+	)
+}
+
+// isServiceAccountResource reports whether a user resource is a service account that is still present.
+func isServiceAccountResource(resource *v2.Resource) bool {
+	if strings.HasPrefix(resource.GetId().GetResource(), deletedMemberPrefix) {
+		return false
+	}
+	if trait, err := rs.GetUserTrait(resource); err == nil {
+		return trait.GetAccountType() == v2.UserTrait_ACCOUNT_TYPE_SERVICE
+	}
+
+	return isServiceAccountEmail(resource.GetId().GetResource())
+}
+
+// serviceAccountProject returns the ID of the project a user-managed service account belongs to. Google-managed
+// service accounts are not named after a project.
+func serviceAccountProject(email string) string {
+	_, domain, found := strings.Cut(email, "@")
+	if !found {
+		return ""
+	}
+
+	projectID, found := strings.CutSuffix(domain, ".iam.gserviceaccount.com")
+	if !found {
+		return ""
+	}
+
+	return projectID
+}
+
+func impersonationEntitlements(resource *v2.Resource) []*v2.Entitlement {
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(resource, serviceAccountUserEntitlement,
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("Can act as the %s service account", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s service account user", resource.DisplayName)),
+		),
+		ent.NewPermissionEntitlement(resource, tokenCreatorEntitlement,
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("Can create tokens for the %s service account", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s service account token creator", resource.DisplayName)),
+		),
+	}
+}
+
+// impersonationGrants returns the principals able to impersonate a service account: those bound to an impersonation
+// role on the service account itself, read with the IAM client when there is one, and on its project, which
+// applies to every service account of the project.
+func impersonationGrants(ctx context.Context, iamClient *iamadmin.IamClient, backend policyBackend, resource *v2.Resource) ([]*v2.Grant, error) {
+	l := ctxzap.Extract(ctx)
+	email := resource.GetId().GetResource()
+	seen := make(map[string]struct{})
+	var grants []*v2.Grant
+
+	if iamClient != nil {
+		policy, err := iamClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+			Resource: "projects/-/serviceAccounts/" + email,
+		})
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				l.Debug("Service account not found", zap.String("service_account", email))
+			} else if !isPermissionDenied(ctx, err) {
+				return nil, wrapError(err, "Unable to fetch IAM policy of service account "+email)
+			}
+		}
+		if policy != nil {
+			grants = append(grants, impersonationPolicyGrants(ctx, resource, policy.InternalProto, "", seen)...)
+		}
+	}
+
+	if projectID := serviceAccountProject(email); projectID != "" {
+		policy, err := backend.ProjectPolicy(ctx, projectID)
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, wrapError(err, "Unable to fetch IAM policy of project "+projectID)
+			}
+		}
+		grants = append(grants, impersonationPolicyGrants(ctx, resource, policy, "projects/"+projectID, seen)...)
+	}
+
+	return grants, nil
+}
+
+// impersonationPolicyGrants returns the grants of the impersonation role bindings of a policy. A principal bound
+// both on the service account and on its project is only granted once, from the service account policy.
+func impersonationPolicyGrants(ctx context.Context, resource *v2.Resource, policy *iampb.Policy, inheritedFrom string, seen map[string]struct{}) []*v2.Grant {
+	l := ctxzap.Extract(ctx)
+	var grants []*v2.Grant
+
+	for _, binding := range policy.GetBindings() {
+		entitlement, ok := impersonationRoles[binding.Role]
+		if !ok {
+			continue
+		}
+
+		for _, member := range binding.Members {
+			principalID, ok := iamMemberPrincipalID(member)
+			if !ok {
+				l.Debug("Skipping impersonation member that is not a user", zap.String("member", member))
+				continue
+			}
+			if principalID.GetResource() == resource.GetId().GetResource() {
+				continue
+			}
+
+			key := entitlement + "/" + principalID.GetResource()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			var g *v2.Grant
+			if ok, email := isServiceAccount(member); ok {
+				// Impersonation chains through service accounts able to impersonate other service accounts.
+				g = serviceAccountGrant(resource, entitlement, email)
+			} else {
+				g = grant.NewGrant(resource, entitlement, principalID)
+			}
+
+			metadata := make(map[string]interface{})
+			if inheritedFrom != "" {
+				metadata["inherited_from"] = inheritedFrom
+			}
+			if binding.Condition != nil {
+				metadata["condition_title"] = binding.Condition.Title
+				metadata["condition_description"] = binding.Condition.Description
+				metadata["condition_expression"] = binding.Condition.Expression
+			}
+			if len(metadata) > 0 {
+				if err := addGrantMetadata(g, metadata); err != nil {
+					l.Warn("unable to annotate impersonation grant", zap.String("grant", g.GetId()), zap.Error(err))
+				}
+			}
+
+			grants = append(grants, g)
+		}
+	}
+
+	return grants
+}
@@ -17,7 +17,7 @@ var (
 )
 
 func getClientForTesting(ctx context.Context) (*GoogleBigQuery, error) {
-	return New(ctx, jsonFilePath)
+	return New(ctx, &Config{CredentialsJSONFilePath: jsonFilePath})
 }
 
 func TestUserBuilderList(t *testing.T) {
@@ -28,11 +28,7 @@ func TestUserBuilderList(t *testing.T) {
 	cliTest, err := getClientForTesting(ctxTest)
 	require.Nil(t, err)
 
-	u := &userBuilder{
-		resourceType:   userResourceType,
-		BigQueryClient: cliTest.BigQueryClient,
-		ProjectsClient: cliTest.ProjectsClient,
-	}
+	u := newUserBuilder(cliTest.ProjectsClient, cliTest.BigQueryClient, cliTest.backend, cliTest.IamClient, nil, nil, nil)
 
 	_, _, _, err = u.List(ctxTest, &v2.ResourceId{}, &pagination.Token{})
 	require.Nil(t, err)
@@ -46,11 +42,7 @@ func TestProjectBuilderList(t *testing.T) {
 	cliTest, err := getClientForTesting(ctxTest)
 	require.Nil(t, err)
 
-	p := &projectBuilder{
-		resourceType:   projectResourceType,
-		bigQueryClient: cliTest.BigQueryClient,
-		projectsClient: cliTest.ProjectsClient,
-	}
+	p := newProjectBuilder(cliTest.ProjectsClient, cliTest.BigQueryClient, cliTest.backend, true)
 
 	var token = "{}"
 	for token != "" {
@@ -100,11 +92,7 @@ func TestRoleBuilderList(t *testing.T) {
 	cliTest, err := getClientForTesting(ctxTest)
 	require.Nil(t, err)
 
-	u := &roleBuilder{
-		resourceType:   datasetResourceType,
-		bigQueryClient: cliTest.BigQueryClient,
-		projectsClient: cliTest.ProjectsClient,
-	}
+	u := newRoleBuilder(cliTest.ProjectsClient, cliTest.BigQueryClient, cliTest.backend, nil)
 
 	_, _, _, err = u.List(ctxTest, &v2.ResourceId{}, &pagination.Token{})
 	require.Nil(t, err)
@@ -121,11 +109,7 @@ func TestDatasetBuilderList(t *testing.T) {
 	cliTest, err := getClientForTesting(ctxTest)
 	require.Nil(t, err)
 
-	o := &datasetBuilder{
-		resourceType:   datasetResourceType,
-		bigQueryClient: cliTest.BigQueryClient,
-		projectsClient: cliTest.ProjectsClient,
-	}
+	o := newDatasetBuilder(cliTest.BigQueryClient, cliTest.BigQueryService, cliTest.ProjectsClient, cliTest.backend, nil, nil)
 
 	_, _, _, err = o.List(ctxTest, &v2.ResourceId{}, &pagination.Token{})
 	require.Nil(t, err)
@@ -143,14 +127,10 @@ func TestDatasetGrants(t *testing.T) {
 	cliTest, err := getClientForTesting(ctxTest)
 	require.Nil(t, err)
 
-	d := &datasetBuilder{
-		resourceType:   datasetResourceType,
-		bigQueryClient: cliTest.BigQueryClient,
-		projectsClient: cliTest.ProjectsClient,
-	}
+	d := newDatasetBuilder(cliTest.BigQueryClient, cliTest.BigQueryService, cliTest.ProjectsClient, cliTest.backend, nil, nil)
 
 	_, _, _, err = d.Grants(ctxTest, &v2.Resource{
-		Id:               &v2.ResourceId{ResourceType: datasetResourceType.Id, Resource: datasetID},
+		Id:               &v2.ResourceId{ResourceType: datasetResourceType.Id, Resource: datasetResourceID(projectId, datasetID)},
 		ParentResourceId: &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: projectId},
 	}, &pagination.Token{})
 	require.Nil(t, err)
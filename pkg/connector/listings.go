@@ -0,0 +1,177 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	analyticshub "cloud.google.com/go/bigquery/analyticshub/apiv1"
+	"cloud.google.com/go/bigquery/analyticshub/apiv1/analyticshubpb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// sourceEntitlement links a listing to the dataset it shares.
+	sourceEntitlement = "source"
+	// linkedEntitlement links a listing to the datasets its subscribers created from it.
+	linkedEntitlement = "linked"
+)
+
+type listingBuilder struct {
+	resourceType       *v2.ResourceType
+	analyticsHubClient *analyticshub.Client
+}
+
+func (o *listingBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return listingResourceType
+}
+
+// List returns the listings of the parent data exchange.
+func (o *listingBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != dataExchangeResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	it := o.analyticsHubClient.ListListings(ctx, &analyticshubpb.ListListingsRequest{
+		Parent: parentResourceID.GetResource(),
+	})
+	for {
+		listing, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch listings")
+			}
+			break
+		}
+
+		resource, err := listingResource(listing, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create listing resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *listingBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	rv := analyticsHubEntitlements(resource, "listing")
+
+	rv = append(rv,
+		ent.NewAssignmentEntitlement(resource, sourceEntitlement,
+			ent.WithGrantableTo(datasetResourceType),
+			ent.WithDescription(fmt.Sprintf("Dataset shared by %s listing", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s listing %s", resource.DisplayName, sourceEntitlement)),
+		),
+		ent.NewAssignmentEntitlement(resource, linkedEntitlement,
+			ent.WithGrantableTo(datasetResourceType),
+			ent.WithDescription(fmt.Sprintf("Dataset linked from %s listing by a subscriber", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s listing %s", resource.DisplayName, linkedEntitlement)),
+		),
+	)
+
+	return rv, "", nil, nil
+}
+
+// Grants returns the IAM grants of the listing, plus its source dataset and the datasets linked by its subscribers.
+func (o *listingBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	grants, err := analyticsHubGrants(ctx, o.analyticsHubClient, resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	listing, err := o.analyticsHubClient.GetListing(ctx, &analyticshubpb.GetListingRequest{
+		Name: resource.Id.Resource,
+	})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "Unable to fetch listing "+resource.Id.Resource)
+		}
+		return grants, "", nil, nil
+	}
+
+	if projectID, datasetID := parseResourceName(listing.GetBigqueryDataset().GetDataset()); datasetID != "" {
+		grants = append(grants, grant.NewGrant(resource, sourceEntitlement, &v2.ResourceId{
+			ResourceType: datasetResourceType.Id,
+			Resource:     datasetResourceID(projectID, datasetID),
+		}))
+	}
+
+	// Subscriptions are only visible to publishers, without the permission the listing only reports its source.
+	it := o.analyticsHubClient.ListSharedResourceSubscriptions(ctx, &analyticshubpb.ListSharedResourceSubscriptionsRequest{
+		Resource: resource.Id.Resource,
+	})
+	for {
+		subscription, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch subscriptions of listing "+resource.Id.Resource)
+			}
+			break
+		}
+
+		for _, linked := range subscription.GetLinkedDatasetMap() {
+			projectID, datasetID := parseResourceName(linked.GetLinkedDataset())
+			if datasetID == "" {
+				l.Debug("Skipping linked resource that is not a dataset", zap.String("subscription", subscription.GetName()))
+				continue
+			}
+
+			grants = append(grants, grant.NewGrant(resource, linkedEntitlement, &v2.ResourceId{
+				ResourceType: datasetResourceType.Id,
+				Resource:     datasetResourceID(projectID, datasetID),
+			}))
+		}
+	}
+
+	return grants, "", nil, nil
+}
+
+func listingResource(listing *analyticshubpb.Listing, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":            listing.GetName(),
+		"display_name":    listing.GetDisplayName(),
+		"description":     listing.GetDescription(),
+		"primary_contact": listing.GetPrimaryContact(),
+		"state":           listing.GetState().String(),
+		"discovery_type":  listing.GetDiscoveryType().String(),
+	}
+	if projectID, datasetID := parseResourceName(listing.GetBigqueryDataset().GetDataset()); datasetID != "" {
+		profile["source_dataset"] = datasetResourceID(projectID, datasetID)
+	}
+	if listing.GetRestrictedExportConfig().GetEnabled() {
+		profile["restricted_export"] = true
+	}
+
+	return rs.NewResource(
+		listing.GetDisplayName(),
+		listingResourceType,
+		listing.GetName(),
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newListingBuilder(analyticsHubClient *analyticshub.Client) *listingBuilder {
+	return &listingBuilder{
+		resourceType:       listingResourceType,
+		analyticsHubClient: analyticsHubClient,
+	}
+}
@@ -0,0 +1,91 @@
+package connector
+
+import (
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestListingSync(t *testing.T) {
+	hub, client := newFakeAnalyticsHub(t)
+	exchange := hub.addExchange("projects/demo-project/locations/us", "sharing")
+	listing := hub.addListing(exchange, "sales", "projects/demo-project/datasets/sales",
+		"projects/partner-project/datasets/sales_link",
+		"projects/other-partner/datasets/sales_copy",
+	)
+	hub.setPolicy(listing, &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/analyticshub.subscriber", Members: []string{"user:alice@example.com"}},
+			{Role: "roles/owner", Members: []string{"user:owner@example.com"}},
+		},
+	})
+
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"}
+	exchanges, err := listAll(newDataExchangeBuilder(client, []string{"US"}), project)
+	require.NoError(t, err)
+	require.Len(t, exchanges, 1)
+	require.Equal(t, exchange, exchanges[0].GetId().GetResource())
+
+	builder := newListingBuilder(client)
+	listings, err := listAll(builder, exchanges[0].GetId())
+	require.NoError(t, err)
+	require.Len(t, listings, 1)
+	require.Equal(t, "demo-project:sales", listings[0].GetProfile().GetFields()["source_dataset"].GetStringValue())
+
+	grants, _, _, err := builder.Grants(ctxTest, listings[0], &pagination.Token{})
+	require.NoError(t, err)
+	got := make(map[string]string)
+	for _, g := range grants {
+		got[g.GetPrincipal().GetId().GetResource()] = entitlementSlug(g.GetEntitlement())
+	}
+	require.Equal(t, map[string]string{
+		"alice@example.com":          "roles/analyticshub.subscriber",
+		"demo-project:sales":         sourceEntitlement,
+		"partner-project:sales_link": linkedEntitlement,
+		"other-partner:sales_copy":   linkedEntitlement,
+	}, got)
+}
+
+func TestListingListErrors(t *testing.T) {
+	hub, client := newFakeAnalyticsHub(t)
+	first := hub.addExchange("projects/demo-project/locations/us", "sharing")
+	hub.addExchange("projects/demo-project/locations/us", "archive")
+	hub.addListing(first, "sales", "projects/demo-project/datasets/sales")
+	listing := hub.addListing(first, "orders", "projects/demo-project/datasets/orders",
+		"projects/partner-project/datasets/orders_link",
+		"projects/other-partner/datasets/orders_copy",
+	)
+
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"}
+	exchange := &v2.ResourceId{ResourceType: dataExchangeResourceType.Id, Resource: first}
+	exchanges := newDataExchangeBuilder(client, []string{"US"})
+	builder := newListingBuilder(client)
+	listingResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: listingResourceType.Id, Resource: listing}}
+
+	// A list failing after its first page fails the sync, it must not leave the next pages out.
+	hub.setListError(status.Error(codes.Internal, "backend error"), 1)
+	_, err := listAll(exchanges, project)
+	require.ErrorContains(t, err, "backend error")
+	_, err = listAll(builder, exchange)
+	require.ErrorContains(t, err, "backend error")
+	_, _, _, err = builder.Grants(ctxTest, listingResource, &pagination.Token{})
+	require.ErrorContains(t, err, "backend error")
+
+	// Without permission to list, nothing is synced and the sync goes on.
+	hub.setListError(status.Error(codes.PermissionDenied, "permission denied"), 0)
+	resources, err := listAll(exchanges, project)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+	resources, err = listAll(builder, exchange)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+	grants, _, _, err := builder.Grants(ctxTest, listingResource, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, sourceEntitlement, entitlementSlug(grants[0].GetEntitlement()))
+}
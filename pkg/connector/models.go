@@ -0,0 +1,127 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/api/iterator"
+)
+
+type modelBuilder struct {
+	resourceType   *v2.ResourceType
+	bigQueryClient *bigquery.Client
+}
+
+func (o *modelBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return modelResourceType
+}
+
+// List returns the BigQuery ML models of the parent dataset.
+func (o *modelBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != datasetResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	projectID, datasetID := parseDatasetResourceID(parentResourceID.GetResource())
+	it := o.bigQueryClient.DatasetInProject(projectID, datasetID).Models(ctx)
+	for {
+		model, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch models")
+			}
+			break
+		}
+
+		metadata, err := model.Metadata(ctx)
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch model metadata (model:"+model.FullyQualifiedName()+")")
+			}
+			metadata = nil
+		}
+
+		resource, err := modelResource(projectID, datasetID, model.ModelID, metadata, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create model resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+// Entitlements is empty, BigQuery does not expose IAM policies on models: access follows the dataset.
+func (o *modelBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *modelBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// modelResource creates a model resource, metadata is nil when the model cannot be read.
+func modelResource(projectID string, datasetID string, modelID string, metadata *bigquery.ModelMetadata, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":       modelID,
+		"project_id": projectID,
+		"dataset_id": datasetID,
+		"model_id":   modelID,
+	}
+
+	if metadata != nil {
+		profile["type"] = metadata.Type
+		profile["location"] = metadata.Location
+		if metadata.Name != "" {
+			profile["friendly_name"] = metadata.Name
+		}
+		if metadata.Description != "" {
+			profile["description"] = metadata.Description
+		}
+		if len(metadata.Labels) > 0 {
+			labels := make(map[string]interface{}, len(metadata.Labels))
+			for key, value := range metadata.Labels {
+				labels[key] = value
+			}
+			profile["labels"] = labels
+		}
+		if metadata.EncryptionConfig != nil && metadata.EncryptionConfig.KMSKeyName != "" {
+			profile["kms_key_name"] = metadata.EncryptionConfig.KMSKeyName
+		}
+		if !metadata.CreationTime.IsZero() {
+			profile["creation_time"] = metadata.CreationTime.UTC().Format(time.RFC3339)
+		}
+		if !metadata.LastModifiedTime.IsZero() {
+			profile["last_modified_time"] = metadata.LastModifiedTime.UTC().Format(time.RFC3339)
+		}
+		if !metadata.ExpirationTime.IsZero() {
+			profile["expiration_time"] = metadata.ExpirationTime.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return rs.NewResource(
+		modelID,
+		modelResourceType,
+		datasetChildResourceID(projectID, datasetID, modelID),
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newModelBuilder(bigQueryClient *bigquery.Client) *modelBuilder {
+	return &modelBuilder{
+		resourceType:   modelResourceType,
+		bigQueryClient: bigQueryClient,
+	}
+}
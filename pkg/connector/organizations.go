@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/api/iterator"
+)
+
+type organizationBuilder struct {
+	resourceType        *v2.ResourceType
+	organizationsClient *resourcemanager.OrganizationsClient
+}
+
+func (o *organizationBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return organizationResourceType
+}
+
+// List returns the organizations visible to the credentials, they are synced so that folders and projects can
+// reference them as parent.
+func (o *organizationBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var (
+		resources []*v2.Resource
+		bag       = &pagination.Bag{}
+	)
+	err := bag.Unmarshal(pToken.Token)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if bag.Current() == nil {
+		bag.Push(pagination.PageState{
+			ResourceTypeID: organizationResourceType.Id,
+		})
+	}
+
+	it := o.organizationsClient.SearchOrganizations(ctx,
+		&resourcemanagerpb.SearchOrganizationsRequest{
+			PageToken: bag.PageToken(),
+		},
+	)
+
+	for {
+		organization, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch organizations")
+			}
+			break
+		}
+
+		resource, err := organizationResource(organization)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create organization resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	err = bag.Next(it.PageInfo().Token)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
+	}
+
+	pageToken, err := bag.Marshal()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return resources, pageToken, nil, nil
+}
+
+func (o *organizationBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *organizationBuilder) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func organizationResource(organization *resourcemanagerpb.Organization) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":                organization.Name,
+		"displayName":         organization.DisplayName,
+		"state":               organization.State.String(),
+		"directoryCustomerId": organization.GetDirectoryCustomerId(),
+	}
+	addLifecycleProfileFields(profile, organization.CreateTime, organization.UpdateTime, organization.DeleteTime)
+
+	opts := []rs.ResourceOption{
+		rs.WithResourceProfile(profile),
+		rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: denyPolicyResourceType.Id}),
+	}
+	opts = append(opts, lifecycleStatus(organization.State.String(), organization.DeleteTime)...)
+
+	return rs.NewResource(
+		organization.DisplayName,
+		organizationResourceType,
+		strings.TrimPrefix(organization.Name, "organizations/"),
+		opts...,
+	)
+}
+
+func newOrganizationBuilder(organizationsClient *resourcemanager.OrganizationsClient) *organizationBuilder {
+	return &organizationBuilder{
+		resourceType:        organizationResourceType,
+		organizationsClient: organizationsClient,
+	}
+}
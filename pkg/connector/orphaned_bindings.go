@@ -0,0 +1,212 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	removeOrphanedBindingsAction = "remove_orphaned_bindings"
+
+	dryRunActionArg = "dry_run"
+)
+
+var removeOrphanedBindingsSchema = v2.BatonActionSchema_builder{
+	Name:        removeOrphanedBindingsAction,
+	DisplayName: "Remove orphaned bindings",
+	Description: "Remove deleted users and service accounts from project IAM policies and dataset access lists.",
+	Arguments: []*config.Field{
+		config.Field_builder{
+			Name:        projectActionArg,
+			DisplayName: "Project ID",
+			Description: "Only clean up this project. All projects visible to the connector are cleaned up when empty.",
+			StringField: &config.StringField{},
+		}.Build(),
+		config.Field_builder{
+			Name:        dryRunActionArg,
+			DisplayName: "Dry run",
+			Description: "Report the orphaned bindings without removing them.",
+			BoolField:   &config.BoolField{},
+		}.Build(),
+	},
+	ReturnTypes: []*config.Field{
+		config.Field_builder{Name: "success", DisplayName: "Success", BoolField: &config.BoolField{}}.Build(),
+		config.Field_builder{Name: "removed_project_bindings", DisplayName: "Removed project bindings", IntField: &config.IntField{}}.Build(),
+		config.Field_builder{Name: "removed_dataset_entries", DisplayName: "Removed dataset entries", IntField: &config.IntField{}}.Build(),
+		config.Field_builder{Name: "orphaned_bindings", DisplayName: "Orphaned bindings", StringSliceField: &config.StringSliceField{}}.Build(),
+	},
+}.Build()
+
+// GlobalActions registers the connector wide actions.
+func (d *GoogleBigQuery) GlobalActions(ctx context.Context, registry actions.ActionRegistry) error {
+	if d.offline() {
+		return nil
+	}
+
+	return registry.Register(ctx, removeOrphanedBindingsSchema, d.removeOrphanedBindings)
+}
+
+// removeOrphanedBindings removes the members of deleted principals from project IAM policies and dataset ACLs.
+func (d *GoogleBigQuery) removeOrphanedBindings(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	dryRun, _ := actions.GetBoolArg(args, dryRunActionArg)
+
+	var projectIDs []string
+	if projectID, ok := actions.GetStringArg(args, projectActionArg); ok && projectID != "" {
+		projectIDs = append(projectIDs, projectID)
+	} else {
+		it := d.ProjectsClient.SearchProjects(ctx, &resourcemanagerpb.SearchProjectsRequest{})
+		for {
+			project, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, nil, wrapError(err, "Unable to fetch projects")
+			}
+			projectIDs = append(projectIDs, project.ProjectId)
+		}
+	}
+
+	var (
+		orphaned               []string
+		removedProjectBindings int
+		removedDatasetEntries  int
+	)
+	for _, projectID := range projectIDs {
+		removed, err := d.removeOrphanedProjectBindings(ctx, projectID, dryRun)
+		if err != nil {
+			return nil, nil, err
+		}
+		removedProjectBindings += len(removed)
+		orphaned = append(orphaned, removed...)
+
+		removed, err = d.removeOrphanedDatasetEntries(ctx, projectID, dryRun)
+		if err != nil {
+			return nil, nil, err
+		}
+		removedDatasetEntries += len(removed)
+		orphaned = append(orphaned, removed...)
+	}
+
+	l.Info("orphaned bindings processed",
+		zap.Bool("dry_run", dryRun),
+		zap.Int("removed_project_bindings", removedProjectBindings),
+		zap.Int("removed_dataset_entries", removedDatasetEntries))
+
+	return actions.NewReturnValues(true,
+		intReturnField("removed_project_bindings", removedProjectBindings),
+		intReturnField("removed_dataset_entries", removedDatasetEntries),
+		actions.NewStringListReturnField("orphaned_bindings", orphaned),
+	), nil, nil
+}
+
+// removeOrphanedProjectBindings drops deleted members from the project policy, bindings left without members are removed.
+// Version 3 is requested so that conditional bindings survive the round trip.
+func (d *GoogleBigQuery) removeOrphanedProjectBindings(ctx context.Context, projectID string, dryRun bool) ([]string, error) {
+	resource := fmt.Sprintf("projects/%s", projectID)
+	policy, err := d.ProjectsClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: resource,
+		Options: &iampb.GetPolicyOptions{
+			RequestedPolicyVersion: 3,
+		},
+	})
+	if err != nil {
+		return nil, wrapError(err, "failed to get IAM policy of project "+projectID)
+	}
+
+	var (
+		removed  []string
+		bindings []*iampb.Binding
+	)
+	for _, binding := range policy.Bindings {
+		var members []string
+		for _, member := range binding.Members {
+			if isDeleted, _, _ := isDeletedUserOrServiceAccountMember(member); isDeleted {
+				removed = append(removed, fmt.Sprintf("%s %s %s", resource, binding.Role, member))
+				continue
+			}
+			members = append(members, member)
+		}
+
+		if len(members) == 0 {
+			continue
+		}
+		binding.Members = members
+		bindings = append(bindings, binding)
+	}
+
+	if len(removed) == 0 || dryRun {
+		return removed, nil
+	}
+
+	policy.Bindings = bindings
+	_, err = d.ProjectsClient.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+		Resource: resource,
+		Policy:   policy,
+	})
+	if err != nil {
+		return nil, wrapError(err, "failed to update IAM policy of project "+projectID)
+	}
+
+	return removed, nil
+}
+
+// removeOrphanedDatasetEntries drops the access entries of deleted principals from every dataset of the project.
+func (d *GoogleBigQuery) removeOrphanedDatasetEntries(ctx context.Context, projectID string, dryRun bool) ([]string, error) {
+	var removed []string
+	it := d.BigQueryClient.Datasets(ctx)
+	it.ProjectID = projectID
+	for {
+		ds, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, wrapError(err, "Unable to fetch datasets of project "+projectID)
+		}
+
+		meta, err := ds.Metadata(ctx)
+		if err != nil {
+			return nil, wrapError(err, "Unable to fetch dataset metadata (projectId:"+projectID+" datasetID:"+ds.DatasetID+")")
+		}
+
+		// A nil access list leaves the dataset access untouched, an empty one removes every entry.
+		access := make([]*bigquery.AccessEntry, 0, len(meta.Access))
+		var orphaned []string
+		for _, entry := range meta.Access {
+			if isDeleted, _, _ := isDeletedUserOrServiceAccountMember(entry.Entity); isDeleted {
+				orphaned = append(orphaned, fmt.Sprintf("%s %s %s", datasetResourceID(projectID, ds.DatasetID), entry.Role, entry.Entity))
+				continue
+			}
+			access = append(access, entry)
+		}
+
+		if len(orphaned) == 0 {
+			continue
+		}
+		removed = append(removed, orphaned...)
+		if dryRun {
+			continue
+		}
+
+		if _, err := ds.Update(ctx, bigquery.DatasetMetadataToUpdate{Access: access}, meta.ETag); err != nil {
+			return nil, wrapError(err, "Unable to update dataset access (projectId:"+projectID+" datasetID:"+ds.DatasetID+")")
+		}
+	}
+
+	return removed, nil
+}
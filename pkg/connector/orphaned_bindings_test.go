@@ -0,0 +1,85 @@
+package connector
+
+import (
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestRemoveOrphanedBindings(t *testing.T) {
+	bq, client, _ := newFakeBigQuery(t)
+	iam, opts := newFakeIAM(t)
+	projectsClient, err := resourcemanager.NewProjectsClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = projectsClient.Close() })
+	d := &GoogleBigQuery{ProjectsClient: projectsClient, BigQueryClient: client}
+
+	iam.addProject("demo-project")
+	iam.addProject("other-project")
+	iam.setPolicy("projects/demo-project", &iampb.Policy{
+		Version: 3,
+		Etag:    []byte("1"),
+		Bindings: []*iampb.Binding{
+			{Role: "roles/owner", Members: []string{"user:owner@example.com", "deleted:user:bob@example.com?uid=1"}},
+			{Role: "roles/bigquery.jobUser", Members: []string{"deleted:serviceAccount:etl@demo-project.iam.gserviceaccount.com?uid=2"}},
+			{
+				Role:      "roles/bigquery.dataViewer",
+				Members:   []string{"user:alice@example.com"},
+				Condition: &expr.Expr{Title: "expires", Expression: `request.time < timestamp("2030-01-01T00:00:00Z")`},
+			},
+		},
+	})
+	bq.addDataset("demo-project", "sales",
+		&bigqueryapi.DatasetAccess{Role: "OWNER", UserByEmail: "owner@example.com"},
+		&bigqueryapi.DatasetAccess{Role: "READER", IamMember: "deleted:user:carol@example.com?uid=3"},
+	)
+	bq.addDataset("demo-project", "clean",
+		&bigqueryapi.DatasetAccess{Role: "OWNER", UserByEmail: "owner@example.com"},
+	)
+	bq.addDataset("other-project", "events",
+		&bigqueryapi.DatasetAccess{Role: "WRITER", IamMember: "deleted:serviceAccount:old@other-project.iam.gserviceaccount.com?uid=4"},
+	)
+
+	args, err := structpb.NewStruct(map[string]interface{}{dryRunActionArg: true})
+	require.NoError(t, err)
+	rv, _, err := d.removeOrphanedBindings(ctxTest, args)
+	require.NoError(t, err)
+	require.Equal(t, float64(2), rv.GetFields()["removed_project_bindings"].GetNumberValue())
+	require.Equal(t, float64(2), rv.GetFields()["removed_dataset_entries"].GetNumberValue())
+	require.Len(t, rv.GetFields()["orphaned_bindings"].GetListValue().GetValues(), 4)
+
+	// A dry run leaves the policies and access lists alone.
+	require.Len(t, iam.policy("projects/demo-project").GetBindings(), 3)
+	require.Len(t, bq.dataset("demo-project", "sales").Access, 2)
+	require.Len(t, bq.dataset("other-project", "events").Access, 1)
+
+	// Only the requested project is cleaned up.
+	args, err = structpb.NewStruct(map[string]interface{}{projectActionArg: "demo-project"})
+	require.NoError(t, err)
+	rv, _, err = d.removeOrphanedBindings(ctxTest, args)
+	require.NoError(t, err)
+	require.Equal(t, float64(2), rv.GetFields()["removed_project_bindings"].GetNumberValue())
+	require.Equal(t, float64(1), rv.GetFields()["removed_dataset_entries"].GetNumberValue())
+
+	policy := iam.policy("projects/demo-project")
+	require.Len(t, policy.GetBindings(), 2)
+	require.Equal(t, "roles/owner", policy.GetBindings()[0].GetRole())
+	require.Equal(t, []string{"user:owner@example.com"}, policy.GetBindings()[0].GetMembers())
+	require.Equal(t, "roles/bigquery.dataViewer", policy.GetBindings()[1].GetRole())
+	require.NotNil(t, policy.GetBindings()[1].GetCondition())
+	require.Equal(t, []*bigqueryapi.DatasetAccess{{Role: "OWNER", UserByEmail: "owner@example.com"}},
+		bq.dataset("demo-project", "sales").Access)
+	require.Equal(t, "1", bq.dataset("demo-project", "clean").Etag)
+	require.Len(t, bq.dataset("other-project", "events").Access, 1)
+
+	rv, _, err = d.removeOrphanedBindings(ctxTest, &structpb.Struct{})
+	require.NoError(t, err)
+	require.Equal(t, float64(0), rv.GetFields()["removed_project_bindings"].GetNumberValue())
+	require.Equal(t, float64(1), rv.GetFields()["removed_dataset_entries"].GetNumberValue())
+	require.Empty(t, bq.dataset("other-project", "events").Access)
+}
@@ -2,18 +2,15 @@ package connector
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"cloud.google.com/go/bigquery"
 	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
-	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
-	"google.golang.org/api/iterator"
 )
 
 const memberEntitlement = "member"
@@ -22,6 +19,9 @@ type projectBuilder struct {
 	resourceType   *v2.ResourceType
 	projectsClient *resourcemanager.ProjectsClient
 	bigQueryClient *bigquery.Client
+	backend        policyBackend
+	// withParents attaches projects to their parent folder or organization, which must then be synced as well.
+	withParents bool
 }
 
 func (p *projectBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -29,53 +29,27 @@ func (p *projectBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 }
 
 func (p *projectBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	var (
-		resources []*v2.Resource
-		bag       = &pagination.Bag{}
-	)
-	err := bag.Unmarshal(pToken.Token)
+	var resources []*v2.Resource
+	projects, bag, err := listProjectsPage(ctx, p.backend, pToken)
 	if err != nil {
-		return nil, "", nil, err
-	}
-
-	if bag.Current() == nil {
-		bag.Push(pagination.PageState{
-			ResourceTypeID: projectResourceType.Id,
-		})
-	}
-
-	it := p.projectsClient.SearchProjects(ctx,
-		&resourcemanagerpb.SearchProjectsRequest{
-			Query:     "",
-			PageToken: bag.PageToken(),
-		},
-	)
-
-	for {
-		project, err := it.Next()
-		if errors.Is(err, iterator.Done) || project == nil {
-			break
-		}
-
-		if err != nil {
-			if !isPermissionDenied(ctx, err) {
-				return nil, "", nil, wrapError(err, "Unable to fetch projects")
-			}
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "Unable to fetch projects")
 		}
+		return nil, "", nil, nil
+	}
 
+	for _, project := range projects {
 		resource, err := projectResource(project)
 		if err != nil {
 			return nil, "", nil, wrapError(err, "Unable to create project resource")
 		}
+		if !p.withParents {
+			resource.ParentResourceId = nil
+		}
 
 		resources = append(resources, resource)
 	}
 
-	err = bag.Next(it.PageInfo().Token)
-	if err != nil {
-		return nil, "", nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
-	}
-
 	pageToken, err := bag.Marshal()
 	if err != nil {
 		return nil, "", nil, err
@@ -98,25 +72,19 @@ func (p *projectBuilder) Entitlements(_ context.Context, resource *v2.Resource,
 
 func (p *projectBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	var rv []*v2.Grant
-	iter := p.bigQueryClient.Datasets(ctx)
-	iter.ProjectID = resource.Id.Resource // Setting ProjectID
-	for {
-		dataset, err := iter.Next()
-		if errors.Is(err, iterator.Done) || dataset == nil {
-			break
-		}
-
-		if err != nil {
-			if !isPermissionDenied(ctx, err) {
-				return nil, "", nil, wrapError(err, "Unable to fetch dataset")
-			}
+	datasetIDs, err := p.backend.Datasets(ctx, resource.Id.Resource)
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "Unable to fetch dataset")
 		}
+	}
 
+	for _, datasetID := range datasetIDs {
 		membershipGrant := grant.NewGrant(resource,
 			memberEntitlement,
 			&v2.ResourceId{
 				ResourceType: datasetResourceType.Id,
-				Resource:     dataset.DatasetID,
+				Resource:     datasetResourceID(resource.Id.Resource, datasetID),
 			})
 		rv = append(rv, membershipGrant)
 	}
@@ -124,10 +92,12 @@ func (p *projectBuilder) Grants(ctx context.Context, resource *v2.Resource, pTok
 	return rv, "", nil, nil
 }
 
-func newProjectBuilder(projectsClient *resourcemanager.ProjectsClient, bigQueryClient *bigquery.Client) *projectBuilder {
+func newProjectBuilder(projectsClient *resourcemanager.ProjectsClient, bigQueryClient *bigquery.Client, backend policyBackend, withParents bool) *projectBuilder {
 	return &projectBuilder{
 		resourceType:   projectResourceType,
 		projectsClient: projectsClient,
 		bigQueryClient: bigQueryClient,
+		backend:        backend,
+		withParents:    withParents,
 	}
 }
@@ -0,0 +1,111 @@
+package connector
+
+import (
+	"testing"
+
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newFakeHierarchyBuilders returns the project, folder and organization builders reading from a fake IAM, with the
+// datasets of the projects held by a fake BigQuery.
+func newFakeHierarchyBuilders(t *testing.T) (*fakeBigQuery, *fakeIAM, *projectBuilder, *folderBuilder, *organizationBuilder) {
+	bq, client, service := newFakeBigQuery(t)
+	iam, opts := newFakeIAM(t)
+	projectsClient, err := resourcemanager.NewProjectsClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = projectsClient.Close() })
+	foldersClient, err := resourcemanager.NewFoldersClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = foldersClient.Close() })
+	organizationsClient, err := resourcemanager.NewOrganizationsClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = organizationsClient.Close() })
+
+	backend := newDirectBackend(projectsClient, client, service)
+	return bq, iam,
+		newProjectBuilder(projectsClient, client, backend, true),
+		newFolderBuilder(foldersClient),
+		newOrganizationBuilder(organizationsClient)
+}
+
+func TestProjectHierarchy(t *testing.T) {
+	bq, iam, projects, folders, organizations := newFakeHierarchyBuilders(t)
+	iam.addOrganization("456")
+	iam.addFolder("789", "organizations/456")
+	iam.addFolder("790", "folders/789")
+	iam.addProjectIn("demo-project", "folders/790")
+	iam.addProjectIn("other-project", "organizations/456")
+	bq.addDataset("demo-project", "sales")
+
+	// Every parent a project or folder points at is synced as well.
+	parents := make(map[string]string)
+	organizationList, err := listAll(organizations, nil)
+	require.NoError(t, err)
+	require.Len(t, organizationList, 1)
+	folderList, err := listAll(folders, nil)
+	require.NoError(t, err)
+	require.Len(t, folderList, 2)
+	projectList, err := listAll(projects, nil)
+	require.NoError(t, err)
+	require.Len(t, projectList, 2)
+
+	synced := make(map[string]bool)
+	for _, r := range append(append(organizationList, folderList...), projectList...) {
+		synced[r.GetId().GetResourceType()+":"+r.GetId().GetResource()] = true
+		if parent := r.GetParentResourceId(); parent != nil {
+			parents[r.GetId().GetResource()] = parent.GetResourceType() + ":" + parent.GetResource()
+		}
+	}
+	require.Equal(t, map[string]string{
+		"789":           "organization:456",
+		"790":           "folder:789",
+		"demo-project":  "folder:790",
+		"other-project": "organization:456",
+	}, parents)
+	for _, parent := range parents {
+		require.True(t, synced[parent], "parent %s is not synced", parent)
+	}
+
+	// Datasets are members of their project.
+	grants, _, _, err := projects.Grants(ctxTest, projectList[0], &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, datasetResourceType.Id, grants[0].GetPrincipal().GetId().GetResourceType())
+	require.Equal(t, "demo-project:sales", grants[0].GetPrincipal().GetId().GetResource())
+	require.Equal(t, "project:demo-project:member", grants[0].GetEntitlement().GetId())
+}
+
+func TestProjectHierarchySearchErrors(t *testing.T) {
+	_, iam, projects, folders, organizations := newFakeHierarchyBuilders(t)
+	iam.addOrganization("456")
+	iam.addOrganization("457")
+	iam.addFolder("789", "organizations/456")
+	iam.addFolder("790", "organizations/457")
+	iam.addProjectIn("demo-project", "folders/789")
+	iam.addProjectIn("other-project", "folders/790")
+
+	listers := map[string]resourceLister{
+		projectResourceType.Id:      projects,
+		folderResourceType.Id:       folders,
+		organizationResourceType.Id: organizations,
+	}
+
+	// A search failing after its first page fails the sync, it must not leave the resources of the next pages out.
+	iam.setSearchError(status.Error(codes.Internal, "backend error"), 1)
+	for resourceType, lister := range listers {
+		_, err := listAll(lister, nil)
+		require.ErrorContains(t, err, "backend error", resourceType)
+	}
+
+	// Without permission to search, nothing is synced and the sync goes on.
+	iam.setSearchError(status.Error(codes.PermissionDenied, "permission denied"), 0)
+	for resourceType, lister := range listers {
+		resources, err := listAll(lister, nil)
+		require.NoError(t, err, resourceType)
+		require.Empty(t, resources, resourceType)
+	}
+}
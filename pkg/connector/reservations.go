@@ -0,0 +1,232 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	reservation "cloud.google.com/go/bigquery/reservation/apiv1"
+	"cloud.google.com/go/bigquery/reservation/apiv1/reservationpb"
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+// assigneeEntitlement links a reservation to the projects, folders and organizations assigned to it.
+const assigneeEntitlement = "assignee"
+
+var (
+	// reservationRoles are the IAM roles that can be granted on a reservation.
+	reservationRoles = []string{
+		"roles/bigquery.admin",
+		"roles/bigquery.resourceAdmin",
+		"roles/bigquery.resourceEditor",
+		"roles/bigquery.resourceViewer",
+	}
+	reservationRoleVerbs = map[string]string{
+		"roles/bigquery.admin":          "Administers",
+		"roles/bigquery.resourceAdmin":  "Administers and assigns",
+		"roles/bigquery.resourceEditor": "Can change",
+		"roles/bigquery.resourceViewer": "Can view",
+	}
+)
+
+type reservationBuilder struct {
+	resourceType      *v2.ResourceType
+	reservationClient *reservation.Client
+	locations         []string
+}
+
+func (o *reservationBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return reservationResourceType
+}
+
+// List returns the reservations administered by the parent project in every configured location.
+func (o *reservationBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != projectResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	for _, location := range o.locations {
+		it := o.reservationClient.ListReservations(ctx, &reservationpb.ListReservationsRequest{
+			Parent: fmt.Sprintf("projects/%s/locations/%s", parentResourceID.GetResource(), strings.ToLower(location)),
+		})
+		for {
+			r, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				if !isPermissionDenied(ctx, err) {
+					return nil, "", nil, wrapError(err, "Unable to fetch reservations")
+				}
+				break
+			}
+
+			assignments, err := o.assignments(ctx, r.GetName())
+			if err != nil {
+				return nil, "", nil, err
+			}
+
+			resource, err := reservationResource(r, assignments, parentResourceID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "Unable to create reservation resource")
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, "", nil, nil
+}
+
+// assignments returns the assignments of a reservation, nil when the credentials cannot list them.
+func (o *reservationBuilder) assignments(ctx context.Context, name string) ([]*reservationpb.Assignment, error) {
+	var assignments []*reservationpb.Assignment
+	it := o.reservationClient.ListAssignments(ctx, &reservationpb.ListAssignmentsRequest{
+		Parent: name,
+	})
+	for {
+		assignment, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, wrapError(err, "Unable to fetch assignments of reservation "+name)
+			}
+			return nil, nil
+		}
+
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, nil
+}
+
+func (o *reservationBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+	for _, role := range reservationRoles {
+		assigmentOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("%s %s reservation", reservationRoleVerbs[role], resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s reservation %s", resource.DisplayName, role)),
+		}
+		rv = append(rv, ent.NewPermissionEntitlement(resource, role, assigmentOptions...))
+	}
+
+	rv = append(rv, ent.NewAssignmentEntitlement(resource, assigneeEntitlement,
+		ent.WithGrantableTo(projectResourceType, folderResourceType, organizationResourceType),
+		ent.WithDescription(fmt.Sprintf("Runs jobs on the slots of %s reservation", resource.DisplayName)),
+		ent.WithDisplayName(fmt.Sprintf("%s reservation %s", resource.DisplayName, assigneeEntitlement)),
+	))
+
+	return rv, "", nil, nil
+}
+
+// Grants returns the IAM grants of the reservation and its assignments to projects, folders and organizations.
+func (o *reservationBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var grants []*v2.Grant
+	l := ctxzap.Extract(ctx)
+	policy, err := o.reservationClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
+		Resource: resource.Id.Resource,
+	})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "failed to get IAM policy of reservation "+resource.Id.Resource)
+		}
+	}
+
+	for _, binding := range policy.GetBindings() {
+		if _, ok := reservationRoleVerbs[binding.Role]; !ok {
+			continue
+		}
+
+		for _, member := range binding.Members {
+			principalID, ok := iamMemberPrincipalID(member)
+			if !ok {
+				l.Debug("Skipping reservation member that is not a user", zap.String("member", member))
+				continue
+			}
+
+			grants = append(grants, grant.NewGrant(resource, binding.Role, principalID))
+		}
+	}
+
+	assignments, err := o.assignments(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	for _, assignment := range assignments {
+		assigneeID := containerResourceID(assignment.GetAssignee())
+		if assigneeID == nil {
+			l.Debug("Skipping reservation assignment of unknown assignee", zap.String("assignee", assignment.GetAssignee()))
+			continue
+		}
+
+		grants = append(grants, grant.NewGrant(resource, assigneeEntitlement, assigneeID))
+	}
+
+	return grants, "", nil, nil
+}
+
+// reservationResource creates a reservation resource, its profile holds the slot capacity and the assignments as
+// assignee (job type) pairs.
+func reservationResource(r *reservationpb.Reservation, assignments []*reservationpb.Assignment, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	name := r.GetName()
+	reservationID := name[strings.LastIndex(name, "/")+1:]
+	profile := map[string]interface{}{
+		"name":              name,
+		"reservation_id":    reservationID,
+		"slot_capacity":     r.GetSlotCapacity(),
+		"edition":           r.GetEdition().String(),
+		"ignore_idle_slots": r.GetIgnoreIdleSlots(),
+	}
+	if r.GetAutoscale() != nil {
+		profile["autoscale_max_slots"] = r.GetAutoscale().GetMaxSlots()
+		profile["autoscale_current_slots"] = r.GetAutoscale().GetCurrentSlots()
+	}
+	if r.GetConcurrency() != 0 {
+		profile["concurrency"] = r.GetConcurrency()
+	}
+	if r.GetPrimaryLocation() != "" {
+		profile["primary_location"] = r.GetPrimaryLocation()
+	}
+	if r.GetSecondaryLocation() != "" {
+		profile["secondary_location"] = r.GetSecondaryLocation()
+	}
+	addLifecycleProfileFields(profile, r.GetCreationTime(), r.GetUpdateTime(), nil)
+
+	if len(assignments) > 0 {
+		assignees := make([]interface{}, 0, len(assignments))
+		for _, assignment := range assignments {
+			assignees = append(assignees, fmt.Sprintf("%s (%s)", assignment.GetAssignee(), assignment.GetJobType().String()))
+		}
+		profile["assignments"] = assignees
+	}
+
+	return rs.NewResource(
+		reservationID,
+		reservationResourceType,
+		name,
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newReservationBuilder(reservationClient *reservation.Client, locations []string) *reservationBuilder {
+	return &reservationBuilder{
+		resourceType:      reservationResourceType,
+		reservationClient: reservationClient,
+		locations:         locations,
+	}
+}
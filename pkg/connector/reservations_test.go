@@ -0,0 +1,86 @@
+package connector
+
+import (
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReservationSync(t *testing.T) {
+	fake, client := newFakeReservations(t)
+	prod := fake.addReservation("projects/admin-project/locations/us", "prod", 500,
+		"projects/demo-project",
+		"folders/789",
+		"organizations/456",
+	)
+	fake.addCommitment("projects/admin-project/locations/us", "annual", 500)
+	fake.setPolicy(prod, &iampb.Policy{
+		Bindings: []*iampb.Binding{
+			{Role: "roles/bigquery.resourceEditor", Members: []string{"user:alice@example.com"}},
+			{Role: "roles/bigquery.dataViewer", Members: []string{"user:bob@example.com"}},
+		},
+	})
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "admin-project"}
+
+	builder := newReservationBuilder(client, []string{"US"})
+	reservations, err := listAll(builder, project)
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	require.Equal(t, prod, reservations[0].GetId().GetResource())
+	require.Len(t, reservations[0].GetProfile().GetFields()["assignments"].GetListValue().GetValues(), 3)
+
+	// Assignees are granted the reservation, bindings of roles that can't be granted on a reservation are left out.
+	grants, _, _, err := builder.Grants(ctxTest, reservations[0], &pagination.Token{})
+	require.NoError(t, err)
+	got := make(map[string]string)
+	for _, g := range grants {
+		principal := g.GetPrincipal().GetId()
+		got[principal.GetResourceType()+":"+principal.GetResource()] = entitlementSlug(g.GetEntitlement())
+	}
+	require.Equal(t, map[string]string{
+		"user:alice@example.com": "roles/bigquery.resourceEditor",
+		"project:demo-project":   assigneeEntitlement,
+		"folder:789":             assigneeEntitlement,
+		"organization:456":       assigneeEntitlement,
+	}, got)
+
+	commitments, err := listAll(newCapacityCommitmentBuilder(client, []string{"US"}), project)
+	require.NoError(t, err)
+	require.Len(t, commitments, 1)
+	require.Equal(t, "annual (500 slots)", commitments[0].GetDisplayName())
+}
+
+func TestReservationListErrors(t *testing.T) {
+	fake, client := newFakeReservations(t)
+	prod := fake.addReservation("projects/admin-project/locations/us", "prod", 500, "projects/demo-project", "projects/other-project")
+	fake.addReservation("projects/admin-project/locations/us", "batch", 100)
+	fake.addCommitment("projects/admin-project/locations/us", "annual", 500)
+	fake.addCommitment("projects/admin-project/locations/us", "monthly", 100)
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "admin-project"}
+	reservations := newReservationBuilder(client, []string{"US"})
+	commitments := newCapacityCommitmentBuilder(client, []string{"US"})
+	reservationResource := &v2.Resource{Id: &v2.ResourceId{ResourceType: reservationResourceType.Id, Resource: prod}}
+
+	// A list failing after its first page fails the sync, it must not leave the next pages out.
+	fake.setListError(status.Error(codes.Internal, "backend error"), 1)
+	_, err := listAll(reservations, project)
+	require.ErrorContains(t, err, "backend error")
+	_, err = listAll(commitments, project)
+	require.ErrorContains(t, err, "backend error")
+	_, _, _, err = reservations.Grants(ctxTest, reservationResource, &pagination.Token{})
+	require.ErrorContains(t, err, "backend error")
+
+	// Without permission to list, nothing is synced and the sync goes on.
+	fake.setListError(status.Error(codes.PermissionDenied, "permission denied"), 0)
+	resources, err := listAll(reservations, project)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+	resources, err = listAll(commitments, project)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+}
@@ -28,4 +28,80 @@ var (
 		DisplayName: "Project",
 		Description: "Project of Google BigQuery",
 	}
+	organizationResourceType = &v2.ResourceType{
+		Id:          "organization",
+		DisplayName: "Organization",
+		Description: "Organization of Google Cloud Platform",
+	}
+	dataExchangeResourceType = &v2.ResourceType{
+		Id:          "data_exchange",
+		DisplayName: "Data Exchange",
+		Description: "Analytics Hub data exchange of Google BigQuery",
+	}
+	listingResourceType = &v2.ResourceType{
+		Id:          "listing",
+		DisplayName: "Listing",
+		Description: "Analytics Hub listing of Google BigQuery",
+	}
+	routineResourceType = &v2.ResourceType{
+		Id:          "routine",
+		DisplayName: "Routine",
+		Description: "Routine (UDF, stored procedure or table function) of Google BigQuery",
+	}
+	modelResourceType = &v2.ResourceType{
+		Id:          "model",
+		DisplayName: "Model",
+		Description: "BigQuery ML model of Google BigQuery",
+	}
+	connectionResourceType = &v2.ResourceType{
+		Id:          "connection",
+		DisplayName: "Connection",
+		Description: "Connection of Google BigQuery to an external data source",
+	}
+	reservationResourceType = &v2.ResourceType{
+		Id:          "reservation",
+		DisplayName: "Reservation",
+		Description: "Slot reservation of Google BigQuery",
+	}
+	capacityCommitmentResourceType = &v2.ResourceType{
+		Id:          "capacity_commitment",
+		DisplayName: "Capacity Commitment",
+		Description: "Slot capacity commitment of Google BigQuery",
+	}
+	viewResourceType = &v2.ResourceType{
+		Id:          "view",
+		DisplayName: "View",
+		Description: "View or materialized view of Google BigQuery",
+	}
+	dataPolicyResourceType = &v2.ResourceType{
+		Id:          "data_policy",
+		DisplayName: "Data Policy",
+		Description: "Column-level data masking policy of Google BigQuery",
+	}
+	folderResourceType = &v2.ResourceType{
+		Id:          "folder",
+		DisplayName: "Folder",
+		Description: "Folder of Google Cloud Platform",
+	}
+	transferConfigResourceType = &v2.ResourceType{
+		Id:          "transfer_config",
+		DisplayName: "Transfer Config",
+		Description: "Data Transfer Service config or scheduled query of Google BigQuery",
+	}
+	denyPolicyResourceType = &v2.ResourceType{
+		Id:          "deny_policy",
+		DisplayName: "Deny Policy",
+		Description: "IAM deny policy attached to a project, folder or organization of Google Cloud Platform",
+	}
+	accessTokenResourceType = &v2.ResourceType{
+		Id:          "access_token",
+		DisplayName: "Access Token",
+		Description: "Short-lived OAuth access token issued for a service account of Google Cloud Platform",
+		Traits:      []v2.ResourceType_Trait{v2.ResourceType_TRAIT_SECRET},
+	}
+	serviceAccountResourceType = &v2.ResourceType{
+		Id:          "service_account",
+		DisplayName: "Service Account",
+		Description: "Service account of a Google Cloud Platform project",
+	}
 )
@@ -2,25 +2,23 @@ package connector
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"cloud.google.com/go/bigquery"
-	"cloud.google.com/go/iam/apiv1/iampb"
 	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
-	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
-	"google.golang.org/api/iterator"
 )
 
 type roleBuilder struct {
 	resourceType   *v2.ResourceType
 	projectsClient *resourcemanager.ProjectsClient
 	bigQueryClient *bigquery.Client
+	backend        policyBackend
+	denials        *denyEvaluator
 }
 
 const assignedEntitlement = "assigned"
@@ -30,53 +28,24 @@ func (r *roleBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 }
 
 func (r *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	var (
-		resources []*v2.Resource
-		bag       = &pagination.Bag{}
-	)
-	err := bag.Unmarshal(pToken.Token)
+	var resources []*v2.Resource
+	projects, bag, err := listProjectsPage(ctx, r.backend, pToken)
 	if err != nil {
-		return nil, "", nil, err
-	}
-
-	if bag.Current() == nil {
-		bag.Push(pagination.PageState{
-			ResourceTypeID: projectResourceType.Id,
-		})
-	}
-
-	it := r.projectsClient.SearchProjects(ctx,
-		&resourcemanagerpb.SearchProjectsRequest{
-			Query:     "",
-			PageToken: bag.PageToken(),
-		},
-	)
-	for {
-		project, err := it.Next()
-		if errors.Is(err, iterator.Done) || project == nil {
-			break
-		}
-
-		if err != nil {
-			if !isPermissionDenied(ctx, err) {
-				return nil, "", nil, wrapError(err, "Unable to fetch project")
-			}
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "Unable to fetch project")
 		}
+		return nil, "", nil, nil
+	}
 
-		policy, err := r.projectsClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
-			Resource: fmt.Sprintf("projects/%s", project.ProjectId),
-		})
+	for _, project := range projects {
+		policy, err := r.backend.ProjectPolicy(ctx, project.ProjectId)
 		if err != nil {
 			if !isPermissionDenied(ctx, err) {
 				return nil, "", nil, wrapError(err, "failed to get IAM policy")
 			}
 		}
 
-		if policy == nil {
-			return resources, "", nil, nil
-		}
-
-		for _, binding := range policy.Bindings {
+		for _, binding := range policy.GetBindings() {
 			resource, err := roleResource(binding.Role, &v2.ResourceId{
 				ResourceType: projectResourceType.Id,
 				Resource:     project.ProjectId,
@@ -89,11 +58,6 @@ func (r *roleBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 		}
 	}
 
-	err = bag.Next(it.PageInfo().Token)
-	if err != nil {
-		return nil, "", nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
-	}
-
 	pageToken, err := bag.Marshal()
 	if err != nil {
 		return nil, "", nil, err
@@ -118,9 +82,7 @@ func (o *roleBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *
 func (o *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
 	var grants []*v2.Grant
 	projectId := resource.ParentResourceId.Resource
-	policy, err := o.projectsClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
-		Resource: fmt.Sprintf("projects/%s", projectId),
-	})
+	policy, err := o.backend.ProjectPolicy(ctx, projectId)
 	if err != nil {
 		if !isPermissionDenied(ctx, err) {
 			return nil, "", nil, wrapError(err, "listing grants for roles failed")
@@ -137,6 +99,19 @@ func (o *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 		}
 
 		for _, member := range binding.Members {
+			if isDeleted, _, _ := isDeletedUserOrServiceAccountMember(member); isDeleted {
+				grants = append(grants, grant.NewGrant(resource, assignedEntitlement, &v2.ResourceId{
+					ResourceType: userResourceType.Id,
+					Resource:     member,
+				}))
+				continue
+			}
+
+			if isServiceAccount, email := isServiceAccount(member); isServiceAccount {
+				grants = append(grants, serviceAccountGrant(resource, assignedEntitlement, email))
+				continue
+			}
+
 			if isUser, user := isUserOrServiceAccountMember(member); isUser {
 				userResource, err := userResource(user, nil, nil)
 				if err != nil {
@@ -148,13 +123,26 @@ func (o *roleBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken
 		}
 	}
 
+	if o.denials != nil {
+		if err := o.denials.annotateGrants(ctx, projectId, resource.Id.Resource, grants); err != nil {
+			return nil, "", nil, wrapError(err, "failed to annotate role grants with deny policies")
+		}
+	}
+
 	return grants, "", nil, nil
 }
 
-func newRoleBuilder(projectsClient *resourcemanager.ProjectsClient, bigQueryClient *bigquery.Client) *roleBuilder {
+func newRoleBuilder(
+	projectsClient *resourcemanager.ProjectsClient,
+	bigQueryClient *bigquery.Client,
+	backend policyBackend,
+	denials *denyEvaluator,
+) *roleBuilder {
 	return &roleBuilder{
 		resourceType:   roleResourceType,
 		projectsClient: projectsClient,
 		bigQueryClient: bigQueryClient,
+		backend:        backend,
+		denials:        denials,
 	}
 }
@@ -0,0 +1,193 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	// routineRoles are the IAM roles that can be granted on a routine.
+	routineRoles = []string{
+		"roles/bigquery.admin",
+		"roles/bigquery.dataOwner",
+		"roles/bigquery.dataEditor",
+		"roles/bigquery.dataViewer",
+		"roles/bigquery.metadataViewer",
+	}
+	routineRoleVerbs = map[string]string{
+		"roles/bigquery.admin":          "Administers",
+		"roles/bigquery.dataOwner":      "Owns",
+		"roles/bigquery.dataEditor":     "Can edit",
+		"roles/bigquery.dataViewer":     "Can call",
+		"roles/bigquery.metadataViewer": "Can view the definition of",
+	}
+)
+
+type routineBuilder struct {
+	resourceType    *v2.ResourceType
+	bigQueryClient  *bigquery.Client
+	bigQueryService *bigqueryapi.Service
+}
+
+func (o *routineBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return routineResourceType
+}
+
+// List returns the routines of the parent dataset.
+func (o *routineBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != datasetResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	projectID, datasetID := parseDatasetResourceID(parentResourceID.GetResource())
+	it := o.bigQueryClient.DatasetInProject(projectID, datasetID).Routines(ctx)
+	for {
+		routine, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch routines")
+			}
+			break
+		}
+
+		metadata, err := routine.Metadata(ctx)
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, "", nil, wrapError(err, "Unable to fetch routine metadata (routine:"+routine.FullyQualifiedName()+")")
+			}
+			metadata = nil
+		}
+
+		resource, err := routineResource(projectID, datasetID, routine.RoutineID, metadata, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create routine resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *routineBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	var rv []*v2.Entitlement
+	for _, role := range routineRoles {
+		assigmentOptions := []ent.EntitlementOption{
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("%s %s routine", routineRoleVerbs[role], resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s routine %s", resource.DisplayName, role)),
+		}
+		rv = append(rv, ent.NewPermissionEntitlement(resource, role, assigmentOptions...))
+	}
+
+	return rv, "", nil, nil
+}
+
+// Grants reads the IAM policy of the routine. Only the REST API exposes routine policies.
+func (o *routineBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var grants []*v2.Grant
+	l := ctxzap.Extract(ctx)
+	projectID, datasetID, routineID := parseDatasetChildResourceID(resource.Id.Resource)
+	if datasetID == "" {
+		return nil, "", nil, fmt.Errorf("baton-google-bigquery: invalid routine ID %s", resource.Id.Resource)
+	}
+
+	name := fmt.Sprintf("projects/%s/datasets/%s/routines/%s", projectID, datasetID, routineID)
+	policy, err := o.bigQueryService.Routines.GetIamPolicy(name, &bigqueryapi.GetIamPolicyRequest{}).Context(ctx).Do()
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "failed to get IAM policy of routine "+name)
+		}
+	}
+
+	if policy == nil {
+		return grants, "", nil, nil
+	}
+
+	for _, binding := range policy.Bindings {
+		if _, ok := routineRoleVerbs[binding.Role]; !ok {
+			l.Debug("Skipping routine binding of unknown role", zap.String("role", binding.Role))
+			continue
+		}
+
+		for _, member := range binding.Members {
+			principalID, ok := iamMemberPrincipalID(member)
+			if !ok {
+				l.Debug("Skipping routine member that is not a user", zap.String("member", member))
+				continue
+			}
+
+			grants = append(grants, grant.NewGrant(resource, binding.Role, principalID))
+		}
+	}
+
+	return grants, "", nil, nil
+}
+
+// routineResource creates a routine resource, metadata is nil when the routine definition cannot be read.
+func routineResource(projectID string, datasetID string, routineID string, metadata *bigquery.RoutineMetadata, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"name":       routineID,
+		"project_id": projectID,
+		"dataset_id": datasetID,
+		"routine_id": routineID,
+	}
+
+	if metadata != nil {
+		profile["type"] = metadata.Type
+		profile["language"] = metadata.Language
+		profile["argument_count"] = len(metadata.Arguments)
+		if metadata.Description != "" {
+			profile["description"] = metadata.Description
+		}
+		if metadata.DeterminismLevel != "" {
+			profile["determinism_level"] = string(metadata.DeterminismLevel)
+		}
+		if metadata.DataGovernanceType != "" {
+			profile["data_governance_type"] = metadata.DataGovernanceType
+		}
+		if metadata.RemoteFunctionOptions != nil {
+			profile["remote_connection"] = metadata.RemoteFunctionOptions.Connection
+		}
+		if !metadata.CreationTime.IsZero() {
+			profile["creation_time"] = metadata.CreationTime.UTC().Format(time.RFC3339)
+		}
+		if !metadata.LastModifiedTime.IsZero() {
+			profile["last_modified_time"] = metadata.LastModifiedTime.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return rs.NewResource(
+		routineID,
+		routineResourceType,
+		datasetChildResourceID(projectID, datasetID, routineID),
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newRoutineBuilder(bigQueryClient *bigquery.Client, bigQueryService *bigqueryapi.Service) *routineBuilder {
+	return &routineBuilder{
+		resourceType:    routineResourceType,
+		bigQueryClient:  bigQueryClient,
+		bigQueryService: bigQueryService,
+	}
+}
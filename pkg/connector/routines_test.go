@@ -0,0 +1,68 @@
+package connector
+
+import (
+	"errors"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+)
+
+func TestRoutineAndModelSync(t *testing.T) {
+	bq, client, service := newFakeBigQuery(t)
+	bq.addDataset("demo-project", "sales")
+	bq.addRoutine("demo-project", "sales", "normalize")
+	bq.addRoutine("demo-project", "sales", "score")
+	bq.addModel("demo-project", "sales", "churn")
+	bq.setRoutinePolicy("demo-project", "sales", "normalize", &bigqueryapi.Policy{
+		Bindings: []*bigqueryapi.Binding{
+			{Role: "roles/bigquery.dataViewer", Members: []string{"user:alice@example.com", "serviceAccount:etl@demo-project.iam.gserviceaccount.com"}},
+			{Role: "roles/bigquery.jobUser", Members: []string{"user:bob@example.com"}},
+		},
+	})
+	dataset := &v2.ResourceId{ResourceType: datasetResourceType.Id, Resource: "demo-project:sales"}
+
+	routines := newRoutineBuilder(client, service)
+	resources, err := listAll(routines, dataset)
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	require.Equal(t, "demo-project:sales.normalize", resources[0].GetId().GetResource())
+	require.Equal(t, "SCALAR_FUNCTION", resources[0].GetProfile().GetFields()["type"].GetStringValue())
+
+	// Bindings of roles that can't be granted on a routine are left out.
+	grants, _, _, err := routines.Grants(ctxTest, resources[0], &pagination.Token{})
+	require.NoError(t, err)
+	got := make(map[string]string)
+	for _, g := range grants {
+		got[g.GetPrincipal().GetId().GetResource()] = entitlementSlug(g.GetEntitlement())
+	}
+	require.Equal(t, map[string]string{
+		"alice@example.com":                        "roles/bigquery.dataViewer",
+		"etl@demo-project.iam.gserviceaccount.com": "roles/bigquery.dataViewer",
+	}, got)
+
+	models, err := listAll(newModelBuilder(client), dataset)
+	require.NoError(t, err)
+	require.Len(t, models, 1)
+	require.Equal(t, "demo-project:sales.churn", models[0].GetId().GetResource())
+	require.Equal(t, "LINEAR_REGRESSION", models[0].GetProfile().GetFields()["type"].GetStringValue())
+}
+
+func TestRoutineAndModelListErrors(t *testing.T) {
+	bq, client, service := newFakeBigQuery(t)
+	bq.addDataset("demo-project", "sales")
+	bq.addRoutine("demo-project", "sales", "normalize")
+	bq.addRoutine("demo-project", "sales", "score")
+	bq.addModel("demo-project", "sales", "churn")
+	bq.addModel("demo-project", "sales", "forecast")
+	dataset := &v2.ResourceId{ResourceType: datasetResourceType.Id, Resource: "demo-project:sales"}
+
+	// A list failing after its first page fails the sync, it must not leave the next pages out.
+	bq.setListError(errors.New("backend error"), 1)
+	_, err := listAll(newRoutineBuilder(client, service), dataset)
+	require.ErrorContains(t, err, "backend error")
+	_, err = listAll(newModelBuilder(client), dataset)
+	require.ErrorContains(t, err, "backend error")
+}
@@ -0,0 +1,371 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	iamadmin "cloud.google.com/go/iam/admin/apiv1"
+	"cloud.google.com/go/iam/admin/apiv1/adminpb"
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// serviceAccountKeyPlaintextName names the initial key of a created service account in the encrypted account
+	// creation output.
+	serviceAccountKeyPlaintextName = "service_account_key"
+	// serviceAccountsPageSize is the number of service accounts of a project a List call covers.
+	serviceAccountsPageSize = 100
+
+	disableServiceAccountAction = "disable_service_account"
+	serviceAccountActionArg     = "service_account"
+)
+
+// disableServiceAccountSchema disables a service account instead of deleting it, so that it can still be restored.
+var disableServiceAccountSchema = v2.BatonActionSchema_builder{
+	Name:        disableServiceAccountAction,
+	DisplayName: "Disable service account",
+	Description: "Disable the service account instead of deleting it, so that it can still be restored.",
+	Arguments: []*config.Field{
+		config.Field_builder{
+			Name:            serviceAccountActionArg,
+			DisplayName:     "Service account",
+			Description:     "The service account to disable.",
+			ResourceIdField: &config.ResourceIdField{},
+			IsRequired:      true,
+		}.Build(),
+	},
+	ReturnTypes: []*config.Field{
+		config.Field_builder{Name: "success", DisplayName: "Success", BoolField: &config.BoolField{}}.Build(),
+	},
+}.Build()
+
+// serviceAccountCreationSchema lists the account information CreateAccount reads from the profile.
+var serviceAccountCreationSchema = v2.ConnectorAccountCreationSchema_builder{
+	FieldMap: map[string]*v2.ConnectorAccountCreationSchema_Field{
+		"project": v2.ConnectorAccountCreationSchema_Field_builder{
+			DisplayName: "Project",
+			Required:    true,
+			Description: "ID of the project the service account is created in.",
+			Placeholder: "my-project",
+			Order:       1,
+			StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+		}.Build(),
+		"account_id": v2.ConnectorAccountCreationSchema_Field_builder{
+			DisplayName: "Account ID",
+			Required:    true,
+			Description: "Account ID of the service account, the part of its email before the @.",
+			Placeholder: "etl-pipeline",
+			Order:       2,
+			StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+		}.Build(),
+		"display_name": v2.ConnectorAccountCreationSchema_Field_builder{
+			DisplayName: "Display name",
+			Description: "Display name of the service account.",
+			Order:       3,
+			StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+		}.Build(),
+		"description": v2.ConnectorAccountCreationSchema_Field_builder{
+			DisplayName: "Description",
+			Description: "Description of the service account.",
+			Order:       4,
+			StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+		}.Build(),
+	},
+}.Build()
+
+type serviceAccountBuilder struct {
+	resourceType *v2.ResourceType
+	iamClient    *iamadmin.IamClient
+}
+
+func (o *serviceAccountBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return serviceAccountResourceType
+}
+
+// List returns a page of the service accounts of the parent project, those without any role binding included.
+// Projects whose service accounts the credentials cannot list are skipped.
+func (o *serviceAccountBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != projectResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	var accounts []*adminpb.ServiceAccount
+	it := o.iamClient.ListServiceAccounts(ctx, &adminpb.ListServiceAccountsRequest{
+		Name: "projects/" + parentResourceID.GetResource(),
+	})
+	nextPageToken, err := iterator.NewPager(it, serviceAccountsPageSize, pToken.Token).NextPage(&accounts)
+	if err != nil {
+		if status.Code(err) != codes.PermissionDenied {
+			return nil, "", nil, wrapError(err, "Unable to fetch service accounts")
+		}
+
+		l.Warn("unable to list service accounts, skipping project",
+			zap.String("project", parentResourceID.GetResource()),
+			zap.Error(err))
+		return nil, "", nil, nil
+	}
+
+	for _, sa := range accounts {
+		resource, err := serviceAccountResource(sa, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create service account resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, nextPageToken, nil, nil
+}
+
+// Entitlements returns nothing, the access of service accounts is synced on their user resource.
+func (o *serviceAccountBuilder) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *serviceAccountBuilder) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+// CreateAccountCapabilityDetails describes service account creation: without a credential, or with an initial key.
+func (o *serviceAccountBuilder) CreateAccountCapabilityDetails(_ context.Context) (*v2.CredentialDetailsAccountProvisioning, annotations.Annotations, error) {
+	return v2.CredentialDetailsAccountProvisioning_builder{
+		SupportedCredentialOptions: []v2.CapabilityDetailCredentialOption{
+			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_NO_PASSWORD,
+			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_RANDOM_PASSWORD,
+		},
+		PreferredCredentialOption: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_NO_PASSWORD,
+	}.Build(), nil, nil
+}
+
+// CreateAccount creates a service account from the project, account ID, display name and description of the
+// profile. When a generated credential is requested, an initial key is created and returned encrypted as a JSON
+// credentials file. An existing service account is returned as is, unless a key is requested: no key is created
+// for a service account this call did not create. A service account whose key cannot be created is deleted again.
+func (o *serviceAccountBuilder) CreateAccount(
+	ctx context.Context,
+	accountInfo *v2.AccountInfo,
+	credentialOptions *v2.LocalCredentialOptions,
+) (connectorbuilder.CreateAccountResponse, []*v2.PlaintextData, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	fields := accountInfo.GetProfile().GetFields()
+	projectID := fields["project"].GetStringValue()
+	if projectID == "" {
+		return nil, nil, nil, wrapError(fmt.Errorf("a project is required to create a service account"), "")
+	}
+	accountID := fields["account_id"].GetStringValue()
+	if accountID == "" {
+		accountID = accountInfo.GetLogin()
+	}
+	if accountID == "" {
+		return nil, nil, nil, wrapError(fmt.Errorf("an account ID is required to create a service account"), "")
+	}
+
+	parentResourceID := &v2.ResourceId{
+		ResourceType: projectResourceType.Id,
+		Resource:     projectID,
+	}
+
+	sa, err := o.iamClient.CreateServiceAccount(ctx, &adminpb.CreateServiceAccountRequest{
+		Name:      "projects/" + projectID,
+		AccountId: accountID,
+		ServiceAccount: &adminpb.ServiceAccount{
+			DisplayName: fields["display_name"].GetStringValue(),
+			Description: fields["description"].GetStringValue(),
+		},
+	})
+	if err != nil {
+		if status.Code(err) != codes.AlreadyExists {
+			return nil, nil, nil, wrapError(err, "Unable to create service account "+accountID+" in project "+projectID)
+		}
+		if credentialOptions.GetRandomPassword() != nil {
+			return nil, nil, nil, status.Errorf(codes.AlreadyExists,
+				"baton-google-bigquery: service account %s already exists in project %s, no key is created for it", accountID, projectID)
+		}
+
+		sa, err = o.findServiceAccount(ctx, projectID, accountID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		resource, err := serviceAccountResource(sa, parentResourceID)
+		if err != nil {
+			return nil, nil, nil, wrapError(err, "Unable to create service account resource")
+		}
+
+		return v2.CreateAccountResponse_AlreadyExistsResult_builder{
+			Resource:              resource,
+			IsCreateAccountResult: true,
+		}.Build(), nil, nil, nil
+	}
+
+	l.Info("service account created", zap.String("project", projectID), zap.String("service_account", sa.GetEmail()))
+
+	resource, err := serviceAccountResource(sa, parentResourceID)
+	if err != nil {
+		return nil, nil, nil, wrapError(err, "Unable to create service account resource")
+	}
+
+	var plaintexts []*v2.PlaintextData
+	if credentialOptions.GetRandomPassword() != nil {
+		key, err := o.iamClient.CreateServiceAccountKey(ctx, &adminpb.CreateServiceAccountKeyRequest{
+			Name: sa.GetName(),
+		})
+		if err != nil {
+			// The service account is deleted again so that a retry creates it, and its key, anew.
+			if deleteErr := o.iamClient.DeleteServiceAccount(ctx, &adminpb.DeleteServiceAccountRequest{Name: sa.GetName()}); deleteErr != nil {
+				l.Warn("unable to delete service account after its key could not be created",
+					zap.String("service_account", sa.GetEmail()),
+					zap.Error(deleteErr))
+			}
+			return nil, nil, nil, wrapError(err, "Unable to create key of service account "+sa.GetEmail())
+		}
+
+		l.Info("service account key created", zap.String("service_account", sa.GetEmail()), zap.String("key", key.GetName()))
+		plaintexts = append(plaintexts, v2.PlaintextData_builder{
+			Name:        serviceAccountKeyPlaintextName,
+			Description: fmt.Sprintf("JSON credentials file of service account %s", sa.GetEmail()),
+			Schema:      "application/json",
+			Bytes:       key.GetPrivateKeyData(),
+		}.Build())
+	}
+
+	return v2.CreateAccountResponse_SuccessResult_builder{
+		Resource:              resource,
+		IsCreateAccountResult: true,
+	}.Build(), plaintexts, nil, nil
+}
+
+// findServiceAccount returns the service account of the project with the account ID. The account ID is matched
+// against the local part of the emails listed, which unlike a constructed email also holds for domain-scoped projects.
+func (o *serviceAccountBuilder) findServiceAccount(ctx context.Context, projectID string, accountID string) (*adminpb.ServiceAccount, error) {
+	it := o.iamClient.ListServiceAccounts(ctx, &adminpb.ListServiceAccountsRequest{
+		Name: "projects/" + projectID,
+	})
+	for {
+		sa, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, wrapError(err, "Unable to fetch service accounts of project "+projectID)
+		}
+
+		if localPart, _, _ := strings.Cut(sa.GetEmail(), "@"); localPart == accountID {
+			return sa, nil
+		}
+	}
+
+	return nil, wrapError(fmt.Errorf("service account %s already exists in project %s but is not listed", accountID, projectID), "")
+}
+
+// Delete deletes a service account, the disable_service_account action disables it instead. A service account
+// already gone is not an error.
+func (o *serviceAccountBuilder) Delete(ctx context.Context, resourceId *v2.ResourceId, _ *v2.ResourceId) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	email := resourceId.GetResource()
+
+	err := o.iamClient.DeleteServiceAccount(ctx, &adminpb.DeleteServiceAccountRequest{Name: serviceAccountName(email)})
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return nil, wrapError(err, "Unable to delete service account "+email)
+		}
+
+		l.Info("service account already deleted", zap.String("service_account", email))
+		return nil, nil
+	}
+
+	l.Info("service account deleted", zap.String("service_account", email))
+	return nil, nil
+}
+
+// ResourceActions registers the disabling of service accounts, the alternative to deleting them.
+func (o *serviceAccountBuilder) ResourceActions(ctx context.Context, registry actions.ActionRegistry) error {
+	return registry.Register(ctx, disableServiceAccountSchema, o.disableServiceAccount)
+}
+
+// disableServiceAccount disables the service account given as argument.
+func (o *serviceAccountBuilder) disableServiceAccount(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	resourceID, err := actions.RequireResourceIDArg(args, serviceAccountActionArg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resourceID.GetResourceType() != serviceAccountResourceType.Id {
+		return nil, nil, fmt.Errorf("resource %s is not a service account", resourceID.GetResourceType())
+	}
+
+	email := resourceID.GetResource()
+	err = o.iamClient.DisableServiceAccount(ctx, &adminpb.DisableServiceAccountRequest{Name: serviceAccountName(email)})
+	if err != nil {
+		return nil, nil, wrapError(err, "Unable to disable service account "+email)
+	}
+
+	l.Info("service account disabled", zap.String("service_account", email))
+	return actions.NewReturnValues(true), nil, nil
+}
+
+// serviceAccountName returns the resource name of a service account, its project is inferred from the email.
+func serviceAccountName(email string) string {
+	return "projects/-/serviceAccounts/" + email
+}
+
+// serviceAccountResource creates a service account resource, keyed by email like the user resource of the service
+// account. Disabled service accounts are reported as such.
+func serviceAccountResource(sa *adminpb.ServiceAccount, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"email":        sa.GetEmail(),
+		"project_id":   sa.GetProjectId(),
+		"unique_id":    sa.GetUniqueId(),
+		"display_name": sa.GetDisplayName(),
+		"disabled":     sa.GetDisabled(),
+	}
+	if sa.GetDescription() != "" {
+		profile["description"] = sa.GetDescription()
+	}
+	if sa.GetOauth2ClientId() != "" {
+		profile["oauth2_client_id"] = sa.GetOauth2ClientId()
+	}
+
+	opts := []rs.ResourceOption{
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	}
+	if sa.GetDisabled() {
+		opts = append(opts, rs.WithResourceStatus(v2.Status_RESOURCE_STATUS_DISABLED, "service account is disabled"))
+	}
+
+	displayName := sa.GetDisplayName()
+	if displayName == "" {
+		displayName = sa.GetEmail()
+	}
+
+	return rs.NewResource(
+		displayName,
+		serviceAccountResourceType,
+		sa.GetEmail(),
+		opts...,
+	)
+}
+
+func newServiceAccountBuilder(iamClient *iamadmin.IamClient) *serviceAccountBuilder {
+	return &serviceAccountBuilder{
+		resourceType: serviceAccountResourceType,
+		iamClient:    iamClient,
+	}
+}
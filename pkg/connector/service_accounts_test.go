@@ -0,0 +1,155 @@
+package connector
+
+import (
+	"fmt"
+	"testing"
+
+	iamadmin "cloud.google.com/go/iam/admin/apiv1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newFakeServiceAccountBuilder(t *testing.T) (*fakeIAM, *serviceAccountBuilder) {
+	iam, opts := newFakeIAM(t)
+	client, err := iamadmin.NewIamClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return iam, newServiceAccountBuilder(client)
+}
+
+func serviceAccountInfo(t *testing.T, projectID string, accountID string) *v2.AccountInfo {
+	profile, err := structpb.NewStruct(map[string]interface{}{
+		"project":      projectID,
+		"account_id":   accountID,
+		"display_name": "ETL",
+	})
+	require.NoError(t, err)
+
+	return v2.AccountInfo_builder{Profile: profile}.Build()
+}
+
+func TestServiceAccountCreateAccount(t *testing.T) {
+	iam, builder := newFakeServiceAccountBuilder(t)
+	withKey := v2.LocalCredentialOptions_builder{
+		RandomPassword: v2.LocalCredentialOptions_RandomPassword_builder{Length: 20}.Build(),
+	}.Build()
+	withoutKey := v2.LocalCredentialOptions_builder{
+		NoPassword: v2.LocalCredentialOptions_NoPassword_builder{}.Build(),
+	}.Build()
+
+	res, plaintexts, _, err := builder.CreateAccount(ctxTest, serviceAccountInfo(t, "demo-project", "etl"), withKey)
+	require.NoError(t, err)
+	created, ok := res.(*v2.CreateAccountResponse_SuccessResult)
+	require.True(t, ok)
+	require.Equal(t, "etl@demo-project.iam.gserviceaccount.com", created.GetResource().GetId().GetResource())
+	require.Equal(t, "demo-project", created.GetResource().GetParentResourceId().GetResource())
+	require.Len(t, plaintexts, 1)
+	require.Equal(t, serviceAccountKeyPlaintextName, plaintexts[0].GetName())
+	require.Contains(t, string(plaintexts[0].GetBytes()), "etl@demo-project.iam.gserviceaccount.com")
+
+	// An existing service account is returned as is, without a key.
+	res, plaintexts, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "demo-project", "etl"), withoutKey)
+	require.NoError(t, err)
+	existing, ok := res.(*v2.CreateAccountResponse_AlreadyExistsResult)
+	require.True(t, ok)
+	require.Equal(t, "etl@demo-project.iam.gserviceaccount.com", existing.GetResource().GetId().GetResource())
+	require.Empty(t, plaintexts)
+
+	// No key is created for a service account this call did not create.
+	_, plaintexts, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "demo-project", "etl"), withKey)
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	require.Empty(t, plaintexts)
+
+	// The existing service account of a domain-scoped project is found by its account ID.
+	_, _, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "example.com:analytics", "etl"), withoutKey)
+	require.NoError(t, err)
+	res, _, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "example.com:analytics", "etl"), withoutKey)
+	require.NoError(t, err)
+	existing, ok = res.(*v2.CreateAccountResponse_AlreadyExistsResult)
+	require.True(t, ok)
+	require.Equal(t, "etl@analytics.example.com.iam.gserviceaccount.com", existing.GetResource().GetId().GetResource())
+
+	// A service account whose key cannot be created is deleted, so that a retry creates both.
+	iam.setFailKeys(true)
+	_, plaintexts, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "demo-project", "loader"), withKey)
+	require.ErrorContains(t, err, "Unable to create key of service account")
+	require.Empty(t, plaintexts)
+	require.Nil(t, iam.serviceAccount("loader@demo-project.iam.gserviceaccount.com"))
+
+	iam.setFailKeys(false)
+	res, plaintexts, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "demo-project", "loader"), withKey)
+	require.NoError(t, err)
+	_, ok = res.(*v2.CreateAccountResponse_SuccessResult)
+	require.True(t, ok)
+	require.Len(t, plaintexts, 1)
+
+	// The project and account ID are required before calling IAM.
+	_, _, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "", "etl"), withoutKey)
+	require.ErrorContains(t, err, "a project is required")
+	_, _, _, err = builder.CreateAccount(ctxTest, serviceAccountInfo(t, "demo-project", ""), withoutKey)
+	require.ErrorContains(t, err, "an account ID is required")
+
+	details, _, err := builder.CreateAccountCapabilityDetails(ctxTest)
+	require.NoError(t, err)
+	require.Contains(t, details.GetSupportedCredentialOptions(), details.GetPreferredCredentialOption())
+}
+
+func TestServiceAccountListDisableDelete(t *testing.T) {
+	_, builder := newFakeServiceAccountBuilder(t)
+	for i := 0; i < serviceAccountsPageSize+1; i++ {
+		_, _, _, err := builder.CreateAccount(ctxTest, serviceAccountInfo(t, "demo-project", fmt.Sprintf("sa-%03d", i)), nil)
+		require.NoError(t, err)
+	}
+	_, _, _, err := builder.CreateAccount(ctxTest, serviceAccountInfo(t, "other-project", "etl"), nil)
+	require.NoError(t, err)
+
+	parent := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"}
+	resources, nextPageToken, _, err := builder.List(ctxTest, parent, &pagination.Token{})
+	require.NoError(t, err)
+	require.Len(t, resources, serviceAccountsPageSize)
+	require.NotEmpty(t, nextPageToken)
+
+	lastPage := &pagination.Token{Token: nextPageToken}
+	resources, nextPageToken, _, err = builder.List(ctxTest, parent, lastPage)
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	require.Empty(t, nextPageToken)
+	email := resources[0].GetId().GetResource()
+	require.Equal(t, fmt.Sprintf("sa-%03d@demo-project.iam.gserviceaccount.com", serviceAccountsPageSize), email)
+	require.NotEqual(t, v2.Status_RESOURCE_STATUS_DISABLED, resources[0].GetStatus().GetStatus())
+
+	args, err := structpb.NewStruct(map[string]interface{}{
+		serviceAccountActionArg: map[string]interface{}{
+			"resource_type_id": serviceAccountResourceType.Id,
+			"resource_id":      email,
+		},
+	})
+	require.NoError(t, err)
+	rv, _, err := builder.disableServiceAccount(ctxTest, args)
+	require.NoError(t, err)
+	require.True(t, rv.GetFields()["success"].GetBoolValue())
+
+	resources, _, _, err = builder.List(ctxTest, parent, lastPage)
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	require.Equal(t, v2.Status_RESOURCE_STATUS_DISABLED, resources[0].GetStatus().GetStatus())
+
+	_, err = builder.Delete(ctxTest, resources[0].GetId(), parent)
+	require.NoError(t, err)
+	resources, _, _, err = builder.List(ctxTest, parent, lastPage)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+
+	// A service account already gone is not an error.
+	_, err = builder.Delete(ctxTest, &v2.ResourceId{ResourceType: serviceAccountResourceType.Id, Resource: email}, parent)
+	require.NoError(t, err)
+
+	resources, _, _, err = builder.List(ctxTest, &v2.ResourceId{ResourceType: folderResourceType.Id, Resource: "456"}, &pagination.Token{})
+	require.NoError(t, err)
+	require.Empty(t, resources)
+}
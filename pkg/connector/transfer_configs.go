@@ -0,0 +1,198 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	datatransfer "cloud.google.com/go/bigquery/datatransfer/apiv1"
+	"cloud.google.com/go/bigquery/datatransfer/apiv1/datatransferpb"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// destinationEntitlement links a transfer config to the dataset it writes into.
+	destinationEntitlement = "destination"
+	// runAsEntitlement links a transfer config to the user or service account whose credentials it runs with.
+	runAsEntitlement = "run_as"
+)
+
+type transferConfigBuilder struct {
+	resourceType       *v2.ResourceType
+	dataTransferClient *datatransfer.Client
+	locations          []string
+}
+
+func (o *transferConfigBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return transferConfigResourceType
+}
+
+// List returns the transfer configs, scheduled queries included, of the parent project in every configured location.
+// Each config is read on its own as listing does not return the identity it runs as.
+func (o *transferConfigBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != projectResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	for _, location := range o.locations {
+		it := o.dataTransferClient.ListTransferConfigs(ctx, &datatransferpb.ListTransferConfigsRequest{
+			Parent: fmt.Sprintf("projects/%s/locations/%s", parentResourceID.GetResource(), strings.ToLower(location)),
+		})
+		for {
+			listed, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				if !isPermissionDenied(ctx, err) {
+					return nil, "", nil, wrapError(err, "Unable to fetch transfer configs")
+				}
+				break
+			}
+
+			config, err := o.transferConfig(ctx, listed.GetName())
+			if err != nil {
+				return nil, "", nil, err
+			}
+			if config == nil {
+				config = listed
+			}
+
+			resource, err := transferConfigResource(config, parentResourceID)
+			if err != nil {
+				return nil, "", nil, wrapError(err, "Unable to create transfer config resource")
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, "", nil, nil
+}
+
+func (o *transferConfigBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(resource, destinationEntitlement,
+			ent.WithGrantableTo(datasetResourceType),
+			ent.WithDescription(fmt.Sprintf("Dataset written by %s transfer config", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s transfer config %s", resource.DisplayName, destinationEntitlement)),
+		),
+		ent.NewAssignmentEntitlement(resource, runAsEntitlement,
+			ent.WithGrantableTo(userResourceType),
+			ent.WithDescription(fmt.Sprintf("Identity %s transfer config runs as", resource.DisplayName)),
+			ent.WithDisplayName(fmt.Sprintf("%s transfer config %s", resource.DisplayName, runAsEntitlement)),
+		),
+	}, "", nil, nil
+}
+
+// Grants links the transfer config to its destination dataset and to the user or service account it runs as.
+func (o *transferConfigBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	var grants []*v2.Grant
+	config, err := o.transferConfig(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if config == nil {
+		return nil, "", nil, nil
+	}
+
+	if datasetID := config.GetDestinationDatasetId(); datasetID != "" {
+		grants = append(grants, grant.NewGrant(resource, destinationEntitlement, &v2.ResourceId{
+			ResourceType: datasetResourceType.Id,
+			Resource:     datasetResourceID(resource.GetParentResourceId().GetResource(), datasetID),
+		}))
+	}
+
+	if email := config.GetOwnerInfo().GetEmail(); email != "" {
+		grants = append(grants, grant.NewGrant(resource, runAsEntitlement, &v2.ResourceId{
+			ResourceType: userResourceType.Id,
+			Resource:     email,
+		}))
+	}
+
+	return grants, "", nil, nil
+}
+
+// transferConfig reads a transfer config with its owner, it returns nil when the principal cannot read it.
+func (o *transferConfigBuilder) transferConfig(ctx context.Context, name string) (*datatransferpb.TransferConfig, error) {
+	config, err := o.dataTransferClient.GetTransferConfig(ctx, &datatransferpb.GetTransferConfigRequest{
+		Name: name,
+	})
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, wrapError(err, "Unable to fetch transfer config "+name)
+		}
+		return nil, nil
+	}
+
+	return config, nil
+}
+
+// transferConfigResource creates a transfer config resource. Its profile holds the data source, the schedule, the
+// destination dataset and the identity the config runs as, disabled configs are reported as such.
+func transferConfigResource(config *datatransferpb.TransferConfig, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	name := config.GetName()
+	profile := map[string]interface{}{
+		"name":           name,
+		"config_id":      name[strings.LastIndex(name, "/")+1:],
+		"data_source_id": config.GetDataSourceId(),
+		"state":          config.GetState().String(),
+		"disabled":       config.GetDisabled(),
+	}
+	if config.GetSchedule() != "" {
+		profile["schedule"] = config.GetSchedule()
+	}
+	if config.GetDestinationDatasetId() != "" {
+		profile["destination_dataset"] = datasetResourceID(parentResourceID.GetResource(), config.GetDestinationDatasetId())
+	}
+	if config.GetDatasetRegion() != "" {
+		profile["dataset_region"] = config.GetDatasetRegion()
+	}
+	if email := config.GetOwnerInfo().GetEmail(); email != "" {
+		profile["owner"] = email
+		if isServiceAccountEmail(email) {
+			profile["run_as_service_account"] = email
+		}
+	}
+	addLifecycleProfileFields(profile, nil, config.GetUpdateTime(), nil)
+	if config.GetNextRunTime() != nil {
+		profile["next_run_time"] = config.GetNextRunTime().AsTime().UTC().Format(time.RFC3339)
+	}
+
+	opts := []rs.ResourceOption{
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	}
+	if config.GetDisabled() {
+		opts = append(opts, rs.WithResourceStatus(v2.Status_RESOURCE_STATUS_DISABLED, "transfer config is disabled"))
+	}
+
+	displayName := config.GetDisplayName()
+	if displayName == "" {
+		displayName = profile["config_id"].(string)
+	}
+
+	return rs.NewResource(
+		displayName,
+		transferConfigResourceType,
+		name,
+		opts...,
+	)
+}
+
+func newTransferConfigBuilder(dataTransferClient *datatransfer.Client, locations []string) *transferConfigBuilder {
+	return &transferConfigBuilder{
+		resourceType:       transferConfigResourceType,
+		dataTransferClient: dataTransferClient,
+		locations:          locations,
+	}
+}
@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTransferConfigSync(t *testing.T) {
+	fake, client := newFakeDataTransfer(t)
+	fake.addConfig("projects/demo-project/locations/us", "nightly", "sales", "etl@demo-project.iam.gserviceaccount.com")
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"}
+
+	// The identity a config runs as is read from the config, listing does not return it.
+	builder := newTransferConfigBuilder(client, []string{"US"})
+	resources, err := listAll(builder, project)
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	profile := resources[0].GetProfile().GetFields()
+	require.Equal(t, "demo-project:sales", profile["destination_dataset"].GetStringValue())
+	require.Equal(t, "etl@demo-project.iam.gserviceaccount.com", profile["run_as_service_account"].GetStringValue())
+
+	grants, _, _, err := builder.Grants(ctxTest, resources[0], &pagination.Token{})
+	require.NoError(t, err)
+	got := make(map[string]string)
+	for _, g := range grants {
+		principal := g.GetPrincipal().GetId()
+		got[principal.GetResourceType()+":"+principal.GetResource()] = entitlementSlug(g.GetEntitlement())
+	}
+	require.Equal(t, map[string]string{
+		"dataset:demo-project:sales":                    destinationEntitlement,
+		"user:etl@demo-project.iam.gserviceaccount.com": runAsEntitlement,
+	}, got)
+}
+
+func TestTransferConfigListErrors(t *testing.T) {
+	fake, client := newFakeDataTransfer(t)
+	fake.addConfig("projects/demo-project/locations/us", "nightly", "sales", "etl@demo-project.iam.gserviceaccount.com")
+	fake.addConfig("projects/demo-project/locations/us", "hourly", "events", "alice@example.com")
+	builder := newTransferConfigBuilder(client, []string{"US"})
+	project := &v2.ResourceId{ResourceType: projectResourceType.Id, Resource: "demo-project"}
+
+	// A list failing after its first page fails the sync, it must not leave the next pages out.
+	fake.setListError(status.Error(codes.Internal, "backend error"), 1)
+	_, err := listAll(builder, project)
+	require.ErrorContains(t, err, "backend error")
+
+	// Without permission to list, nothing is synced and the sync goes on.
+	fake.setListError(status.Error(codes.PermissionDenied, "permission denied"), 0)
+	resources, err := listAll(builder, project)
+	require.NoError(t, err)
+	require.Empty(t, resources)
+}
@@ -0,0 +1,240 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	lastQueryTimeField   = "last_query_time"
+	queryCountField      = "query_count"
+	usageWindowDaysField = "usage_window_days"
+)
+
+// usageQuery counts the query jobs of every user over the window, both in total and per referenced dataset.
+// ROLLUP yields a per-user total row alongside the per-dataset rows, which keeps the distinct job count exact.
+const usageQuery = `
+SELECT
+  user_email,
+  dataset_key,
+  GROUPING(dataset_key) AS is_user_total,
+  COUNT(DISTINCT job_id) AS query_count,
+  MAX(creation_time) AS last_query_time
+FROM (
+  SELECT jobs.user_email, jobs.job_id, jobs.creation_time, CONCAT(ref.project_id, ':', ref.dataset_id) AS dataset_key
+  FROM ` + "`%s`.`region-%s`" + `.INFORMATION_SCHEMA.JOBS_BY_PROJECT AS jobs
+  LEFT JOIN UNNEST(jobs.referenced_tables) AS ref
+  WHERE jobs.job_type = 'QUERY'
+    AND jobs.creation_time >= TIMESTAMP_SUB(CURRENT_TIMESTAMP(), INTERVAL @window_days DAY)
+)
+GROUP BY ROLLUP(user_email, dataset_key)
+HAVING GROUPING(user_email) = 0`
+
+type usageRow struct {
+	UserEmail     bigquery.NullString `bigquery:"user_email"`
+	DatasetKey    bigquery.NullString `bigquery:"dataset_key"`
+	IsUserTotal   int64               `bigquery:"is_user_total"`
+	QueryCount    int64               `bigquery:"query_count"`
+	LastQueryTime time.Time           `bigquery:"last_query_time"`
+}
+
+type usageStats struct {
+	LastQueryTime time.Time
+	QueryCount    int64
+}
+
+func (s *usageStats) merge(queryCount int64, lastQueryTime time.Time) {
+	s.QueryCount += queryCount
+	if lastQueryTime.After(s.LastQueryTime) {
+		s.LastQueryTime = lastQueryTime
+	}
+}
+
+// projectUsage is the query activity recorded in a single project, keyed by user email.
+// It is nil when the activity of the project could not be read.
+type projectUsage struct {
+	users    map[string]*usageStats
+	datasets map[string]map[string]*usageStats
+}
+
+// usageReporter reads query activity from INFORMATION_SCHEMA.JOBS_BY_PROJECT and caches it per project for the sync.
+type usageReporter struct {
+	bigQueryClient *bigquery.Client
+	locations      []string
+	windowDays     int
+
+	mtx      sync.Mutex
+	projects map[string]*projectUsage
+}
+
+func newUsageReporter(bigQueryClient *bigquery.Client, locations []string, windowDays int) *usageReporter {
+	return &usageReporter{
+		bigQueryClient: bigQueryClient,
+		locations:      locations,
+		windowDays:     windowDays,
+		projects:       make(map[string]*projectUsage),
+	}
+}
+
+// reset drops the activity read during the previous sync, the next sync queries the projects again.
+func (u *usageReporter) reset() {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	u.projects = make(map[string]*projectUsage)
+}
+
+// projectUsage returns the query activity of the project, read once per sync. When a location cannot be queried the
+// activity is unknown rather than zero, so that live access is not reported as dormant: nil is cached and returned.
+// Without any location to query the activity is unknown as well.
+func (u *usageReporter) projectUsage(ctx context.Context, projectID string) *projectUsage {
+	l := ctxzap.Extract(ctx)
+	if len(u.locations) == 0 {
+		return nil
+	}
+
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	if usage, ok := u.projects[projectID]; ok {
+		return usage
+	}
+
+	usage := &projectUsage{
+		users:    make(map[string]*usageStats),
+		datasets: make(map[string]map[string]*usageStats),
+	}
+	for _, location := range u.locations {
+		if err := u.queryLocation(ctx, projectID, location, usage); err != nil {
+			l.Warn("unable to read query activity, usage is left out",
+				zap.String("project", projectID),
+				zap.String("location", location),
+				zap.Error(err))
+			usage = nil
+			break
+		}
+	}
+
+	u.projects[projectID] = usage
+	return usage
+}
+
+func (u *usageReporter) queryLocation(ctx context.Context, projectID string, location string, usage *projectUsage) error {
+	q := u.bigQueryClient.Query(fmt.Sprintf(usageQuery, projectID, strings.ToLower(location)))
+	q.Location = location
+	q.Parameters = []bigquery.QueryParameter{
+		{Name: "window_days", Value: u.windowDays},
+	}
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return wrapError(err, fmt.Sprintf("failed to query job usage (projectId:%s location:%s)", projectID, location))
+	}
+
+	for {
+		var row usageRow
+		err := it.Next(&row)
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("failed to read job usage (projectId:%s location:%s)", projectID, location))
+		}
+
+		if !row.UserEmail.Valid {
+			continue
+		}
+		email := row.UserEmail.StringVal
+
+		if row.IsUserTotal == 1 {
+			if _, ok := usage.users[email]; !ok {
+				usage.users[email] = &usageStats{}
+			}
+			usage.users[email].merge(row.QueryCount, row.LastQueryTime)
+			continue
+		}
+
+		if !row.DatasetKey.Valid {
+			continue
+		}
+		if _, ok := usage.datasets[row.DatasetKey.StringVal]; !ok {
+			usage.datasets[row.DatasetKey.StringVal] = make(map[string]*usageStats)
+		}
+		if _, ok := usage.datasets[row.DatasetKey.StringVal][email]; !ok {
+			usage.datasets[row.DatasetKey.StringVal][email] = &usageStats{}
+		}
+		usage.datasets[row.DatasetKey.StringVal][email].merge(row.QueryCount, row.LastQueryTime)
+	}
+
+	return nil
+}
+
+// usageFields returns the profile or grant metadata fields describing the given stats.
+func (u *usageReporter) usageFields(stats *usageStats) map[string]interface{} {
+	fields := map[string]interface{}{
+		queryCountField:      stats.QueryCount,
+		usageWindowDaysField: u.windowDays,
+	}
+	if !stats.LastQueryTime.IsZero() {
+		fields[lastQueryTimeField] = stats.LastQueryTime.UTC().Format(time.RFC3339)
+	}
+
+	return fields
+}
+
+// annotateUser adds the user's query activity in the project to the user profile.
+// Users without any query in the window get a zero count so that dormant access stands out, users of a project whose
+// activity could not be read get none.
+func (u *usageReporter) annotateUser(ctx context.Context, projectID string, resource *v2.Resource) error {
+	usage := u.projectUsage(ctx, projectID)
+	if usage == nil {
+		return nil
+	}
+
+	stats, ok := usage.users[resource.Id.Resource]
+	if !ok {
+		stats = &usageStats{}
+	}
+
+	return addResourceProfileFields(resource, u.usageFields(stats))
+}
+
+// annotateDatasetGrants adds the principal's query activity against the dataset to each grant.
+func (u *usageReporter) annotateDatasetGrants(ctx context.Context, projectID string, datasetID string, grants []*v2.Grant) error {
+	l := ctxzap.Extract(ctx)
+	usage := u.projectUsage(ctx, projectID)
+	if usage == nil {
+		return nil
+	}
+
+	datasetUsage := usage.datasets[fmt.Sprintf("%s:%s", projectID, datasetID)]
+	for _, g := range grants {
+		principalID := g.GetPrincipal().GetId()
+		if principalID.GetResourceType() != userResourceType.Id {
+			continue
+		}
+
+		stats, ok := datasetUsage[principalID.GetResource()]
+		if !ok {
+			stats = &usageStats{}
+		}
+
+		if err := addGrantMetadata(g, u.usageFields(stats)); err != nil {
+			l.Warn("unable to annotate grant with usage",
+				zap.String("grant", g.GetId()),
+				zap.Error(err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package connector
+
+import (
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+)
+
+var usageTestSchema = &bigqueryapi.TableSchema{
+	Fields: []*bigqueryapi.TableFieldSchema{
+		{Name: "user_email", Type: "STRING"},
+		{Name: "dataset_key", Type: "STRING"},
+		{Name: "is_user_total", Type: "INTEGER"},
+		{Name: "query_count", Type: "INTEGER"},
+		{Name: "last_query_time", Type: "TIMESTAMP"},
+	},
+}
+
+func usageTestRow(email string, datasetKey interface{}, isUserTotal string, queryCount string) *bigqueryapi.TableRow {
+	return &bigqueryapi.TableRow{F: []*bigqueryapi.TableCell{
+		{V: email},
+		{V: datasetKey},
+		{V: isUserTotal},
+		{V: queryCount},
+		// 2024-05-01T10:00:00Z in microseconds.
+		{V: "1714557600000000"},
+	}}
+}
+
+func usageTestUser(t *testing.T, email string) *v2.Resource {
+	resource, err := userResource(email, nil, nil)
+	require.NoError(t, err)
+	return resource
+}
+
+func TestUsageAnnotations(t *testing.T) {
+	bq, client, _ := newFakeBigQuery(t)
+	bq.setQueryResults(usageTestSchema, []*bigqueryapi.TableRow{
+		usageTestRow("alice@example.com", nil, "1", "3"),
+		usageTestRow("alice@example.com", "demo-project:sales", "0", "2"),
+	}, false)
+	usage := newUsageReporter(client, []string{"EU"}, 90)
+
+	alice := usageTestUser(t, "alice@example.com")
+	require.NoError(t, usage.annotateUser(ctxTest, "demo-project", alice))
+	fields := alice.GetProfile().GetFields()
+	require.Equal(t, float64(3), fields[queryCountField].GetNumberValue())
+	require.Equal(t, "2024-05-01T10:00:00Z", fields[lastQueryTimeField].GetStringValue())
+	require.Equal(t, float64(90), fields[usageWindowDaysField].GetNumberValue())
+
+	// Users without any query in the window are reported with a zero count.
+	bob := usageTestUser(t, "bob@example.com")
+	require.NoError(t, usage.annotateUser(ctxTest, "demo-project", bob))
+	require.Equal(t, float64(0), bob.GetProfile().GetFields()[queryCountField].GetNumberValue())
+	require.Equal(t, 1, bq.queryCount())
+
+	// A new sync reads the activity again.
+	usage.reset()
+	require.NoError(t, usage.annotateUser(ctxTest, "demo-project", usageTestUser(t, "alice@example.com")))
+	require.Equal(t, 2, bq.queryCount())
+}
+
+func TestUsageUnknownActivity(t *testing.T) {
+	bq, client, _ := newFakeBigQuery(t)
+
+	// Without locations nothing is queried and users are not reported as dormant.
+	alice := usageTestUser(t, "alice@example.com")
+	require.NoError(t, newUsageReporter(client, nil, 90).annotateUser(ctxTest, "demo-project", alice))
+	require.NotContains(t, alice.GetProfile().GetFields(), queryCountField)
+	require.Equal(t, 0, bq.queryCount())
+
+	// Neither are they when the query fails.
+	alice = usageTestUser(t, "alice@example.com")
+	require.NoError(t, newUsageReporter(client, []string{"EU"}, 90).annotateUser(ctxTest, "demo-project", alice))
+	require.NotContains(t, alice.GetProfile().GetFields(), queryCountField)
+	require.Equal(t, 1, bq.queryCount())
+
+	// Or when reading the results fails past the first page.
+	bq.setQueryResults(usageTestSchema, []*bigqueryapi.TableRow{
+		usageTestRow("alice@example.com", nil, "1", "3"),
+	}, true)
+	alice = usageTestUser(t, "alice@example.com")
+	require.NoError(t, newUsageReporter(client, []string{"EU"}, 90).annotateUser(ctxTest, "demo-project", alice))
+	require.NotContains(t, alice.GetProfile().GetFields(), queryCountField)
+}
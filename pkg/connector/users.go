@@ -2,24 +2,28 @@ package connector
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"cloud.google.com/go/bigquery"
+	iamadmin "cloud.google.com/go/iam/admin/apiv1"
 	"cloud.google.com/go/iam/apiv1/iampb"
 	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
-	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	sdkResource "github.com/conductorone/baton-sdk/pkg/types/resource"
-	"google.golang.org/api/iterator"
 )
 
 type userBuilder struct {
 	resourceType   *v2.ResourceType
 	ProjectsClient *resourcemanager.ProjectsClient
 	BigQueryClient *bigquery.Client
+	backend        policyBackend
+	iamClient      *iamadmin.IamClient
+	usage          *usageReporter
+	directory      *directoryEnricher
+	tokens         *accessTokenIssuer
 }
 
 func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
@@ -29,54 +33,44 @@ func (o *userBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
 // List returns all the users from the database as resource objects.
 // Users include a UserTrait because they are the 'shape' of a standard user.
 func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	var (
-		resources []*v2.Resource
-		bag       = &pagination.Bag{}
-	)
-	err := bag.Unmarshal(pToken.Token)
+	var resources []*v2.Resource
+	projects, bag, err := listProjectsPage(ctx, o.backend, pToken)
 	if err != nil {
-		return nil, "", nil, err
-	}
-
-	if bag.Current() == nil {
-		bag.Push(pagination.PageState{
-			ResourceTypeID: projectResourceType.Id,
-		})
-	}
-
-	it := o.ProjectsClient.SearchProjects(ctx,
-		&resourcemanagerpb.SearchProjectsRequest{
-			Query:     "",
-			PageToken: bag.PageToken(),
-		},
-	)
-	for {
-		project, err := it.Next()
-		if errors.Is(err, iterator.Done) || project == nil {
-			break
-		}
-
-		if err != nil {
-			if !isPermissionDenied(ctx, err) {
-				return nil, "", nil, wrapError(err, "Unable to fetch project")
-			}
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "Unable to fetch project")
 		}
+		return nil, "", nil, nil
+	}
 
-		policy, err := o.ProjectsClient.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{
-			Resource: fmt.Sprintf("projects/%s", project.ProjectId),
-		})
+	for _, project := range projects {
+		policy, err := o.backend.ProjectPolicy(ctx, project.ProjectId)
 		if err != nil {
 			if !isPermissionDenied(ctx, err) {
 				return nil, "", nil, wrapError(err, "listing users failed")
 			}
 		}
 
-		if policy == nil {
-			return resources, "", nil, nil
-		}
-
-		for _, binding := range policy.Bindings {
+		seen := make(map[string]struct{})
+		for _, binding := range policy.GetBindings() {
 			for _, member := range binding.Members {
+				if _, ok := seen[member]; ok {
+					continue
+				}
+				seen[member] = struct{}{}
+
+				if isDeleted, _, _ := isDeletedUserOrServiceAccountMember(member); isDeleted {
+					resource, err := deletedUserResource(member, &v2.ResourceId{
+						ResourceType: projectResourceType.Id,
+						Resource:     project.ProjectId,
+					})
+					if err != nil {
+						return nil, "", nil, wrapError(err, "failed to create deleted user resource")
+					}
+
+					resources = append(resources, resource)
+					continue
+				}
+
 				var userString string
 				var accountTrait sdkResource.UserTraitOption = nil
 				if isUserBool, _ := isUser(member); isUserBool {
@@ -97,14 +91,19 @@ func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 					return nil, "", nil, wrapError(err, "failed to create user resource")
 				}
 
+				if err := o.annotateUser(ctx, project.ProjectId, resource); err != nil {
+					return nil, "", nil, err
+				}
+
 				resources = append(resources, resource)
 			}
 		}
-	}
 
-	err = bag.Next(it.PageInfo().Token)
-	if err != nil {
-		return nil, "", nil, fmt.Errorf("failed to fetch bag.Next: %w", err)
+		aclUsers, err := o.datasetAccessUsers(ctx, project.ProjectId, policy, seen)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		resources = append(resources, aclUsers...)
 	}
 
 	pageToken, err := bag.Marshal()
@@ -115,20 +114,154 @@ func (o *userBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId,
 	return resources, pageToken, nil, nil
 }
 
-// Entitlements always returns an empty slice for users.
+// datasetAccessUsers returns the users and service accounts granted on the datasets of the project without being
+// members of the project policy, so that every dataset access entry has a principal. Principals deleted since they
+// were granted access are returned as deleted users.
+func (o *userBuilder) datasetAccessUsers(ctx context.Context, projectID string, policy *iampb.Policy, seen map[string]struct{}) ([]*v2.Resource, error) {
+	var resources []*v2.Resource
+	datasetIDs, err := o.backend.Datasets(ctx, projectID)
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, wrapError(err, "Unable to fetch datasets of project "+projectID)
+		}
+		return nil, nil
+	}
+
+	for _, datasetID := range datasetIDs {
+		dataset, err := o.backend.Dataset(ctx, projectID, datasetID)
+		if err != nil {
+			if !isPermissionDenied(ctx, err) {
+				return nil, wrapError(err, "Unable to fetch dataset metadata (projectId:"+projectID+" datasetID:"+datasetID+")")
+			}
+			continue
+		}
+		if dataset == nil {
+			continue
+		}
+
+		for _, entry := range dataset.Access {
+			access := accessEntryFromAPI(entry)
+			if isDeleted, _, _ := isDeletedUserOrServiceAccountMember(access.Entity); isDeleted {
+				if _, ok := seen[access.Entity]; ok {
+					continue
+				}
+				seen[access.Entity] = struct{}{}
+
+				resource, err := deletedUserResource(access.Entity, &v2.ResourceId{
+					ResourceType: projectResourceType.Id,
+					Resource:     projectID,
+				})
+				if err != nil {
+					return nil, wrapError(err, "failed to create deleted user resource")
+				}
+
+				resources = append(resources, resource)
+				continue
+			}
+
+			email, isServiceAccount, ok := accessEntryPrincipal(access, policy)
+			if !ok {
+				continue
+			}
+
+			member := fmt.Sprintf("%s:%s", user, email)
+			var accountTrait sdkResource.UserTraitOption = nil
+			if isServiceAccount {
+				member = fmt.Sprintf("%s:%s", serviceAccount, email)
+				accountTrait = sdkResource.WithAccountType(v2.UserTrait_ACCOUNT_TYPE_SERVICE)
+			}
+			if _, ok := seen[member]; ok {
+				continue
+			}
+			seen[member] = struct{}{}
+
+			resource, err := userResource(email, &v2.ResourceId{
+				ResourceType: projectResourceType.Id,
+				Resource:     projectID,
+			}, accountTrait)
+			if err != nil {
+				return nil, wrapError(err, "failed to create user resource")
+			}
+
+			if err := o.annotateUser(ctx, projectID, resource); err != nil {
+				return nil, err
+			}
+
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, nil
+}
+
+func (o *userBuilder) annotateUser(ctx context.Context, projectID string, resource *v2.Resource) error {
+	if o.usage != nil {
+		if err := o.usage.annotateUser(ctx, projectID, resource); err != nil {
+			return wrapError(err, "failed to annotate user with usage")
+		}
+	}
+
+	if o.directory != nil {
+		if err := o.directory.annotateUser(ctx, resource); err != nil {
+			return wrapError(err, "failed to annotate user with directory data")
+		}
+	}
+
+	return nil
+}
+
+// Entitlements returns the impersonation entitlements of service accounts, users have none.
 func (o *userBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+	if !isServiceAccountResource(resource) {
+		return nil, "", nil, nil
+	}
+
+	return impersonationEntitlements(resource), "", nil, nil
 }
 
-// Grants always returns an empty slice for users since they don't have any entitlements.
+// Grants returns the principals able to impersonate a service account. The role and dataset grants of the service
+// account are expanded to them.
 func (o *userBuilder) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+	if !isServiceAccountResource(resource) {
+		return nil, "", nil, nil
+	}
+
+	grants, err := impersonationGrants(ctx, o.iamClient, o.backend, resource)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return grants, "", nil, nil
+}
+
+// IssueCapabilityDetails describes the access tokens issued for service accounts.
+func (o *userBuilder) IssueCapabilityDetails(_ context.Context) (*v2.CredentialDetailsCredentialIssue, annotations.Annotations, error) {
+	return o.tokens.capabilityDetails(), nil, nil
+}
+
+// Issue generates a short-lived OAuth access token for a service account, letting its holder act as the service
+// account until the token expires without being bound to any role.
+func (o *userBuilder) Issue(ctx context.Context, input *connectorbuilder.CredentialIssueInput) (*connectorbuilder.CredentialIssueOutput, error) {
+	return o.tokens.issue(ctx, input)
 }
 
-func newUserBuilder(projectsClient *resourcemanager.ProjectsClient, bigQueryClient *bigquery.Client) *userBuilder {
+func newUserBuilder(
+	projectsClient *resourcemanager.ProjectsClient,
+	bigQueryClient *bigquery.Client,
+	backend policyBackend,
+	iamClient *iamadmin.IamClient,
+	usage *usageReporter,
+	directory *directoryEnricher,
+	tokens *accessTokenIssuer,
+) *userBuilder {
 	return &userBuilder{
 		resourceType:   userResourceType,
 		ProjectsClient: projectsClient,
 		BigQueryClient: bigQueryClient,
+		backend:        backend,
+		iamClient:      iamClient,
+		usage:          usage,
+		directory:      directory,
+		tokens:         tokens,
 	}
 }
@@ -0,0 +1,54 @@
+package connector
+
+import (
+	"testing"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	"github.com/stretchr/testify/require"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+)
+
+func newFakeUserBuilder(t *testing.T) (*fakeBigQuery, *fakeIAM, *userBuilder) {
+	bq, client, service := newFakeBigQuery(t)
+	iam, opts := newFakeIAM(t)
+	projectsClient, err := resourcemanager.NewProjectsClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = projectsClient.Close() })
+
+	backend := newDirectBackend(projectsClient, client, service)
+	return bq, iam, newUserBuilder(projectsClient, client, backend, nil, nil, nil, nil)
+}
+
+func TestUserListDeletedMembers(t *testing.T) {
+	bq, iam, builder := newFakeUserBuilder(t)
+	iam.addProject("demo-project")
+	iam.setPolicy("projects/demo-project", &iampb.Policy{
+		Etag: []byte("1"),
+		Bindings: []*iampb.Binding{
+			{Role: "roles/bigquery.dataViewer", Members: []string{"user:alice@example.com", "deleted:user:bob@example.com?uid=1"}},
+			{Role: "roles/bigquery.jobUser", Members: []string{"user:alice@example.com", "deleted:user:bob@example.com?uid=1"}},
+		},
+	})
+	bq.addDataset("demo-project", "sales",
+		&bigqueryapi.DatasetAccess{Role: "READER", UserByEmail: "alice@example.com"},
+		&bigqueryapi.DatasetAccess{Role: "READER", IamMember: "deleted:user:bob@example.com?uid=1"},
+		&bigqueryapi.DatasetAccess{Role: "READER", IamMember: "deleted:serviceAccount:etl@demo-project.iam.gserviceaccount.com?uid=2"},
+		&bigqueryapi.DatasetAccess{Role: "WRITER", IamMember: "deleted:serviceAccount:etl@demo-project.iam.gserviceaccount.com?uid=2"},
+	)
+
+	resources, _, _, err := builder.List(ctxTest, nil, &pagination.Token{})
+	require.NoError(t, err)
+
+	var ids []string
+	for _, resource := range resources {
+		ids = append(ids, resource.GetId().GetResource())
+	}
+	// Each principal is listed once, the deleted service account only holds dataset access.
+	require.Equal(t, []string{
+		"alice@example.com",
+		"deleted:user:bob@example.com?uid=1",
+		"deleted:serviceAccount:etl@demo-project.iam.gserviceaccount.com?uid=2",
+	}, ids)
+}
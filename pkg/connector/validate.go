@@ -0,0 +1,135 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/resourcemanager/apiv3/resourcemanagerpb"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	// syncPermissions are needed on every project to list its datasets, roles and principals.
+	syncPermissions = []string{
+		"resourcemanager.projects.get",
+		"resourcemanager.projects.getIamPolicy",
+		"bigquery.datasets.get",
+	}
+	// usagePermissions are needed to read INFORMATION_SCHEMA.JOBS_BY_PROJECT when usage enrichment is on.
+	usagePermissions = []string{
+		"bigquery.jobs.create",
+		"bigquery.jobs.listAll",
+	}
+	// provisioningPermissions are needed to change access, they are not required for a read-only sync.
+	provisioningPermissions = []string{
+		"resourcemanager.projects.setIamPolicy",
+		"bigquery.datasets.create",
+		"bigquery.datasets.update",
+		"bigquery.datasets.delete",
+		"iam.serviceAccounts.create",
+		"iam.serviceAccounts.delete",
+		"iam.serviceAccounts.disable",
+		"iam.serviceAccountKeys.create",
+	}
+)
+
+// permissionReport lists the permissions probed on the project used to validate the credentials, and those
+// the credentials lack.
+type permissionReport struct {
+	Principal           string
+	Project             string
+	Probed              []string
+	MissingSync         []string
+	MissingProvisioning []string
+}
+
+func (r *permissionReport) Error() string {
+	return fmt.Sprintf("principal %q is missing permissions required for sync on project %s: %s",
+		r.Principal, r.Project, strings.Join(r.MissingSync, ", "))
+}
+
+// probePermissions checks the credentials against a sample project: it lists one page of projects,
+// tests the sync and provisioning permissions on the first one and lists its datasets.
+func (d *GoogleBigQuery) probePermissions(ctx context.Context) (*permissionReport, error) {
+	it := d.ProjectsClient.SearchProjects(ctx, &resourcemanagerpb.SearchProjectsRequest{
+		PageSize: 1,
+	})
+	project, err := it.Next()
+	if errors.Is(err, iterator.Done) {
+		return nil, fmt.Errorf("google-big-query-connector: principal %q cannot see any project, grant it resourcemanager.projects.get on the projects to sync", d.principal)
+	}
+	if err != nil {
+		return nil, wrapError(err, fmt.Sprintf("principal %q is unable to search projects", d.principal))
+	}
+
+	required := syncPermissions
+	if d.usage != nil {
+		required = append(append([]string{}, syncPermissions...), usagePermissions...)
+	}
+
+	resp, err := d.ProjectsClient.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+		Resource:    fmt.Sprintf("projects/%s", project.ProjectId),
+		Permissions: append(append([]string{}, required...), provisioningPermissions...),
+	})
+	if err != nil {
+		return nil, wrapError(err, fmt.Sprintf("unable to test permissions on project %s", project.ProjectId))
+	}
+
+	granted := make(map[string]struct{}, len(resp.Permissions))
+	for _, permission := range resp.Permissions {
+		granted[permission] = struct{}{}
+	}
+
+	report := &permissionReport{
+		Principal: d.principal,
+		Project:   project.ProjectId,
+		Probed:    append(append([]string{}, required...), provisioningPermissions...),
+	}
+	for _, permission := range required {
+		if _, ok := granted[permission]; !ok {
+			report.MissingSync = append(report.MissingSync, permission)
+		}
+	}
+	for _, permission := range provisioningPermissions {
+		if _, ok := granted[permission]; !ok {
+			report.MissingProvisioning = append(report.MissingProvisioning, permission)
+		}
+	}
+
+	datasets := d.BigQueryClient.Datasets(ctx)
+	datasets.ProjectID = project.ProjectId
+	if _, err := datasets.Next(); err != nil && !errors.Is(err, iterator.Done) {
+		return nil, wrapError(err, fmt.Sprintf("principal %q is unable to list datasets of project %s", d.principal, project.ProjectId))
+	}
+
+	return report, nil
+}
+
+func (r *permissionReport) log(ctx context.Context) {
+	l := ctxzap.Extract(ctx)
+	if len(r.MissingProvisioning) > 0 {
+		l.Warn("baton-google-bigquery: credentials are missing permissions required for provisioning",
+			zap.String("principal", r.Principal),
+			zap.String("project", r.Project),
+			zap.Strings("missing_permissions", r.MissingProvisioning),
+		)
+	}
+}
+
+// annotation returns the report as a Validate annotation, so that missing provisioning permissions are surfaced to
+// the caller and not only logged.
+func (r *permissionReport) annotation() (*structpb.Struct, error) {
+	return structpb.NewStruct(map[string]interface{}{
+		"principal":                        r.Principal,
+		"project":                          r.Project,
+		"probed_permissions":               stringsToInterfaces(r.Probed),
+		"missing_sync_permissions":         stringsToInterfaces(r.MissingSync),
+		"missing_provisioning_permissions": stringsToInterfaces(r.MissingProvisioning),
+	})
+}
@@ -0,0 +1,71 @@
+package connector
+
+import (
+	"testing"
+
+	resourcemanager "cloud.google.com/go/resourcemanager/apiv3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newFakeValidateConnector returns a connector whose Validate probes a fake IAM and a fake BigQuery.
+func newFakeValidateConnector(t *testing.T) (*fakeBigQuery, *fakeIAM, *GoogleBigQuery) {
+	bq, client, service := newFakeBigQuery(t)
+	iam, opts := newFakeIAM(t)
+	projectsClient, err := resourcemanager.NewProjectsClient(ctxTest, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = projectsClient.Close() })
+
+	return bq, iam, &GoogleBigQuery{
+		ProjectsClient: projectsClient,
+		BigQueryClient: client,
+		config:         &Config{},
+		backend:        newDirectBackend(projectsClient, client, service),
+		principal:      "connector@demo-project.iam.gserviceaccount.com",
+	}
+}
+
+func TestValidatePermissionReport(t *testing.T) {
+	bq, iam, c := newFakeValidateConnector(t)
+	iam.addProject("demo-project")
+	bq.addDataset("demo-project", "sales")
+	iam.setGranted("projects/demo-project", append(append([]string{}, syncPermissions...), "bigquery.datasets.update")...)
+
+	// Missing provisioning permissions are reported, they don't fail a read-only sync.
+	annos, err := c.Validate(ctxTest)
+	require.NoError(t, err)
+	report := &structpb.Struct{}
+	ok, err := annos.Pick(report)
+	require.NoError(t, err)
+	require.True(t, ok)
+	fields := report.GetFields()
+	require.Equal(t, "demo-project", fields["project"].GetStringValue())
+	require.Equal(t, c.principal, fields["principal"].GetStringValue())
+	require.Empty(t, fields["missing_sync_permissions"].GetListValue().GetValues())
+	var missing []string
+	for _, v := range fields["missing_provisioning_permissions"].GetListValue().GetValues() {
+		missing = append(missing, v.GetStringValue())
+	}
+	require.Len(t, missing, len(provisioningPermissions)-1)
+	require.NotContains(t, missing, "bigquery.datasets.update")
+	require.Contains(t, missing, "resourcemanager.projects.setIamPolicy")
+
+	// A missing sync permission fails the validation.
+	iam.setGranted("projects/demo-project", "resourcemanager.projects.get", "resourcemanager.projects.getIamPolicy")
+	_, err = c.Validate(ctxTest)
+	require.ErrorContains(t, err, "bigquery.datasets.get")
+}
+
+func TestValidateProjectSearch(t *testing.T) {
+	_, iam, c := newFakeValidateConnector(t)
+
+	_, err := c.Validate(ctxTest)
+	require.ErrorContains(t, err, "cannot see any project")
+
+	iam.addProject("demo-project")
+	iam.setSearchError(status.Error(codes.Internal, "backend error"), 0)
+	_, err = c.Validate(ctxTest)
+	require.ErrorContains(t, err, "backend error")
+}
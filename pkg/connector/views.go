@@ -0,0 +1,103 @@
+package connector
+
+import (
+	"context"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	bigqueryapi "google.golang.org/api/bigquery/v2"
+)
+
+type viewBuilder struct {
+	resourceType    *v2.ResourceType
+	bigQueryService *bigqueryapi.Service
+}
+
+func (o *viewBuilder) ResourceType(ctx context.Context) *v2.ResourceType {
+	return viewResourceType
+}
+
+// List returns the views and materialized views of the parent dataset. The REST API reports the table type in the
+// listing, the client library would need a metadata call per table.
+func (o *viewBuilder) List(ctx context.Context, parentResourceID *v2.ResourceId, pToken *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	var resources []*v2.Resource
+	if parentResourceID.GetResourceType() != datasetResourceType.Id {
+		return nil, "", nil, nil
+	}
+
+	projectID, datasetID := parseDatasetResourceID(parentResourceID.GetResource())
+	call := o.bigQueryService.Tables.List(projectID, datasetID).Context(ctx)
+	if pToken != nil && pToken.Token != "" {
+		call = call.PageToken(pToken.Token)
+	}
+
+	tables, err := call.Do()
+	if err != nil {
+		if !isPermissionDenied(ctx, err) {
+			return nil, "", nil, wrapError(err, "Unable to fetch tables (projectId:"+projectID+" datasetID:"+datasetID+")")
+		}
+		return nil, "", nil, nil
+	}
+
+	for _, table := range tables.Tables {
+		if table.Type != "VIEW" && table.Type != "MATERIALIZED_VIEW" {
+			continue
+		}
+
+		resource, err := viewResource(table, parentResourceID)
+		if err != nil {
+			return nil, "", nil, wrapError(err, "Unable to create view resource")
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, tables.NextPageToken, nil, nil
+}
+
+// Entitlements is empty, views are synced as the principals of the authorized_view dataset entitlement.
+func (o *viewBuilder) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (o *viewBuilder) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func viewResource(table *bigqueryapi.TableListTables, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	ref := table.TableReference
+	profile := map[string]interface{}{
+		"name":       ref.TableId,
+		"project_id": ref.ProjectId,
+		"dataset_id": ref.DatasetId,
+		"view_id":    ref.TableId,
+		"type":       table.Type,
+	}
+	if table.FriendlyName != "" {
+		profile["friendly_name"] = table.FriendlyName
+	}
+	if table.CreationTime != 0 {
+		profile["creation_time"] = time.UnixMilli(table.CreationTime).UTC().Format(time.RFC3339)
+	}
+	if table.View != nil && table.View.UseLegacySql {
+		profile["legacy_sql"] = true
+	}
+
+	return rs.NewResource(
+		ref.TableId,
+		viewResourceType,
+		datasetChildResourceID(ref.ProjectId, ref.DatasetId, ref.TableId),
+		rs.WithParentResourceID(parentResourceID),
+		rs.WithResourceProfile(profile),
+	)
+}
+
+func newViewBuilder(bigQueryService *bigqueryapi.Service) *viewBuilder {
+	return &viewBuilder{
+		resourceType:    viewResourceType,
+		bigQueryService: bigQueryService,
+	}
+}